@@ -3,86 +3,95 @@ package api
 import (
 	"encoding/json"
 	"errors"
-	"fmt"
-	"mime"
-	"mime/multipart"
 	"net/http"
 	"strconv"
-	"strings"
-	"time"
 
 	"github.com/manishlpu/assignment/models"
 	"github.com/manishlpu/assignment/utils"
 	"github.com/gorilla/mux"
 )
 
-// Uploads the file to blob storage (s3 here).
+// Uploads the file to blob storage (s3 here). The file is sent either as the
+// upload_file part of a multipart form, or as the raw body of the request with
+// its filename in the path. Its content is streamed to the blob store as it is
+// received.
 func (ah *APIHandler) uploadFile(w http.ResponseWriter, r *http.Request) {
 	utils.DebugLog("inside uploadFile")
 
-	// Parse the multipart form data
-	err := r.ParseMultipartForm(10 << 9) // Setting the max limit to 100MB
+	if err := limitUploadBody(w, r); err != nil {
+		writeFailure(w, http.StatusRequestEntityTooLarge, err)
+		return
+	}
+	upload, err := readUploadRequest(r)
+	if errors.Is(err, errUploadTooLarge) {
+		writeFailure(w, http.StatusRequestEntityTooLarge, err)
+		return
+	} else if err != nil {
+		writeFailure(w, http.StatusBadRequest, err)
+		return
+	}
+
+	// Retrieve the description and destination folder of the file
+	if err := validateName(upload.Filename); err != nil {
+		writeFailure(w, http.StatusBadRequest, err)
+		return
+	}
+	folderID, err := parseFolderID(upload.FolderID)
+	if err != nil {
+		writeFailure(w, http.StatusBadRequest, err)
+		return
+	}
+	ownerID := getRequestUser(r).ID
+
+	expectedDigest, err := getExpectedDigest(r)
+	if err != nil {
+		writeFailure(w, http.StatusBadRequest, err)
+		return
+	}
+
+	// Refuse uploads beyond the quota before receiving them, the quota is
+	// enforced again once the size of the content is known
+	if err := ah.MetadataOps.CheckQuota(ownerID, upload.SizeInBytes, 1); err != nil {
+		writeFailure(w, getErrorStatusCode(err), err)
+		return
+	}
+
+	// The file is recorded as pending while its content is stored, and only
+	// becomes visible once committed
+	key := newBlobObjectKey(upload.Filename)
+	id, err := ah.MetadataOps.CreatePendingRecord(models.Metadata{
+		Filename:    upload.Filename,
+		S3ObjectKey: getObjectURI(key),
+		MimeType:    getMimeType(upload.Filename),
+		Description: upload.Description,
+		FolderID:    folderID,
+		OwnerID:     ownerID,
+	})
+	if err != nil {
+		utils.ErrorLog("Error saving metadata for upload: ", err)
+		writeFailure(w, getErrorStatusCode(err), err)
+		return
+	}
+
+	content, err := ah.streamObject(key, upload.Content, expectedDigest)
 	if err != nil {
-		http.Error(w, "Unable to parse form", http.StatusBadRequest)
+		ah.failUpload(id)
+		writeFailure(w, getUploadStatusCode(err), err)
 		return
 	}
 
-	// Retrieve the description and uploaded file
-	desc := r.FormValue("description")
-	file, header, err := r.FormFile("upload_file")
+	// The blob of a content is stored once whatever the number of files
+	// having it, the object is dropped unless it became the blob
+	content.ID = id
+	_, err = ah.MetadataOps.CommitRecord(content)
+	ah.discardObject(content.S3ObjectKey, content.ContentHash)
 	if err != nil {
-		http.Error(w, "Error retrieving file", http.StatusBadRequest)
-		return
-	}
-	defer file.Close()
-
-	// Specify the S3 bucket and object key where you want to upload the file
-	bucketName := utils.GetEnvValue("S3_BUCKET", "dropbox_files")
-	s3ObjectKey := header.Filename + "_" + fmt.Sprint(time.Now().UnixNano())
-
-	idChan := make(chan int64)
-	go func(fh *multipart.FileHeader, uri, description string) {
-		ext := fh.Filename[strings.LastIndexByte(fh.Filename, '.'):]
-		mimeType := mime.TypeByExtension(ext)
-
-		record := models.Metadata{
-			Filename:    fh.Filename,
-			SizeInBytes: fh.Size,
-			S3ObjectKey: uri,
-			MimeType:    mimeType,
-			Description: description,
-			Status:      1,
-		}
-		// Insert the metadata into RDBMS using goroutine
-		id, err := ah.MetadataOps.SaveRecord(record)
-		if err != nil {
-			utils.ErrorLog("Error saving metadata for upload: ", err)
-			return
-		}
-		idChan <- id
-	}(header, fmt.Sprintf("https://%s.s3.amazonaws.com/%s", bucketName, s3ObjectKey), desc)
-
-	utils.DebugLog("File size in bytes: ", header.Size)
-	if header.Size <= 5*1024*1024 {
-		err = ah.S3Ops.UploadObject(bucketName, s3ObjectKey, file)
-		if err != nil {
-			utils.ErrorLog("Error uploading metadata for upload: ", err)
-			w.WriteHeader(http.StatusInternalServerError)
-			w.Write(getFailureMessage(errors.New("unable to upload object")))
-			return
-		}
-	} else {
-		err = ah.S3Ops.UploadObjectParts(bucketName, s3ObjectKey, file)
-		if err != nil {
-			utils.ErrorLog("Error uploading metadata for upload: ", err)
-			w.WriteHeader(http.StatusInternalServerError)
-			w.Write(getFailureMessage(errors.New("unable to upload object")))
-			return
-		}
-	}
-
-	id := <-idChan
-	close(idChan)
+		utils.ErrorLog("Error committing upload: ", err)
+		ah.failUpload(id)
+		writeFailure(w, getErrorStatusCode(err), err)
+		return
+	}
+	go ah.indexFile(ownerID, id)
 
 	jsonBytes, err := getCustomMessage(map[string]interface{}{
 		"id": id,
@@ -95,6 +104,13 @@ func (ah *APIHandler) uploadFile(w http.ResponseWriter, r *http.Request) {
 	w.Write(jsonBytes)
 }
 
+// Marks a pending upload as failed, leaving it to the reconciliation.
+func (ah *APIHandler) failUpload(id int64) {
+	if err := ah.MetadataOps.FailRecord(id); err != nil {
+		utils.ErrorLog("error marking upload as failed: ", id, err)
+	}
+}
+
 // Fetch the file metadata from persistent storage (s3 here).
 func (ah *APIHandler) getFile(w http.ResponseWriter, r *http.Request) {
 	utils.DebugLog("inside getFile")
@@ -116,16 +132,24 @@ func (ah *APIHandler) getFile(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	data, err := ah.MetadataOps.GetRecord(fileID)
+	data, role, err := ah.MetadataOps.GetFileAccess(getRequestUser(r).ID, fileID)
 	if err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
 		w.Write(getFailureMessage(err))
 		return
 	}
-	if data == nil {
+	if data == nil || role == "" {
 		w.WriteHeader(http.StatusNoContent)
 		return
 	}
+	records := []models.Metadata{*data}
+	if err := ah.MetadataOps.LoadRecordLabels(records); err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write(getFailureMessage(err))
+		return
+	}
+	data = &records[0]
+	w.Header().Set("ETag", getMetadataETag(data))
 
 	jsonBytes, err := json.Marshal(data)
 	if err != nil {
@@ -138,7 +162,20 @@ func (ah *APIHandler) getFile(w http.ResponseWriter, r *http.Request) {
 	w.Write(jsonBytes)
 }
 
-// Upload the new file to blob storage and update metadata with new url.
+// Streams the content of the file from blob storage through the server.
+func (ah *APIHandler) downloadFile(w http.ResponseWriter, r *http.Request) {
+	utils.DebugLog("inside downloadFile")
+
+	record := ah.getActiveRecord(w, r, models.ROLE_VIEWER)
+	if record == nil {
+		return
+	}
+
+	ah.serveObject(w, r, record)
+}
+
+// Upload the new file to blob storage and record it as the new version of the
+// file. The file is sent the same ways as to uploadFile.
 func (ah *APIHandler) updateFile(w http.ResponseWriter, r *http.Request) {
 	utils.DebugLog("inside updateFile")
 
@@ -159,94 +196,98 @@ func (ah *APIHandler) updateFile(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Parse the multipart form data
-	err = r.ParseMultipartForm(10 << 9) // Setting the max limit to 100MB
-	if err != nil {
-		http.Error(w, "Unable to parse form", http.StatusBadRequest)
-		return
-	}
-
-	// Fetch the record with given ID to verify if it exists
-	record, err := ah.MetadataOps.GetRecord(fileID)
+	// Fetch the record with given ID to verify if it exists, before reading
+	// the content
+	record, role, err := ah.MetadataOps.GetFileAccess(getRequestUser(r).ID, fileID)
 	if err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
 		w.Write(getFailureMessage(err))
 		return
 	}
 
-	if record == nil {
+	if record == nil || role == "" {
 		w.WriteHeader(http.StatusBadRequest)
 		w.Write(getFailureMessage(errors.New("no file exists with given id")))
 		return
 	}
+	if !models.RoleAllows(role, models.ROLE_EDITOR) {
+		writeFailure(w, http.StatusForbidden, errors.New("editor role is required on the file"))
+		return
+	}
+	if !checkIfMatch(w, r, record) {
+		return
+	}
+	ownerID := record.OwnerID
+
+	// Retrieve the description and uploaded file, a raw body keeps the name
+	// of the file unless given in the query string
+	if err := limitUploadBody(w, r); err != nil {
+		writeFailure(w, http.StatusRequestEntityTooLarge, err)
+		return
+	}
+	upload, err := readUploadRequest(r)
+	if errors.Is(err, errUploadTooLarge) {
+		writeFailure(w, http.StatusRequestEntityTooLarge, err)
+		return
+	} else if err != nil {
+		writeFailure(w, http.StatusBadRequest, err)
+		return
+	}
+	if upload.Filename == "" {
+		upload.Filename = record.Filename
+	}
+	if err := validateName(upload.Filename); err != nil {
+		writeFailure(w, http.StatusBadRequest, err)
+		return
+	}
 
-	// Retrieve the description and uploaded file
-	desc := r.FormValue("description")
-	file, header, err := r.FormFile("upload_file")
+	expectedDigest, err := getExpectedDigest(r)
 	if err != nil {
-		http.Error(w, "Error retrieving file", http.StatusBadRequest)
-		return
-	}
-	defer file.Close()
-
-	// Specify the S3 bucket and object key where you want to upload the file
-	bucketName := utils.GetEnvValue("S3_BUCKET", "dropbox_files")
-	s3ObjectKey := header.Filename + "_" + fmt.Sprint(time.Now().UnixNano())
-	newS3Key := fmt.Sprintf("https://%s.s3.amazonaws.com/%s", bucketName, s3ObjectKey)
-
-	boolChan := make(chan bool)
-	go func(fh *multipart.FileHeader, uri, description string) {
-		ext := fh.Filename[strings.LastIndexByte(fh.Filename, '.'):]
-		mimeType := mime.TypeByExtension(ext)
-
-		newRecord := models.Metadata{
-			Filename:    fh.Filename,
-			SizeInBytes: fh.Size,
-			S3ObjectKey: uri,
-			MimeType:    mimeType,
-			Description: description,
-			Status:      1,
-		}
-		// Insert the metadata into RDBMS using goroutine
-		if err := ah.MetadataOps.UpdateRecord(fileID, newRecord); err != nil {
-			utils.ErrorLog("Error saving metadata for upload: ", err)
-			return
-		}
-		boolChan <- true
-	}(header, newS3Key, desc)
-
-	utils.DebugLog("File size in bytes: ", header.Size)
-	if header.Size <= 5*1024*1024 {
-		err = ah.S3Ops.UploadObject(bucketName, s3ObjectKey, file)
-		if err != nil {
-			utils.ErrorLog("Error uploading metadata for upload: ", err)
-			w.WriteHeader(http.StatusInternalServerError)
-			w.Write(getFailureMessage(errors.New("unable to upload object")))
-			return
-		}
-	} else {
-		err = ah.S3Ops.UploadObjectParts(bucketName, s3ObjectKey, file)
-		if err != nil {
-			utils.ErrorLog("Error uploading metadata for upload: ", err)
-			w.WriteHeader(http.StatusInternalServerError)
-			w.Write(getFailureMessage(errors.New("unable to upload object")))
-			return
-		}
-	}
-
-	<-boolChan
-	close(boolChan)
-
-	// Remove the previous uploaded object from blob store
-	go func(bucket, s3Key, newKey string) {
-		if !strings.EqualFold(s3Key, newKey) {
-			if err = ah.S3Ops.DeleteObject(bucket, getS3KeyFromURI(s3Key)); err != nil {
-				utils.ErrorLog("error deleting object: ", err)
-				return
-			}
-		}
-	}(bucketName, record.S3ObjectKey, newS3Key)
+		writeFailure(w, http.StatusBadRequest, err)
+		return
+	}
 
+	// Refuse updates beyond the quota before receiving them, the quota is
+	// enforced again once the size of the content is known
+	if err := ah.MetadataOps.CheckQuota(ownerID, upload.SizeInBytes, 0); err != nil {
+		writeFailure(w, getErrorStatusCode(err), err)
+		return
+	}
+
+	content, err := ah.streamObject(newBlobObjectKey(upload.Filename), upload.Content, expectedDigest)
+	if err != nil {
+		writeFailure(w, getUploadStatusCode(err), err)
+		return
+	}
+
+	err = ah.MetadataOps.UpdateRecord(ownerID, fileID, models.Metadata{
+		Filename:    upload.Filename,
+		SizeInBytes: content.SizeInBytes,
+		S3ObjectKey: content.S3ObjectKey,
+		MimeType:    getMimeType(upload.Filename),
+		Description: upload.Description,
+		ContentHash: content.ContentHash,
+		ContentMD5:  content.ContentMD5,
+		Revision:    record.Revision,
+		Status:      1,
+	})
+	// The blob of a content is stored once whatever the number of files
+	// having it, the object is dropped unless it became the blob
+	ah.discardObject(content.S3ObjectKey, content.ContentHash)
+	if err != nil {
+		utils.ErrorLog("Error saving metadata for upload: ", err)
+		writeFailure(w, getErrorStatusCode(err), err)
+		return
+	}
+
+	// The previous object is kept as a version, drop the versions beyond retention
+	go ah.pruneVersions(record)
+	go ah.indexFile(ownerID, fileID)
+
+	// The update applied to the revision read, and moved the file to the next one
+	current := *record
+	current.Revision++
+	w.Header().Set("ETag", getMetadataETag(&current))
 	w.Header().Set("Content-Type", "application/json")
 	w.Write(getSuccessMessage())
 }
@@ -272,23 +313,29 @@ func (ah *APIHandler) deleteFile(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Validate if record with the given id exists
-	exists, err := ah.MetadataOps.Exists(fileID)
+	// Validate if record with the given id exists, only its owner deletes it
+	record, role, err := ah.MetadataOps.GetFileAccess(getRequestUser(r).ID, fileID)
 	if err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
 		w.Write(getFailureMessage(err))
 		return
 	}
 
-	if !exists {
+	if record == nil || role == "" {
 		w.WriteHeader(http.StatusBadRequest)
 		w.Write(getFailureMessage(errors.New("no such record with given id exists")))
 		return
 	}
+	if role != models.ROLE_OWNER {
+		writeFailure(w, http.StatusForbidden, errors.New("owner role is required on the file"))
+		return
+	}
+	if !checkIfMatch(w, r, record) {
+		return
+	}
 
-	if err = ah.MetadataOps.DeactivateRecord(fileID); err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
-		w.Write([]byte(getFailureMessage(err)))
+	if err = ah.MetadataOps.DeactivateRecord(record.OwnerID, fileID, record.Revision); err != nil {
+		writeFailure(w, getErrorStatusCode(err), err)
 		return
 	}
 
@@ -296,18 +343,38 @@ func (ah *APIHandler) deleteFile(w http.ResponseWriter, r *http.Request) {
 	w.Write(getSuccessMessage())
 }
 
+// Lists a page of the files of the user, pointing to the next page through the
+// X-Next-Cursor and Link headers when there is one.
 func (ah *APIHandler) listFiles(w http.ResponseWriter, r *http.Request) {
 	utils.DebugLog("inside listFiles")
 
+	opts, err := getFileListOptions(r)
+	if err != nil {
+		writeFailure(w, http.StatusBadRequest, err)
+		return
+	}
+
 	w.Header().Add("Content-Type", "application/json")
 
-	data, err := ah.MetadataOps.FetchRecords()
+	// One more file than the page tells whether there is a next one
+	limit := opts.Limit
+	opts.Limit++
+	data, err := ah.MetadataOps.FetchRecords(getRequestUser(r).ID, opts)
 	if err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
 		w.Write(getFailureMessage(err))
 		return
 	}
 
+	if len(data) > limit {
+		data = data[:limit]
+		setNextPage(w, r, opts.CursorAfter(data[limit-1]))
+	}
+	if err := ah.MetadataOps.LoadRecordLabels(data); err != nil {
+		writeFailure(w, http.StatusInternalServerError, err)
+		return
+	}
+
 	if data == nil {
 		w.WriteHeader(http.StatusNoContent)
 		return
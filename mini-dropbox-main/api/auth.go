@@ -0,0 +1,258 @@
+package api
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/manishlpu/assignment/models"
+	"github.com/manishlpu/assignment/utils"
+	"github.com/gorilla/mux"
+	"golang.org/x/crypto/bcrypt"
+)
+
+type contextKey int
+
+const userContextKey contextKey = iota
+
+// Names of the routes reachable without authentication.
+var publicRoutes = map[string]bool{
+	"signup":    true,
+	"login":     true,
+	"presigned": true,
+}
+
+var (
+	usernamePattern = regexp.MustCompile(`^[a-z0-9._-]{3,64}$`)
+
+	errUnauthorized       = errors.New("authentication is required")
+	errInvalidCredentials = errors.New("invalid username or password")
+)
+
+// Compared against when the user does not exist, so that a login takes as
+// long whether the username exists or not.
+var dummyPasswordHash, _ = bcrypt.GenerateFromPassword([]byte("dummy-password"), bcrypt.DefaultCost)
+
+type credentialsRequest struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+}
+
+// Returns the validity of the sessions issued on login, read from SESSION_TTL.
+func getSessionTTL() time.Duration {
+	ttl, err := time.ParseDuration(utils.GetEnvValue("SESSION_TTL", "24h"))
+	if err != nil || ttl <= 0 {
+		utils.WarnLog("invalid SESSION_TTL, using the default of 24h")
+		return 24 * time.Hour
+	}
+	return ttl
+}
+
+// Returns the hex encoded SHA-256 of a token, as stored in the metadata store.
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// Returns the token of the "Authorization: Bearer <token>" header.
+func getBearerToken(r *http.Request) string {
+	scheme, token, ok := strings.Cut(r.Header.Get("Authorization"), " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") {
+		return ""
+	}
+	return strings.TrimSpace(token)
+}
+
+// Returns the user authenticated by authMiddleware.
+func getRequestUser(r *http.Request) *models.User {
+	user, _ := r.Context().Value(userContextKey).(*models.User)
+	return user
+}
+
+// Resolves the user of a session or API token. The API token is returned
+// along with its user.
+func (ah *APIHandler) authenticate(token string) (*models.User, *models.APIToken, error) {
+	if strings.HasPrefix(token, apiTokenPrefix) {
+		return ah.MetadataOps.GetAPITokenUser(hashToken(token))
+	}
+
+	user, err := ah.MetadataOps.GetSessionUser(hashToken(token))
+	return user, nil, err
+}
+
+// Rejects the requests without a valid session or API token, except on public
+// routes, as well as the requests out of the scopes of API tokens. The user
+// of the token is available through getRequestUser.
+func (ah *APIHandler) authMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodOptions {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if route := mux.CurrentRoute(r); route != nil && publicRoutes[route.GetName()] {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		token := getBearerToken(r)
+		if utils.IsEmptyString(token) {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			writeFailure(w, http.StatusUnauthorized, errUnauthorized)
+			return
+		}
+
+		user, apiToken, err := ah.authenticate(token)
+		if err != nil {
+			utils.ErrorLog("Error authenticating request: ", err)
+			writeFailure(w, http.StatusInternalServerError, errors.New("unable to authenticate"))
+			return
+		}
+		if user == nil {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			writeFailure(w, http.StatusUnauthorized, errors.New("token is invalid or has expired"))
+			return
+		}
+
+		if apiToken != nil {
+			if scope := getRequiredScope(r); !apiToken.HasScope(scope) {
+				writeFailure(w, http.StatusForbidden, fmt.Errorf("api token lacks the %s scope", scope))
+				return
+			}
+			if err := ah.MetadataOps.TouchAPIToken(apiToken.ID); err != nil {
+				utils.WarnLog("unable to record use of api token: ", apiToken.ID, err)
+			}
+		}
+
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), userContextKey, user)))
+	})
+}
+
+// Decodes the credentials of the request body. Usernames are case insensitive.
+func decodeCredentials(r *http.Request) (*credentialsRequest, error) {
+	var req credentialsRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		return nil, errors.New("invalid request body")
+	}
+	req.Username = strings.ToLower(strings.TrimSpace(req.Username))
+	return &req, nil
+}
+
+// Creates a user account.
+func (ah *APIHandler) signup(w http.ResponseWriter, r *http.Request) {
+	utils.DebugLog("inside signup")
+
+	req, err := decodeCredentials(r)
+	if err != nil {
+		writeFailure(w, http.StatusBadRequest, err)
+		return
+	}
+	if !usernamePattern.MatchString(req.Username) {
+		writeFailure(w, http.StatusBadRequest, errors.New("username must be 3 to 64 letters, digits, dots, dashes or underscores"))
+		return
+	}
+	// bcrypt ignores anything past 72 bytes
+	if len(req.Password) < 8 || len(req.Password) > 72 {
+		writeFailure(w, http.StatusBadRequest, errors.New("password must be 8 to 72 characters"))
+		return
+	}
+
+	passwordHash, err := bcrypt.GenerateFromPassword([]byte(req.Password), bcrypt.DefaultCost)
+	if err != nil {
+		writeFailure(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	id, err := ah.MetadataOps.CreateUser(models.User{
+		Username:     req.Username,
+		PasswordHash: string(passwordHash),
+	})
+	if errors.Is(err, utils.ErrUsernameTaken) {
+		writeFailure(w, http.StatusConflict, err)
+		return
+	} else if err != nil {
+		utils.ErrorLog("Error creating user: ", err)
+		writeFailure(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, map[string]interface{}{
+		"id": id,
+	})
+}
+
+// Checks the credentials of a user and issues a session token.
+func (ah *APIHandler) login(w http.ResponseWriter, r *http.Request) {
+	utils.DebugLog("inside login")
+
+	req, err := decodeCredentials(r)
+	if err != nil {
+		writeFailure(w, http.StatusBadRequest, err)
+		return
+	}
+
+	user, err := ah.MetadataOps.GetUserByUsername(req.Username)
+	if err != nil {
+		writeFailure(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	passwordHash := dummyPasswordHash
+	if user != nil {
+		passwordHash = []byte(user.PasswordHash)
+	}
+	if err := bcrypt.CompareHashAndPassword(passwordHash, []byte(req.Password)); err != nil || user == nil {
+		writeFailure(w, http.StatusUnauthorized, errInvalidCredentials)
+		return
+	}
+
+	token, err := newRandomID()
+	if err != nil {
+		writeFailure(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	expiresAt := time.Now().Add(getSessionTTL())
+	if err := ah.MetadataOps.CreateSession(hashToken(token), user.ID, expiresAt); err != nil {
+		utils.ErrorLog("Error creating session: ", err)
+		writeFailure(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"token":      token,
+		"token_type": "Bearer",
+		"expires_at": expiresAt.UTC(),
+	})
+}
+
+// Revokes the session token of the request.
+func (ah *APIHandler) logout(w http.ResponseWriter, r *http.Request) {
+	utils.DebugLog("inside logout")
+
+	if err := ah.MetadataOps.DeleteSession(hashToken(getBearerToken(r))); err != nil {
+		writeFailure(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(getSuccessMessage())
+}
+
+// Returns the authenticated user.
+func (ah *APIHandler) getCurrentUser(w http.ResponseWriter, r *http.Request) {
+	utils.DebugLog("inside getCurrentUser")
+
+	writeJSON(w, http.StatusOK, getRequestUser(r))
+}
+
+// Removes the expired sessions.
+func (ah *APIHandler) CleanupSessions() error {
+	return ah.MetadataOps.DeleteExpiredSessions()
+}
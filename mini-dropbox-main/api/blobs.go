@@ -0,0 +1,53 @@
+package api
+
+import (
+	"github.com/manishlpu/assignment/utils"
+)
+
+// Removes an object uploaded with the content, unless it is the object of the
+// blob of the content. Files are pointed at the blob of their content as they
+// are recorded, the object uploaded being of no use when the content was
+// stored already or when the file could not be recorded.
+func (ah *APIHandler) discardObject(uri, contentHash string) {
+	blob, err := ah.MetadataOps.GetBlob(contentHash)
+	if err != nil {
+		utils.ErrorLog("error fetching blob: ", err)
+		return
+	}
+	if blob != nil && blob.S3ObjectKey == uri {
+		return
+	}
+
+	if err := ah.S3Ops.DeleteObject(getBucketName(), getS3KeyFromURI(uri)); err != nil {
+		utils.ErrorLog("error deleting object: ", err)
+	}
+}
+
+// Removes the objects of the blobs released by the metadata store, unless
+// they are referenced again or removed by someone else meanwhile. Returns the
+// number of blobs removed and their total size.
+func (ah *APIHandler) deleteBlobs(contentHashes []string) (int, int64) {
+	bucketName := getBucketName()
+
+	var count int
+	var bytes int64
+	for _, contentHash := range contentHashes {
+		blob, err := ah.MetadataOps.ClaimBlob(contentHash)
+		if err != nil {
+			utils.ErrorLog("error claiming blob: ", contentHash, err)
+			continue
+		}
+		if blob == nil {
+			continue
+		}
+
+		// The blob is no longer recorded, a failure here leaves an orphan
+		// object behind but never a blob without its object
+		if err := ah.S3Ops.DeleteObject(bucketName, getS3KeyFromURI(blob.S3ObjectKey)); err != nil {
+			utils.ErrorLog("error deleting object: ", err)
+		}
+		count++
+		bytes += blob.SizeInBytes
+	}
+	return count, bytes
+}
@@ -0,0 +1,135 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/manishlpu/assignment/models"
+	"github.com/manishlpu/assignment/utils"
+)
+
+// objectReadSeeker exposes an object of the blob store as an io.ReadSeeker.
+// Nothing is fetched until the first read, which is pushed down to the store
+// as a ranged read starting at the current offset, so serving a range never
+// reads the whole object.
+type objectReadSeeker struct {
+	store  utils.S3Ops
+	bucket string
+	key    string
+	size   int64
+	offset int64
+	body   io.ReadCloser
+	// Position of body in the object, may differ from offset after a seek.
+	bodyOffset int64
+}
+
+func newObjectReadSeeker(store utils.S3Ops, bucket, key string, size int64) *objectReadSeeker {
+	return &objectReadSeeker{
+		store:  store,
+		bucket: bucket,
+		key:    key,
+		size:   size,
+	}
+}
+
+func (o *objectReadSeeker) Read(p []byte) (int, error) {
+	if o.offset >= o.size {
+		return 0, io.EOF
+	}
+
+	// Drop a stream left at another position by a seek, the read starts a
+	// new one at the current offset.
+	if o.body != nil && o.bodyOffset != o.offset {
+		o.Close()
+	}
+	if err := o.open(); err != nil {
+		return 0, err
+	}
+
+	n, err := o.body.Read(p)
+	o.offset += int64(n)
+	o.bodyOffset = o.offset
+	return n, err
+}
+
+// Opens a stream from the current offset till the end of the object, unless
+// one is already open.
+func (o *objectReadSeeker) open() error {
+	if o.body != nil {
+		return nil
+	}
+
+	body, err := o.store.GetObjectRange(o.bucket, o.key, o.offset, -1)
+	if err != nil {
+		return err
+	}
+	o.body = body
+	o.bodyOffset = o.offset
+	return nil
+}
+
+func (o *objectReadSeeker) Seek(offset int64, whence int) (int64, error) {
+	var target int64
+	switch whence {
+	case io.SeekStart:
+		target = offset
+	case io.SeekCurrent:
+		target = o.offset + offset
+	case io.SeekEnd:
+		target = o.size + offset
+	default:
+		return 0, errors.New("invalid whence")
+	}
+	if target < 0 {
+		return 0, errors.New("negative position")
+	}
+
+	o.offset = target
+	return target, nil
+}
+
+func (o *objectReadSeeker) Close() error {
+	if o.body == nil {
+		return nil
+	}
+	err := o.body.Close()
+	o.body = nil
+	return err
+}
+
+// Returns the entity tag of the file content. Files stored before content
+// hashes were recorded get a weak tag derived from their last update.
+func getETag(record *models.Metadata) string {
+	if !utils.IsEmptyString(record.ContentHash) {
+		return fmt.Sprintf("%q", record.ContentHash)
+	}
+	return fmt.Sprintf("W/\"%d-%d\"", record.ID, record.UpdatedAt.UnixNano())
+}
+
+// Serves the object of the given record, honouring Range, If-Range,
+// If-None-Match, If-Match and If-Modified-Since headers of the request.
+func (ah *APIHandler) serveObject(w http.ResponseWriter, r *http.Request, record *models.Metadata) {
+	content := newObjectReadSeeker(ah.S3Ops, getBucketName(), getS3KeyFromURI(record.S3ObjectKey), record.SizeInBytes)
+	defer content.Close()
+
+	// Open the stream of a full download before writing any header, so that a
+	// missing object can still be reported with a proper status.
+	if r.Method == http.MethodGet && r.Header.Get("Range") == "" {
+		if err := content.open(); err != nil {
+			utils.ErrorLog("Error fetching object for download: ", err)
+			statusCode := http.StatusInternalServerError
+			if errors.Is(err, utils.ErrObjectNotFound) {
+				statusCode = http.StatusNotFound
+			}
+			writeFailure(w, statusCode, errors.New("unable to fetch object"))
+			return
+		}
+	}
+
+	setContentHeaders(w, record)
+	setDigestHeaders(w, record)
+	w.Header().Set("ETag", getETag(record))
+	http.ServeContent(w, r, record.Filename, record.UpdatedAt, content)
+}
@@ -0,0 +1,164 @@
+package api
+
+import (
+	"archive/zip"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"mime"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/ledongthuc/pdf"
+)
+
+const (
+	// Files beyond this size are not extracted
+	maxExtractedFileSize = 100 << 20
+	// Text extracted from a file beyond this size is not indexed
+	maxExtractedText = 1 << 20
+)
+
+// textExtractor pulls the plain text out of the content of a file.
+type textExtractor func(file io.ReaderAt, size int64) (string, error)
+
+// Returns the extractor of the content of the file, nil when its type holds
+// no text worth indexing.
+func getTextExtractor(filename, mimeType string) textExtractor {
+	mediaType, _, _ := mime.ParseMediaType(mimeType)
+	switch {
+	case mediaType == "text/plain", mediaType == "text/markdown", mediaType == "text/x-markdown", mediaType == "text/csv":
+		return extractPlainText
+	case mediaType == "application/pdf":
+		return extractPDFText
+	case mediaType == "application/vnd.openxmlformats-officedocument.wordprocessingml.document":
+		return extractDOCXText
+	}
+
+	// Types unknown to the system mime database
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".txt", ".md", ".markdown", ".csv":
+		return extractPlainText
+	case ".pdf":
+		return extractPDFText
+	case ".docx":
+		return extractDOCXText
+	}
+	return nil
+}
+
+func extractPlainText(file io.ReaderAt, size int64) (string, error) {
+	data, err := io.ReadAll(io.NewSectionReader(file, 0, min(size, maxExtractedText)))
+	if err != nil {
+		return "", err
+	}
+	return toValidText(string(data)), nil
+}
+
+func extractPDFText(file io.ReaderAt, size int64) (text string, err error) {
+	// The reader panics on some malformed documents
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("malformed pdf: %v", r)
+		}
+	}()
+
+	reader, err := pdf.NewReader(file, size)
+	if err != nil {
+		return "", err
+	}
+	plain, err := reader.GetPlainText()
+	if err != nil {
+		return "", err
+	}
+	data, err := io.ReadAll(io.LimitReader(plain, maxExtractedText))
+	if err != nil {
+		return "", err
+	}
+	return toValidText(string(data)), nil
+}
+
+// Reads the text runs of the main document part, one line per paragraph.
+func extractDOCXText(file io.ReaderAt, size int64) (string, error) {
+	archive, err := zip.NewReader(file, size)
+	if err != nil {
+		return "", err
+	}
+	part, err := archive.Open("word/document.xml")
+	if err != nil {
+		return "", err
+	}
+	defer part.Close()
+
+	var b strings.Builder
+	decoder := xml.NewDecoder(part)
+	inText := false
+	for b.Len() < maxExtractedText {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return "", err
+		}
+
+		switch t := token.(type) {
+		case xml.StartElement:
+			switch t.Name.Local {
+			case "t":
+				inText = true
+			case "tab":
+				b.WriteString("\t")
+			case "br":
+				b.WriteString("\n")
+			}
+		case xml.EndElement:
+			switch t.Name.Local {
+			case "t":
+				inText = false
+			case "p":
+				b.WriteString("\n")
+			}
+		case xml.CharData:
+			if inText {
+				b.Write(t)
+			}
+		}
+	}
+	return toValidText(b.String()), nil
+}
+
+// Caps the text to the indexed size, dropping invalid UTF-8 sequences.
+func toValidText(text string) string {
+	if len(text) > maxExtractedText {
+		text = text[:maxExtractedText]
+	}
+	return strings.ToValidUTF8(text, "")
+}
+
+// Copies the content of the object into a temporary file, which extractors
+// read at random. The file is removed once closed through the returned
+// function.
+func (ah *APIHandler) downloadObject(uri string) (*os.File, int64, func(), error) {
+	object, err := ah.S3Ops.GetObject(getBucketName(), getS3KeyFromURI(uri))
+	if err != nil {
+		return nil, 0, nil, err
+	}
+	defer object.Close()
+
+	file, err := os.CreateTemp("", "extract-*")
+	if err != nil {
+		return nil, 0, nil, err
+	}
+	cleanup := func() {
+		file.Close()
+		os.Remove(file.Name())
+	}
+
+	size, err := io.Copy(file, object)
+	if err != nil {
+		cleanup()
+		return nil, 0, nil, err
+	}
+	return file, size, cleanup, nil
+}
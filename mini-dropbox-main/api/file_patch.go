@@ -0,0 +1,116 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/manishlpu/assignment/models"
+	"github.com/manishlpu/assignment/utils"
+)
+
+type patchFileRequest struct {
+	Filename    *string   `json:"filename"`
+	Description *string   `json:"description"`
+	FolderID    *int64    `json:"folder_id"`
+	Tags        *[]string `json:"tags"`
+}
+
+// Returns the entity tag of the metadata of the file. It is made of the
+// revision of the file, which every change to the file increments.
+func getMetadataETag(record *models.Metadata) string {
+	return fmt.Sprintf(`"%d-%d"`, record.ID, record.Revision)
+}
+
+// Reports whether the If-Match header of the request, if any, matches the
+// entity tag.
+func matchesIfMatch(r *http.Request, etag string) bool {
+	header := r.Header.Get("If-Match")
+	if header == "" {
+		return true
+	}
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+		if candidate == "*" || candidate == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// Checks the If-Match header of a request changing the file against its
+// current revision, writing the failure when it does not match. With
+// REQUIRE_IF_MATCH set, requests without the header are refused.
+func checkIfMatch(w http.ResponseWriter, r *http.Request, record *models.Metadata) bool {
+	if r.Header.Get("If-Match") == "" && utils.GetEnvValue("REQUIRE_IF_MATCH", "false") == "true" {
+		writeFailure(w, http.StatusPreconditionRequired, errors.New("If-Match header is required"))
+		return false
+	}
+	if !matchesIfMatch(r, getMetadataETag(record)) {
+		writeFailure(w, http.StatusPreconditionFailed, utils.ErrPreconditionFailed)
+		return false
+	}
+	return true
+}
+
+// Updates the filename, description, folder or tags of a file, leaving its
+// content as it is.
+func (ah *APIHandler) patchFile(w http.ResponseWriter, r *http.Request) {
+	utils.DebugLog("inside patchFile")
+
+	record := ah.getActiveRecord(w, r, models.ROLE_EDITOR)
+	if record == nil {
+		return
+	}
+	if !checkIfMatch(w, r, record) {
+		return
+	}
+	records := []models.Metadata{*record}
+	if err := ah.MetadataOps.LoadRecordLabels(records); err != nil {
+		writeFailure(w, http.StatusInternalServerError, err)
+		return
+	}
+	record = &records[0]
+
+	var req patchFileRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeFailure(w, http.StatusBadRequest, errors.New("invalid request body"))
+		return
+	}
+
+	patch := utils.FilePatch{
+		Description: req.Description,
+		FolderID:    req.FolderID,
+	}
+	if req.Filename != nil {
+		filename := strings.TrimSpace(*req.Filename)
+		if err := validateName(filename); err != nil {
+			writeFailure(w, http.StatusBadRequest, err)
+			return
+		}
+		mimeType := getMimeType(filename)
+		patch.Filename, patch.MimeType = &filename, &mimeType
+	}
+	if req.FolderID != nil && *req.FolderID < 0 {
+		writeFailure(w, http.StatusBadRequest, errors.New("invalid folder id"))
+		return
+	}
+	if req.Tags != nil {
+		tags, err := normalizeTags(*req.Tags)
+		if err != nil {
+			writeFailure(w, http.StatusBadRequest, err)
+			return
+		}
+		patch.Tags = &tags
+	}
+
+	if err := ah.MetadataOps.PatchRecord(record, patch); err != nil {
+		writeFailure(w, getErrorStatusCode(err), err)
+		return
+	}
+
+	w.Header().Set("ETag", getMetadataETag(record))
+	writeJSON(w, http.StatusOK, record)
+}
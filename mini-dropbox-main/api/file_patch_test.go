@@ -0,0 +1,43 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+)
+
+// Changes to the labels and retention of a file are refused once the file
+// moved past the revision given in If-Match.
+func TestLabelChangesCheckIfMatch(t *testing.T) {
+	ts := newTestServer(t)
+	token := ts.signup("ann")
+	id := ts.upload(token, "notes.txt", "some notes")
+	path := fmt.Sprintf("/api/files/%d", id)
+
+	etag := ts.expect(ts.do("GET", path, token, nil), http.StatusOK).Header().Get("ETag")
+	changes := []struct {
+		path string
+		body interface{}
+	}{
+		{path + "/tags", map[string]interface{}{"tags": []string{"work"}}},
+		{path + "/properties", map[string]interface{}{"properties": map[string]string{"client": "acme"}}},
+		{path + "/versions/retention", map[string]interface{}{"versions": 3}},
+	}
+	for _, change := range changes {
+		w := ts.expect(ts.do("PUT", change.path, token, change.body, "If-Match", etag), http.StatusOK)
+		next := w.Header().Get("ETag")
+		if next == "" || next == etag {
+			t.Fatalf("%s: expected a new ETag, got %q", change.path, next)
+		}
+
+		// The previous revision no longer matches, for any of the changes
+		for _, stale := range changes {
+			ts.expect(ts.do("PUT", stale.path, token, stale.body, "If-Match", etag), http.StatusPreconditionFailed)
+		}
+		etag = next
+	}
+
+	if current := ts.expect(ts.do("GET", path, token, nil), http.StatusOK).Header().Get("ETag"); current != etag {
+		t.Fatalf("expected ETag %s, got %s", etag, current)
+	}
+}
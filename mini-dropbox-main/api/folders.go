@@ -0,0 +1,187 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/manishlpu/assignment/models"
+	"github.com/manishlpu/assignment/utils"
+	"github.com/gorilla/mux"
+)
+
+type createFolderRequest struct {
+	Name     string `json:"name"`
+	ParentID int64  `json:"parent_id"`
+}
+
+// Fields left out of the request are kept as they are.
+type updateFolderRequest struct {
+	Name     *string `json:"name"`
+	ParentID *int64  `json:"parent_id"`
+}
+
+// Parses the unique identifier of the folder from the request path.
+func getFolderID(r *http.Request) (int64, error) {
+	folderID, err := strconv.ParseInt(mux.Vars(r)["folderID"], 10, 64)
+	if err != nil || folderID < 0 {
+		return 0, errors.New("invalid folder id")
+	}
+	return folderID, nil
+}
+
+// Creates a folder inside the parent folder, the root one by default.
+func (ah *APIHandler) createFolder(w http.ResponseWriter, r *http.Request) {
+	utils.DebugLog("inside createFolder")
+
+	var req createFolderRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeFailure(w, http.StatusBadRequest, errors.New("invalid request body"))
+		return
+	}
+	if err := validateName(req.Name); err != nil {
+		writeFailure(w, http.StatusBadRequest, err)
+		return
+	}
+
+	id, err := ah.MetadataOps.CreateFolder(models.Folder{
+		Name:     req.Name,
+		ParentID: req.ParentID,
+		OwnerID:  getRequestUser(r).ID,
+	})
+	if err != nil {
+		writeFailure(w, getErrorStatusCode(err), err)
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, map[string]interface{}{
+		"id": id,
+	})
+}
+
+// Lists the folders and files directly inside a folder, 0 being the root one.
+// Folders shared with the user are listed along with the content of their owner.
+func (ah *APIHandler) listFolderChildren(w http.ResponseWriter, r *http.Request) {
+	utils.DebugLog("inside listFolderChildren")
+
+	folderID, err := getFolderID(r)
+	if err != nil {
+		writeFailure(w, http.StatusBadRequest, err)
+		return
+	}
+	if folderID == models.ROOT_FOLDER_ID {
+		ah.writeFolderChildren(w, getRequestUser(r).ID, nil)
+		return
+	}
+
+	folder := ah.getActiveFolder(w, r, models.ROLE_VIEWER)
+	if folder == nil {
+		return
+	}
+	ah.writeFolderChildren(w, folder.OwnerID, folder)
+}
+
+// Writes the content of the folder, nil being the root folder of the owner.
+func (ah *APIHandler) writeFolderChildren(w http.ResponseWriter, ownerID int64, folder *models.Folder) {
+	children := models.FolderChildren{Folder: folder}
+	folderID := int64(models.ROOT_FOLDER_ID)
+	if folder != nil {
+		folderID = folder.ID
+	}
+
+	folders, files, err := ah.MetadataOps.FetchFolderChildren(ownerID, folderID)
+	if err != nil {
+		writeFailure(w, getErrorStatusCode(err), err)
+		return
+	}
+	children.Folders = folders
+	children.Files = files
+
+	writeJSON(w, http.StatusOK, children)
+}
+
+// Renames a folder and/or moves it under another folder.
+func (ah *APIHandler) updateFolder(w http.ResponseWriter, r *http.Request) {
+	utils.DebugLog("inside updateFolder")
+
+	folder := ah.getActiveFolder(w, r, models.ROLE_EDITOR)
+	if folder == nil {
+		return
+	}
+
+	var req updateFolderRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeFailure(w, http.StatusBadRequest, errors.New("invalid request body"))
+		return
+	}
+
+	if req.Name != nil {
+		if err := validateName(*req.Name); err != nil {
+			writeFailure(w, http.StatusBadRequest, err)
+			return
+		}
+		folder.Name = *req.Name
+	}
+	if req.ParentID != nil {
+		folder.ParentID = *req.ParentID
+	}
+
+	if err := ah.MetadataOps.UpdateFolder(folder.OwnerID, folder.ID, folder.Name, folder.ParentID); err != nil {
+		writeFailure(w, getErrorStatusCode(err), err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(getSuccessMessage())
+}
+
+// Soft deletes a folder. Folders with content are only deleted along with it
+// when the recursive query parameter is true.
+func (ah *APIHandler) deleteFolder(w http.ResponseWriter, r *http.Request) {
+	utils.DebugLog("inside deleteFolder")
+
+	folder := ah.getActiveFolder(w, r, models.ROLE_OWNER)
+	if folder == nil {
+		return
+	}
+
+	recursive, _ := strconv.ParseBool(r.URL.Query().Get("recursive"))
+	if err := ah.MetadataOps.DeleteFolder(folder.OwnerID, folder.ID, recursive); err != nil {
+		writeFailure(w, getErrorStatusCode(err), err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(getSuccessMessage())
+}
+
+// Resolves a path from the root folder, returning the metadata of a file or
+// the content of a folder.
+func (ah *APIHandler) resolvePath(w http.ResponseWriter, r *http.Request) {
+	utils.DebugLog("inside resolvePath")
+
+	var segments []string
+	for _, segment := range strings.Split(mux.Vars(r)["path"], "/") {
+		if segment != "" {
+			segments = append(segments, segment)
+		}
+	}
+
+	ownerID := getRequestUser(r).ID
+	folder, file, err := ah.MetadataOps.ResolvePath(ownerID, segments)
+	if err != nil {
+		writeFailure(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	switch {
+	case file != nil:
+		writeJSON(w, http.StatusOK, file)
+	case folder != nil:
+		ah.writeFolderChildren(w, ownerID, folder)
+	default:
+		writeFailure(w, http.StatusNotFound, errors.New("no file or folder exists at given path"))
+	}
+}
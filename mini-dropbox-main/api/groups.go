@@ -0,0 +1,275 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/manishlpu/assignment/models"
+	"github.com/manishlpu/assignment/utils"
+	"github.com/gorilla/mux"
+)
+
+type createGroupRequest struct {
+	Name string `json:"name"`
+}
+
+type addGroupMemberRequest struct {
+	Username string `json:"username"`
+}
+
+// Parses the unique identifier of the group from the request path.
+func getGroupID(r *http.Request) (int64, error) {
+	groupID, err := strconv.ParseInt(mux.Vars(r)["groupID"], 10, 64)
+	if err != nil {
+		return 0, errors.New("invalid group id")
+	}
+	return groupID, nil
+}
+
+// Fetches the group of the request path, writing the failure response when
+// the user is not a member of it, or not its owner when ownerOnly is set.
+func (ah *APIHandler) getMemberGroup(w http.ResponseWriter, r *http.Request, ownerOnly bool) *models.Group {
+	groupID, err := getGroupID(r)
+	if err != nil {
+		writeFailure(w, http.StatusBadRequest, err)
+		return nil
+	}
+
+	userID := getRequestUser(r).ID
+	group, err := ah.MetadataOps.GetGroup(groupID)
+	if err != nil {
+		writeFailure(w, http.StatusInternalServerError, err)
+		return nil
+	}
+	member := false
+	if group != nil {
+		if member, err = ah.MetadataOps.IsGroupMember(group.ID, userID); err != nil {
+			writeFailure(w, http.StatusInternalServerError, err)
+			return nil
+		}
+	}
+	if !member {
+		writeFailure(w, http.StatusNotFound, utils.ErrGroupNotFound)
+		return nil
+	}
+	if ownerOnly && group.OwnerID != userID {
+		writeFailure(w, http.StatusForbidden, errors.New("only the owner of the group can manage it"))
+		return nil
+	}
+	return group
+}
+
+// Creates a group owned by the user, who is its first member.
+func (ah *APIHandler) createGroup(w http.ResponseWriter, r *http.Request) {
+	utils.DebugLog("inside createGroup")
+
+	var req createGroupRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeFailure(w, http.StatusBadRequest, errors.New("invalid request body"))
+		return
+	}
+	name := strings.ToLower(strings.TrimSpace(req.Name))
+	if !usernamePattern.MatchString(name) {
+		writeFailure(w, http.StatusBadRequest, errors.New("group name must be 3 to 64 letters, digits, dots, dashes or underscores"))
+		return
+	}
+
+	id, err := ah.MetadataOps.CreateGroup(models.Group{
+		Name:    name,
+		OwnerID: getRequestUser(r).ID,
+	})
+	if errors.Is(err, utils.ErrGroupNameTaken) {
+		writeFailure(w, http.StatusConflict, err)
+		return
+	} else if err != nil {
+		utils.ErrorLog("Error creating group: ", err)
+		writeFailure(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, map[string]interface{}{
+		"id": id,
+	})
+}
+
+// Lists the groups the user is a member of.
+func (ah *APIHandler) listGroups(w http.ResponseWriter, r *http.Request) {
+	utils.DebugLog("inside listGroups")
+
+	groups, err := ah.MetadataOps.FetchUserGroups(getRequestUser(r).ID)
+	if err != nil {
+		writeFailure(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, groups)
+}
+
+// Deletes a group, revoking the roles granted to it.
+func (ah *APIHandler) deleteGroup(w http.ResponseWriter, r *http.Request) {
+	utils.DebugLog("inside deleteGroup")
+
+	group := ah.getMemberGroup(w, r, true)
+	if group == nil {
+		return
+	}
+
+	err := ah.MetadataOps.DeleteGroup(group.ID)
+	if errors.Is(err, utils.ErrGroupNotFound) {
+		writeFailure(w, http.StatusNotFound, err)
+		return
+	} else if err != nil {
+		writeFailure(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(getSuccessMessage())
+}
+
+// Lists the members of a group the user is a member of.
+func (ah *APIHandler) listGroupMembers(w http.ResponseWriter, r *http.Request) {
+	utils.DebugLog("inside listGroupMembers")
+
+	group := ah.getMemberGroup(w, r, false)
+	if group == nil {
+		return
+	}
+
+	members, err := ah.MetadataOps.FetchGroupMembers(group.ID)
+	if err != nil {
+		writeFailure(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, members)
+}
+
+// Invites a user to a group, who becomes a member once accepting.
+func (ah *APIHandler) addGroupMember(w http.ResponseWriter, r *http.Request) {
+	utils.DebugLog("inside addGroupMember")
+
+	group := ah.getMemberGroup(w, r, true)
+	if group == nil {
+		return
+	}
+
+	var req addGroupMemberRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeFailure(w, http.StatusBadRequest, errors.New("invalid request body"))
+		return
+	}
+
+	user, err := ah.MetadataOps.GetUserByUsername(strings.ToLower(strings.TrimSpace(req.Username)))
+	if err != nil {
+		writeFailure(w, http.StatusInternalServerError, err)
+		return
+	}
+	if user == nil {
+		writeFailure(w, http.StatusNotFound, errors.New("no user exists with given username"))
+		return
+	}
+
+	if err := ah.MetadataOps.InviteGroupMember(group.ID, user.ID); err != nil {
+		writeFailure(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(getSuccessMessage())
+}
+
+// Lists the groups the user is invited to.
+func (ah *APIHandler) listGroupInvitations(w http.ResponseWriter, r *http.Request) {
+	utils.DebugLog("inside listGroupInvitations")
+
+	groups, err := ah.MetadataOps.FetchGroupInvitations(getRequestUser(r).ID)
+	if err != nil {
+		writeFailure(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, groups)
+}
+
+// Accepts the invitation of the user to a group, making them a member.
+func (ah *APIHandler) acceptGroupInvitation(w http.ResponseWriter, r *http.Request) {
+	utils.DebugLog("inside acceptGroupInvitation")
+
+	groupID, err := getGroupID(r)
+	if err != nil {
+		writeFailure(w, http.StatusBadRequest, err)
+		return
+	}
+
+	err = ah.MetadataOps.AcceptGroupInvitation(groupID, getRequestUser(r).ID)
+	if errors.Is(err, utils.ErrInvitationNotFound) {
+		writeFailure(w, http.StatusNotFound, err)
+		return
+	} else if err != nil {
+		writeFailure(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(getSuccessMessage())
+}
+
+// Declines the invitation of the user to a group.
+func (ah *APIHandler) declineGroupInvitation(w http.ResponseWriter, r *http.Request) {
+	utils.DebugLog("inside declineGroupInvitation")
+
+	groupID, err := getGroupID(r)
+	if err != nil {
+		writeFailure(w, http.StatusBadRequest, err)
+		return
+	}
+
+	err = ah.MetadataOps.DeclineGroupInvitation(groupID, getRequestUser(r).ID)
+	if errors.Is(err, utils.ErrInvitationNotFound) {
+		writeFailure(w, http.StatusNotFound, err)
+		return
+	} else if err != nil {
+		writeFailure(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(getSuccessMessage())
+}
+
+// Removes a user from a group, or withdraws their invitation. The owner
+// removes anyone but themselves, other members only leave the group.
+func (ah *APIHandler) removeGroupMember(w http.ResponseWriter, r *http.Request) {
+	utils.DebugLog("inside removeGroupMember")
+
+	group := ah.getMemberGroup(w, r, false)
+	if group == nil {
+		return
+	}
+
+	userID, err := strconv.ParseInt(mux.Vars(r)["userID"], 10, 64)
+	if err != nil {
+		writeFailure(w, http.StatusBadRequest, errors.New("invalid user id"))
+		return
+	}
+	if userID == group.OwnerID {
+		writeFailure(w, http.StatusBadRequest, errors.New("the owner cannot leave the group, delete it instead"))
+		return
+	}
+	if requester := getRequestUser(r).ID; requester != group.OwnerID && requester != userID {
+		writeFailure(w, http.StatusForbidden, errors.New("only the owner of the group can manage it"))
+		return
+	}
+
+	if err := ah.MetadataOps.RemoveGroupMember(group.ID, userID); err != nil {
+		writeFailure(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(getSuccessMessage())
+}
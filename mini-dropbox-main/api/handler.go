@@ -1,8 +1,11 @@
 package api
 
 import (
+	"errors"
+	"fmt"
 	"net/http"
 
+	"github.com/manishlpu/assignment/models"
 	"github.com/manishlpu/assignment/utils"
 	"github.com/gorilla/mux"
 )
@@ -13,12 +16,12 @@ type APIHandler struct {
 }
 
 func NewAPIHandler() *APIHandler {
-	persistenceDB, err := utils.NewPersistenceDBLayer()
+	persistenceDB, err := utils.NewMetadataStore()
 	if err != nil {
 		panic(err)
 	}
 
-	s3Client, err := utils.NewS3Client()
+	s3Client, err := utils.NewBlobStore()
 	if err != nil {
 		panic(err)
 	}
@@ -29,12 +32,93 @@ func NewAPIHandler() *APIHandler {
 	}
 }
 
-func dropboxHandler(r *mux.Router) {
-	dh := NewAPIHandler()
+// Fetches the active file of the request path, writing the failure response
+// when there is none or the user is not granted the role on it.
+func (ah *APIHandler) getActiveRecord(w http.ResponseWriter, r *http.Request, role string) *models.Metadata {
+	fileID, err := getFileID(r)
+	if err != nil {
+		writeFailure(w, http.StatusBadRequest, err)
+		return nil
+	}
+
+	record, granted, err := ah.MetadataOps.GetFileAccess(getRequestUser(r).ID, fileID)
+	if err != nil {
+		writeFailure(w, http.StatusInternalServerError, err)
+		return nil
+	}
+	if record == nil || granted == "" {
+		writeFailure(w, http.StatusNotFound, errors.New("no file exists with given id"))
+		return nil
+	}
+	if !models.RoleAllows(granted, role) {
+		writeFailure(w, http.StatusForbidden, fmt.Errorf("%s role is required on the file", role))
+		return nil
+	}
+	return record
+}
+
+// Fetches the active folder of the request path, writing the failure response
+// when there is none or the user is not granted the role on it.
+func (ah *APIHandler) getActiveFolder(w http.ResponseWriter, r *http.Request, role string) *models.Folder {
+	folderID, err := getFolderID(r)
+	if err != nil || folderID == models.ROOT_FOLDER_ID {
+		writeFailure(w, http.StatusBadRequest, errors.New("invalid folder id"))
+		return nil
+	}
+
+	folder, granted, err := ah.MetadataOps.GetFolderAccess(getRequestUser(r).ID, folderID)
+	if err != nil {
+		writeFailure(w, http.StatusInternalServerError, err)
+		return nil
+	}
+	if folder == nil || granted == "" {
+		writeFailure(w, http.StatusNotFound, utils.ErrFolderNotFound)
+		return nil
+	}
+	if !models.RoleAllows(granted, role) {
+		writeFailure(w, http.StatusForbidden, fmt.Errorf("%s role is required on the folder", role))
+		return nil
+	}
+	return folder
+}
+
+func dropboxHandler(r *mux.Router, dh *APIHandler) {
+	r.Use(dh.authMiddleware)
+
+	r.HandleFunc("/auth/signup", dh.signup).Methods("POST").Name("signup")
+	r.HandleFunc("/auth/login", dh.login).Methods("POST").Name("login")
+	r.HandleFunc("/auth/logout", dh.logout).Methods("POST")
+	r.HandleFunc("/auth/me", dh.getCurrentUser).Methods("GET")
 
 	r.HandleFunc("/files/upload", dh.uploadFile).Methods("POST")
+	r.HandleFunc("/files/upload/{filename}", dh.uploadFile).Methods("PUT")
+	r.HandleFunc("/files/presign/upload", dh.presignUpload).Methods("POST")
+	r.HandleFunc("/files/presign/complete", dh.completePresignedUpload).Methods("POST")
+	r.HandleFunc("/files/{fileID}/presign", dh.presignDownload).Methods("GET")
+	r.HandleFunc("/uploads", dh.createUpload).Methods("POST")
+	r.HandleFunc("/uploads/{uploadID}", dh.getUploadOffset).Methods("HEAD")
+	r.HandleFunc("/uploads/{uploadID}", dh.uploadChunk).Methods("PATCH")
+	r.HandleFunc("/uploads/{uploadID}", dh.abortUpload).Methods("DELETE")
+	r.HandleFunc("/uploads/{uploadID}/finalize", dh.finalizeUpload).Methods("POST")
+	r.HandleFunc("/presigned/{token}", dh.servePresigned).Methods("GET", "HEAD", "PUT").Name("presigned")
+	r.HandleFunc("/files/shared", dh.listSharedWithMe).Methods("GET")
 	r.HandleFunc("/files/{fileID}", dh.getFile).Methods("GET")
+	r.HandleFunc("/files/{fileID}/content", dh.downloadFile).Methods("GET", "HEAD")
+	r.HandleFunc("/files/{fileID}/tags", dh.setFileTags).Methods("PUT")
+	r.HandleFunc("/files/{fileID}/properties", dh.setFileProperties).Methods("PUT")
+	r.HandleFunc("/files/{fileID}/versions", dh.listVersions).Methods("GET")
+	r.HandleFunc("/files/{fileID}/versions/retention", dh.setVersionRetention).Methods("PUT")
+	r.HandleFunc("/files/{fileID}/versions/{version}/content", dh.downloadVersion).Methods("GET", "HEAD")
+	r.HandleFunc("/files/{fileID}/versions/{version}/restore", dh.restoreVersion).Methods("POST")
+	r.HandleFunc("/files/{fileID}/links", dh.createShareLink).Methods("POST")
+	r.HandleFunc("/files/{fileID}/links", dh.listShareLinks).Methods("GET")
+	r.HandleFunc("/files/{fileID}/links/{linkID}", dh.revokeShareLink).Methods("DELETE")
+	r.HandleFunc("/files/{fileID}/links/{linkID}/accesses", dh.listShareLinkAccesses).Methods("GET")
+	r.HandleFunc("/files/{fileID}/permissions", dh.grantFilePermission).Methods("POST")
+	r.HandleFunc("/files/{fileID}/permissions", dh.listFilePermissions).Methods("GET")
+	r.HandleFunc("/files/{fileID}/permissions/{permissionID}", dh.revokeFilePermission).Methods("DELETE")
 	r.HandleFunc("/files/{fileID}", dh.updateFile).Methods("PUT")
+	r.HandleFunc("/files/{fileID}", dh.patchFile).Methods("PATCH")
 	r.HandleFunc("/files/{fileID}", dh.deleteFile).Methods("DELETE")
 	r.HandleFunc("/files/{fileID}", func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Access-Control-Allow-Origin", "*")
@@ -42,5 +126,32 @@ func dropboxHandler(r *mux.Router) {
 		w.Header().Set("Access-Control-Allow-Methods", "POST, GET, OPTIONS, PUT, DELETE")
 	}).Methods("OPTIONS")
 	r.HandleFunc("/files", dh.listFiles).Methods("GET")
+	r.HandleFunc("/search", dh.searchFiles).Methods("GET")
+	r.HandleFunc("/tags", dh.listTags).Methods("GET")
+	r.HandleFunc("/usage", dh.getUsage).Methods("GET")
+
+	r.HandleFunc("/folders", dh.createFolder).Methods("POST")
+	r.HandleFunc("/folders/{folderID}/children", dh.listFolderChildren).Methods("GET")
+	r.HandleFunc("/folders/{folderID}", dh.updateFolder).Methods("PATCH")
+	r.HandleFunc("/folders/{folderID}", dh.deleteFolder).Methods("DELETE")
+	r.HandleFunc("/folders/{folderID}/permissions", dh.grantFolderPermission).Methods("POST")
+	r.HandleFunc("/folders/{folderID}/permissions", dh.listFolderPermissions).Methods("GET")
+	r.HandleFunc("/folders/{folderID}/permissions/{permissionID}", dh.revokeFolderPermission).Methods("DELETE")
+	r.HandleFunc("/paths/{path:.*}", dh.resolvePath).Methods("GET")
+
+	r.HandleFunc("/trash", dh.listTrash).Methods("GET")
+	r.HandleFunc("/trash", dh.emptyTrash).Methods("DELETE")
+	r.HandleFunc("/trash/{fileID}/restore", dh.restoreTrashedFile).Methods("POST")
+	r.HandleFunc("/trash/{fileID}", dh.purgeTrashedFile).Methods("DELETE")
+
+	r.HandleFunc("/groups", dh.createGroup).Methods("POST")
+	r.HandleFunc("/groups", dh.listGroups).Methods("GET")
+	r.HandleFunc("/groups/invitations", dh.listGroupInvitations).Methods("GET")
+	r.HandleFunc("/groups/invitations/{groupID}", dh.acceptGroupInvitation).Methods("POST")
+	r.HandleFunc("/groups/invitations/{groupID}", dh.declineGroupInvitation).Methods("DELETE")
+	r.HandleFunc("/groups/{groupID}", dh.deleteGroup).Methods("DELETE")
+	r.HandleFunc("/groups/{groupID}/members", dh.listGroupMembers).Methods("GET")
+	r.HandleFunc("/groups/{groupID}/members", dh.addGroupMember).Methods("POST")
+	r.HandleFunc("/groups/{groupID}/members/{userID}", dh.removeGroupMember).Methods("DELETE")
 
 }
@@ -0,0 +1,143 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/manishlpu/assignment/utils"
+)
+
+// Logs are written under storage/logs of the working directory, the tests run
+// from a temporary one. It is left in place, handlers logging from goroutines
+// which may outlive the tests.
+func TestMain(m *testing.M) {
+	dir, err := os.MkdirTemp("", "api")
+	if err != nil {
+		panic(err)
+	}
+	if err := os.MkdirAll(filepath.Join(dir, "storage", "logs"), 0755); err != nil {
+		panic(err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		panic(err)
+	}
+
+	os.Exit(m.Run())
+}
+
+// testServer serves the api from an SQLite metadata store and a local blob
+// store in a temporary directory.
+type testServer struct {
+	t      *testing.T
+	ah     *APIHandler
+	router http.Handler
+}
+
+func newTestServer(t *testing.T) *testServer {
+	t.Helper()
+	dir := t.TempDir()
+
+	store, err := utils.NewSQLiteDBLayer(filepath.Join(dir, "metadata.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	blobs, err := utils.NewLocalBlobStore(filepath.Join(dir, "blobs"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ah := &APIHandler{store, blobs}
+	router, err := New(ah)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &testServer{t: t, ah: ah, router: router}
+}
+
+// Builds a request with the given token and headers, the body being
+// marshalled to JSON unless it is a reader already.
+func (ts *testServer) request(method, path, token string, body interface{}, headers ...string) *http.Request {
+	ts.t.Helper()
+	var reader io.Reader
+	switch b := body.(type) {
+	case nil:
+	case io.Reader:
+		reader = b
+	default:
+		encoded, err := json.Marshal(b)
+		if err != nil {
+			ts.t.Fatal(err)
+		}
+		reader = bytes.NewReader(encoded)
+	}
+
+	r := httptest.NewRequest(method, path, reader)
+	if token != "" {
+		r.Header.Set("Authorization", "Bearer "+token)
+	}
+	for i := 0; i+1 < len(headers); i += 2 {
+		r.Header.Set(headers[i], headers[i+1])
+	}
+	return r
+}
+
+func (ts *testServer) serve(r *http.Request) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	ts.router.ServeHTTP(w, r)
+	return w
+}
+
+func (ts *testServer) do(method, path, token string, body interface{}, headers ...string) *httptest.ResponseRecorder {
+	ts.t.Helper()
+	return ts.serve(ts.request(method, path, token, body, headers...))
+}
+
+// Signs up the user, returning the token of its session.
+func (ts *testServer) signup(username string) string {
+	ts.t.Helper()
+	credentials := map[string]string{"username": username, "password": "password123"}
+	if w := ts.do("POST", "/api/auth/signup", "", credentials); w.Code != http.StatusCreated && w.Code != http.StatusOK {
+		ts.t.Fatalf("signing up %s: %d %s", username, w.Code, w.Body)
+	}
+
+	var resp struct {
+		Token string `json:"token"`
+	}
+	ts.decode(ts.expect(ts.do("POST", "/api/auth/login", "", credentials), http.StatusOK), &resp)
+	return resp.Token
+}
+
+// Uploads a file with the raw body, returning its id.
+func (ts *testServer) upload(token, filename, content string) int64 {
+	ts.t.Helper()
+	w := ts.expect(ts.do("PUT", "/api/files/upload/"+filename, token, strings.NewReader(content)), http.StatusOK)
+
+	var resp struct {
+		ID int64 `json:"id"`
+	}
+	ts.decode(w, &resp)
+	return resp.ID
+}
+
+// Fails the test unless the response has the given status code.
+func (ts *testServer) expect(w *httptest.ResponseRecorder, code int) *httptest.ResponseRecorder {
+	ts.t.Helper()
+	if w.Code != code {
+		ts.t.Fatalf("expected status %d, got %d: %s", code, w.Code, w.Body)
+	}
+	return w
+}
+
+func (ts *testServer) decode(w *httptest.ResponseRecorder, v interface{}) {
+	ts.t.Helper()
+	if err := json.Unmarshal(w.Body.Bytes(), v); err != nil {
+		ts.t.Fatalf("decoding %s: %v", w.Body, err)
+	}
+}
@@ -0,0 +1,77 @@
+package api
+
+import (
+	"github.com/manishlpu/assignment/models"
+	"github.com/manishlpu/assignment/utils"
+)
+
+// Number of files whose content is extracted at the same time, extraction
+// being heavy on memory for large documents.
+var indexSlots = make(chan struct{}, 2)
+
+// Number of unindexed files fetched at once by IndexContents.
+var indexBatchSize = 100
+
+// Indexes the content of the file once uploaded, unless it was replaced or
+// deleted meanwhile. Files left unindexed are caught up by IndexContents.
+func (ah *APIHandler) indexFile(ownerID, fileID int64) {
+	record, err := ah.MetadataOps.GetRecord(ownerID, fileID)
+	if err != nil {
+		utils.ErrorLog("error fetching file to index: ", fileID, err)
+		return
+	}
+	if record == nil {
+		return
+	}
+	if err := ah.indexRecord(record); err != nil {
+		utils.ErrorLog("error indexing file: ", fileID, err)
+	}
+}
+
+// Extracts the text of the content of the file and records it in the search
+// index. Files of types without text, or whose content cannot be parsed, are
+// recorded without text so that they are not extracted again.
+func (ah *APIHandler) indexRecord(record *models.Metadata) error {
+	indexSlots <- struct{}{}
+	defer func() { <-indexSlots }()
+
+	var text string
+	extract := getTextExtractor(record.Filename, record.MimeType)
+	if extract != nil && record.SizeInBytes <= maxExtractedFileSize {
+		// Failing to fetch the object is retried, unlike failing to parse it
+		file, size, cleanup, err := ah.downloadObject(record.S3ObjectKey)
+		if err != nil {
+			return err
+		}
+		defer cleanup()
+
+		text, err = extract(file, size)
+		if err != nil {
+			utils.WarnLog("unable to extract the text of file: ", record.ID, err)
+		}
+	}
+	return ah.MetadataOps.SaveRecordContent(record.ID, record.ContentHash, text)
+}
+
+// Indexes the content of the files uploaded without being indexed, such as
+// when the server stopped meanwhile. Files are tried once per run, those
+// failing being left to the next run without holding back the ones after them.
+func (ah *APIHandler) IndexContents() error {
+	var afterID int64
+	for {
+		records, err := ah.MetadataOps.FetchUnindexedRecords(afterID, indexBatchSize)
+		if err != nil {
+			return err
+		}
+		if len(records) == 0 {
+			return nil
+		}
+
+		for i := range records {
+			afterID = records[i].ID
+			if err := ah.indexRecord(&records[i]); err != nil {
+				utils.ErrorLog("unable to index file: ", records[i].ID, err)
+			}
+		}
+	}
+}
@@ -0,0 +1,49 @@
+package api
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/manishlpu/assignment/models"
+)
+
+// Files failing to be indexed do not hold back the ones queued after them.
+func TestIndexContentsMovesPastFailures(t *testing.T) {
+	ts := newTestServer(t)
+	indexBatchSize = 1
+	t.Cleanup(func() { indexBatchSize = 100 })
+
+	var ids []int64
+	for _, filename := range []string{"missing.txt", "present.txt"} {
+		key := newBlobObjectKey(filename)
+		if filename == "present.txt" {
+			if err := ts.ah.S3Ops.UploadObject(getBucketName(), key, strings.NewReader("some text")); err != nil {
+				t.Fatal(err)
+			}
+		}
+		id, err := ts.ah.MetadataOps.SaveRecord(models.Metadata{
+			Filename:    filename,
+			SizeInBytes: 9,
+			S3ObjectKey: getObjectURI(key),
+			MimeType:    "text/plain",
+			ContentHash: filename,
+			OwnerID:     1,
+			Status:      models.STATUS_ACTIVE,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, id)
+	}
+
+	if err := ts.ah.IndexContents(); err != nil {
+		t.Fatal(err)
+	}
+	unindexed, err := ts.ah.MetadataOps.FetchUnindexedRecords(0, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(unindexed) != 1 || unindexed[0].ID != ids[0] {
+		t.Errorf("expected only the file missing its object to be left unindexed, got %+v", unindexed)
+	}
+}
@@ -0,0 +1,114 @@
+package api
+
+import (
+	"bytes"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"hash"
+	"net/http"
+	"strings"
+
+	"github.com/manishlpu/assignment/models"
+)
+
+// Headers through which clients send the SHA-256 of the content they upload.
+// Content-Digest follows RFC 9530, X-Checksum-SHA256 holds the hex or base64
+// encoded digest as S3 does.
+const (
+	contentDigestHeader  = "Content-Digest"
+	checksumSHA256Header = "X-Checksum-SHA256"
+)
+
+var errDigestMismatch = errors.New("content does not match the digest sent by the client")
+
+// contentHasher computes the digests recorded for the content of a file while
+// it is written to.
+type contentHasher struct {
+	sha256 hash.Hash
+	md5    hash.Hash
+}
+
+func newContentHasher() *contentHasher {
+	return &contentHasher{
+		sha256: sha256.New(),
+		md5:    md5.New(),
+	}
+}
+
+func (h *contentHasher) Write(p []byte) (int, error) {
+	h.sha256.Write(p)
+	h.md5.Write(p)
+	return len(p), nil
+}
+
+// Returns the hex encoded SHA-256 of the content written so far.
+func (h *contentHasher) SHA256() string {
+	return hex.EncodeToString(h.sha256.Sum(nil))
+}
+
+// Returns the hex encoded MD5 of the content written so far, which is the
+// ETag S3 gives to objects uploaded in a single part.
+func (h *contentHasher) MD5() string {
+	return hex.EncodeToString(h.md5.Sum(nil))
+}
+
+// Returns the SHA-256 the client expects the uploaded content to have, nil
+// when the request carries none.
+func getExpectedDigest(r *http.Request) ([]byte, error) {
+	if value := r.Header.Get(contentDigestHeader); value != "" {
+		// Dictionary of algorithms to byte sequences: sha-256=:<base64>:
+		for _, member := range strings.Split(value, ",") {
+			algorithm, digest, ok := strings.Cut(strings.TrimSpace(member), "=")
+			if !ok || !strings.EqualFold(algorithm, "sha-256") {
+				continue
+			}
+			if len(digest) < 2 || digest[0] != ':' || digest[len(digest)-1] != ':' {
+				return nil, errors.New("invalid Content-Digest header")
+			}
+			sum, err := base64.StdEncoding.DecodeString(digest[1 : len(digest)-1])
+			if err != nil || len(sum) != sha256.Size {
+				return nil, errors.New("invalid Content-Digest header")
+			}
+			return sum, nil
+		}
+	}
+
+	if value := strings.TrimSpace(r.Header.Get(checksumSHA256Header)); value != "" {
+		sum, err := hex.DecodeString(value)
+		if err != nil {
+			sum, err = base64.StdEncoding.DecodeString(value)
+		}
+		if err != nil || len(sum) != sha256.Size {
+			return nil, errors.New("invalid X-Checksum-SHA256 header")
+		}
+		return sum, nil
+	}
+	return nil, nil
+}
+
+// Checks the hex encoded SHA-256 of the uploaded content against the one the
+// client sent, if any.
+func verifyDigest(expected []byte, contentHash string) error {
+	if expected == nil {
+		return nil
+	}
+	sum, err := hex.DecodeString(contentHash)
+	if err != nil || !bytes.Equal(sum, expected) {
+		return errDigestMismatch
+	}
+	return nil
+}
+
+// Sets the headers through which clients verify the downloaded content.
+func setDigestHeaders(w http.ResponseWriter, record *models.Metadata) {
+	sum, err := hex.DecodeString(record.ContentHash)
+	if err != nil || len(sum) != sha256.Size {
+		return
+	}
+	encoded := base64.StdEncoding.EncodeToString(sum)
+	w.Header().Set("Repr-Digest", "sha-256=:"+encoded+":")
+	w.Header().Set(checksumSHA256Header, encoded)
+}
@@ -0,0 +1,148 @@
+package api
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/manishlpu/assignment/utils"
+)
+
+const (
+	defaultListLimit = 100
+	maxListLimit     = 1000
+
+	// Header through which the cursor of the next page is returned
+	nextCursorHeader = "X-Next-Cursor"
+)
+
+// Reads the page, sort and filters of a file listing from the query string.
+func getFileListOptions(r *http.Request) (utils.FileListOptions, error) {
+	query := r.URL.Query()
+	opts := utils.FileListOptions{
+		Sort:     "created_at",
+		MimeType: query.Get("mime_type"),
+		Limit:    defaultListLimit,
+	}
+
+	if sort := query.Get("sort"); sort != "" {
+		if _, ok := utils.FileSortColumns[sort]; !ok {
+			return opts, errors.New("sort must be one of name, size, created_at or updated_at")
+		}
+		opts.Sort = sort
+	}
+	switch query.Get("order") {
+	case "", "asc":
+	case "desc":
+		opts.Descending = true
+	default:
+		return opts, errors.New("order must be asc or desc")
+	}
+
+	if value := query.Get("limit"); value != "" {
+		limit, err := strconv.Atoi(value)
+		if err != nil || limit <= 0 || limit > maxListLimit {
+			return opts, errors.New("limit must be between 1 and " + strconv.Itoa(maxListLimit))
+		}
+		opts.Limit = limit
+	}
+
+	for _, filter := range []struct {
+		param string
+		size  *int64
+	}{
+		{"min_size", &opts.MinSize},
+		{"max_size", &opts.MaxSize},
+	} {
+		if value := query.Get(filter.param); value != "" {
+			size, err := strconv.ParseInt(value, 10, 64)
+			if err != nil || size < 0 {
+				return opts, errors.New("invalid " + filter.param)
+			}
+			*filter.size = size
+		}
+	}
+
+	for _, filter := range []struct {
+		param string
+		t     *time.Time
+	}{
+		{"created_after", &opts.CreatedAfter},
+		{"created_before", &opts.CreatedBefore},
+		{"updated_after", &opts.UpdatedAfter},
+		{"updated_before", &opts.UpdatedBefore},
+	} {
+		if value := query.Get(filter.param); value != "" {
+			t, err := time.Parse(time.RFC3339, value)
+			if err != nil {
+				return opts, errors.New("invalid " + filter.param + ", expecting an RFC 3339 time")
+			}
+			*filter.t = t
+		}
+	}
+
+	if len(query["tag"]) > 0 {
+		tags, err := normalizeTags(query["tag"])
+		if err != nil {
+			return opts, err
+		}
+		opts.Tags = tags
+	}
+	for _, value := range query["property"] {
+		name, propertyValue, ok := strings.Cut(value, ":")
+		if !ok || !propertyPattern.MatchString(name) {
+			return opts, errors.New("property filters must be of the form name:value")
+		}
+		if opts.Properties == nil {
+			opts.Properties = map[string]string{}
+		}
+		opts.Properties[name] = propertyValue
+	}
+
+	if value := query.Get("cursor"); value != "" {
+		cursor, err := decodeFileCursor(value)
+		if err != nil {
+			return opts, err
+		}
+		if cursor.Sort != opts.Sort || cursor.Descending != opts.Descending {
+			return opts, errors.New("cursor belongs to a listing with another sort")
+		}
+		opts.After = cursor
+	}
+	return opts, nil
+}
+
+// Cursors are handed to clients as opaque strings.
+func encodeFileCursor(cursor *utils.FileCursor) string {
+	data, _ := json.Marshal(cursor)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func decodeFileCursor(value string) (*utils.FileCursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return nil, errors.New("invalid cursor")
+	}
+	var cursor utils.FileCursor
+	if err := json.Unmarshal(data, &cursor); err != nil {
+		return nil, errors.New("invalid cursor")
+	}
+	return &cursor, nil
+}
+
+// Points clients to the next page of the listing, through the X-Next-Cursor
+// header and a Link header with the URL of the page.
+func setNextPage(w http.ResponseWriter, r *http.Request, cursor *utils.FileCursor) {
+	value := encodeFileCursor(cursor)
+	w.Header().Set(nextCursorHeader, value)
+
+	query := r.URL.Query()
+	query.Set("cursor", value)
+	next := url.URL{Path: r.URL.Path, RawQuery: query.Encode()}
+	w.Header().Set("Link", "<"+getBaseURL(r)+next.String()+">; rel=\"next\"")
+}
@@ -0,0 +1,226 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/manishlpu/assignment/models"
+	"github.com/manishlpu/assignment/utils"
+	"github.com/gorilla/mux"
+)
+
+// Either the username or the group name of the grantee is given.
+type grantPermissionRequest struct {
+	Username string `json:"username"`
+	Group    string `json:"group"`
+	Role     string `json:"role"`
+}
+
+// Parses the unique identifier of the permission from the request path.
+func getPermissionID(r *http.Request) (int64, error) {
+	permissionID, err := strconv.ParseInt(mux.Vars(r)["permissionID"], 10, 64)
+	if err != nil {
+		return 0, errors.New("invalid permission id")
+	}
+	return permissionID, nil
+}
+
+// Decodes the grant of the request body into a permission on the resource of
+// the owner, writing the failure response when it is invalid.
+func (ah *APIHandler) decodePermission(w http.ResponseWriter, r *http.Request, resourceType string, resourceID, ownerID int64) *models.Permission {
+	var req grantPermissionRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeFailure(w, http.StatusBadRequest, errors.New("invalid request body"))
+		return nil
+	}
+	if !models.IsValidRole(req.Role) {
+		writeFailure(w, http.StatusBadRequest, errors.New("role must be one of viewer, editor or owner"))
+		return nil
+	}
+
+	permission := &models.Permission{
+		ResourceType: resourceType,
+		ResourceID:   resourceID,
+		Role:         req.Role,
+		GrantedBy:    getRequestUser(r).ID,
+	}
+	username := strings.ToLower(strings.TrimSpace(req.Username))
+	groupName := strings.ToLower(strings.TrimSpace(req.Group))
+	switch {
+	case username != "" && groupName == "":
+		user, err := ah.MetadataOps.GetUserByUsername(username)
+		if err != nil {
+			writeFailure(w, http.StatusInternalServerError, err)
+			return nil
+		}
+		if user == nil {
+			writeFailure(w, http.StatusNotFound, errors.New("no user exists with given username"))
+			return nil
+		}
+		if user.ID == ownerID {
+			writeFailure(w, http.StatusBadRequest, errors.New("the owner already has every right"))
+			return nil
+		}
+		permission.GranteeType = models.GRANTEE_USER
+		permission.GranteeID = user.ID
+		permission.GranteeName = user.Username
+	case groupName != "" && username == "":
+		group, err := ah.MetadataOps.GetGroupByName(groupName)
+		if err != nil {
+			writeFailure(w, http.StatusInternalServerError, err)
+			return nil
+		}
+		if group == nil {
+			writeFailure(w, http.StatusNotFound, errors.New("no group exists with given name"))
+			return nil
+		}
+		permission.GranteeType = models.GRANTEE_GROUP
+		permission.GranteeID = group.ID
+		permission.GranteeName = group.Name
+	default:
+		writeFailure(w, http.StatusBadRequest, errors.New("either username or group is required"))
+		return nil
+	}
+	return permission
+}
+
+func (ah *APIHandler) grantPermission(w http.ResponseWriter, permission *models.Permission) {
+	id, err := ah.MetadataOps.GrantPermission(*permission)
+	if err != nil {
+		utils.ErrorLog("Error granting permission: ", err)
+		writeFailure(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, map[string]interface{}{
+		"id": id,
+	})
+}
+
+func (ah *APIHandler) listPermissions(w http.ResponseWriter, resourceType string, resourceID int64) {
+	permissions, err := ah.MetadataOps.FetchPermissions(resourceType, resourceID)
+	if err != nil {
+		writeFailure(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, permissions)
+}
+
+func (ah *APIHandler) revokePermission(w http.ResponseWriter, r *http.Request, resourceType string, resourceID int64) {
+	permissionID, err := getPermissionID(r)
+	if err != nil {
+		writeFailure(w, http.StatusBadRequest, err)
+		return
+	}
+
+	err = ah.MetadataOps.RevokePermission(resourceType, resourceID, permissionID)
+	if errors.Is(err, utils.ErrPermissionNotFound) {
+		writeFailure(w, http.StatusNotFound, err)
+		return
+	} else if err != nil {
+		writeFailure(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(getSuccessMessage())
+}
+
+// Grants a role on a file to a user or a group, replacing their previous role.
+func (ah *APIHandler) grantFilePermission(w http.ResponseWriter, r *http.Request) {
+	utils.DebugLog("inside grantFilePermission")
+
+	record := ah.getActiveRecord(w, r, models.ROLE_OWNER)
+	if record == nil {
+		return
+	}
+
+	permission := ah.decodePermission(w, r, models.RESOURCE_FILE, record.ID, record.OwnerID)
+	if permission == nil {
+		return
+	}
+	ah.grantPermission(w, permission)
+}
+
+// Lists the roles granted on a file.
+func (ah *APIHandler) listFilePermissions(w http.ResponseWriter, r *http.Request) {
+	utils.DebugLog("inside listFilePermissions")
+
+	record := ah.getActiveRecord(w, r, models.ROLE_OWNER)
+	if record == nil {
+		return
+	}
+
+	ah.listPermissions(w, models.RESOURCE_FILE, record.ID)
+}
+
+// Revokes a role granted on a file.
+func (ah *APIHandler) revokeFilePermission(w http.ResponseWriter, r *http.Request) {
+	utils.DebugLog("inside revokeFilePermission")
+
+	record := ah.getActiveRecord(w, r, models.ROLE_OWNER)
+	if record == nil {
+		return
+	}
+
+	ah.revokePermission(w, r, models.RESOURCE_FILE, record.ID)
+}
+
+// Grants a role on a folder and everything inside it to a user or a group,
+// replacing their previous role.
+func (ah *APIHandler) grantFolderPermission(w http.ResponseWriter, r *http.Request) {
+	utils.DebugLog("inside grantFolderPermission")
+
+	folder := ah.getActiveFolder(w, r, models.ROLE_OWNER)
+	if folder == nil {
+		return
+	}
+
+	permission := ah.decodePermission(w, r, models.RESOURCE_FOLDER, folder.ID, folder.OwnerID)
+	if permission == nil {
+		return
+	}
+	ah.grantPermission(w, permission)
+}
+
+// Lists the roles granted on a folder.
+func (ah *APIHandler) listFolderPermissions(w http.ResponseWriter, r *http.Request) {
+	utils.DebugLog("inside listFolderPermissions")
+
+	folder := ah.getActiveFolder(w, r, models.ROLE_OWNER)
+	if folder == nil {
+		return
+	}
+
+	ah.listPermissions(w, models.RESOURCE_FOLDER, folder.ID)
+}
+
+// Revokes a role granted on a folder.
+func (ah *APIHandler) revokeFolderPermission(w http.ResponseWriter, r *http.Request) {
+	utils.DebugLog("inside revokeFolderPermission")
+
+	folder := ah.getActiveFolder(w, r, models.ROLE_OWNER)
+	if folder == nil {
+		return
+	}
+
+	ah.revokePermission(w, r, models.RESOURCE_FOLDER, folder.ID)
+}
+
+// Lists the files and folders of other users shared with the user, along with
+// the role granted on them.
+func (ah *APIHandler) listSharedWithMe(w http.ResponseWriter, r *http.Request) {
+	utils.DebugLog("inside listSharedWithMe")
+
+	shared, err := ah.MetadataOps.FetchSharedWithUser(getRequestUser(r).ID)
+	if err != nil {
+		writeFailure(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, shared)
+}
@@ -0,0 +1,371 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/manishlpu/assignment/models"
+	"github.com/manishlpu/assignment/utils"
+	"github.com/gorilla/mux"
+)
+
+const (
+	// Token granting access to a single object, served by servePresigned.
+	tokenTypeObject = "object"
+	// Token identifying a presigned upload, redeemed by completePresignedUpload.
+	tokenTypeUpload = "upload"
+)
+
+// Time a client has to confirm a presigned upload once its URL expired.
+const uploadCompletionGrace = time.Hour
+
+type objectClaims struct {
+	Type      string `json:"typ"`
+	Method    string `json:"method"`
+	Key       string `json:"key"`
+	OwnerID   int64  `json:"owner_id,omitempty"`
+	FileID    int64  `json:"file_id,omitempty"`
+	ExpiresAt int64  `json:"exp"`
+}
+
+type uploadClaims struct {
+	Type        string `json:"typ"`
+	Key         string `json:"key"`
+	OwnerID     int64  `json:"owner_id"`
+	Filename    string `json:"filename"`
+	Description string `json:"description,omitempty"`
+	FolderID    int64  `json:"folder_id,omitempty"`
+	ExpiresAt   int64  `json:"exp"`
+}
+
+type presignUploadRequest struct {
+	Filename    string `json:"filename"`
+	Description string `json:"description"`
+	FolderID    int64  `json:"folder_id"`
+	// Size of the content when known upfront, 0 otherwise
+	SizeInBytes int64 `json:"size_in_bytes"`
+}
+
+type completeUploadRequest struct {
+	UploadToken string `json:"upload_token"`
+}
+
+// Returns the validity of the presigned URLs, read from PRESIGN_EXPIRY.
+func getPresignExpiry() time.Duration {
+	expiry, err := time.ParseDuration(utils.GetEnvValue("PRESIGN_EXPIRY", "15m"))
+	if err != nil || expiry <= 0 {
+		utils.WarnLog("invalid PRESIGN_EXPIRY, using the default of 15m")
+		return 15 * time.Minute
+	}
+	return expiry
+}
+
+// Returns the URL of the server as seen by the client, APP_BASE_URL takes
+// precedence when the server runs behind a proxy.
+func getBaseURL(r *http.Request) string {
+	if baseURL := utils.GetEnvValue("APP_BASE_URL", ""); !utils.IsEmptyString(baseURL) {
+		return baseURL
+	}
+
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	return scheme + "://" + r.Host
+}
+
+// Issues a URL granting the method on the object for the given duration. The
+// blob store presigns it when able to, otherwise it is a signed token served
+// by servePresigned, downloads being limited to the file of the owner.
+func (ah *APIHandler) presignURL(r *http.Request, method, key string, ownerID, fileID int64, expiry time.Duration) (string, error) {
+	if presigner, ok := ah.S3Ops.(utils.Presigner); ok {
+		if method == http.MethodPut {
+			return presigner.PresignPutObject(getBucketName(), key, expiry)
+		}
+		return presigner.PresignGetObject(getBucketName(), key, expiry)
+	}
+
+	token, err := utils.SignToken(objectClaims{
+		Type:      tokenTypeObject,
+		Method:    method,
+		Key:       key,
+		OwnerID:   ownerID,
+		FileID:    fileID,
+		ExpiresAt: time.Now().Add(expiry).Unix(),
+	})
+	if err != nil {
+		return "", err
+	}
+	return getBaseURL(r) + "/api/presigned/" + token, nil
+}
+
+// Issues a presigned URL to upload a new file directly to the blob store.
+func (ah *APIHandler) presignUpload(w http.ResponseWriter, r *http.Request) {
+	utils.DebugLog("inside presignUpload")
+
+	var req presignUploadRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeFailure(w, http.StatusBadRequest, errors.New("invalid request body"))
+		return
+	}
+	if err := validateName(req.Filename); err != nil {
+		writeFailure(w, http.StatusBadRequest, err)
+		return
+	}
+	if req.SizeInBytes < 0 {
+		writeFailure(w, http.StatusBadRequest, errors.New("size_in_bytes must not be negative"))
+		return
+	}
+	if req.SizeInBytes > getMaxUploadSize() {
+		writeFailure(w, http.StatusRequestEntityTooLarge, errUploadTooLarge)
+		return
+	}
+
+	// Refuse uploads beyond the quota before they are sent, the quota is
+	// enforced again on completion once the size of the content is known
+	ownerID := getRequestUser(r).ID
+	if !ah.checkUploadFolder(w, ownerID, req.FolderID) {
+		return
+	}
+	if err := ah.MetadataOps.CheckQuota(ownerID, req.SizeInBytes, 1); err != nil {
+		writeFailure(w, getErrorStatusCode(err), err)
+		return
+	}
+
+	expiry := getPresignExpiry()
+	expiresAt := time.Now().Add(expiry)
+	key := newObjectKey(req.Filename)
+
+	uploadURL, err := ah.presignURL(r, http.MethodPut, key, ownerID, 0, expiry)
+	if err != nil {
+		utils.ErrorLog("Error presigning upload: ", err)
+		writeFailure(w, http.StatusInternalServerError, errors.New("unable to presign upload"))
+		return
+	}
+
+	uploadToken, err := utils.SignToken(uploadClaims{
+		Type:        tokenTypeUpload,
+		Key:         key,
+		OwnerID:     ownerID,
+		Filename:    req.Filename,
+		Description: req.Description,
+		FolderID:    req.FolderID,
+		ExpiresAt:   expiresAt.Add(uploadCompletionGrace).Unix(),
+	})
+	if err != nil {
+		writeFailure(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"upload_url":   uploadURL,
+		"method":       http.MethodPut,
+		"upload_token": uploadToken,
+		"expires_at":   expiresAt.UTC(),
+	})
+}
+
+// Records the metadata of a presigned upload, once the client confirms that
+// the object landed in the blob store.
+func (ah *APIHandler) completePresignedUpload(w http.ResponseWriter, r *http.Request) {
+	utils.DebugLog("inside completePresignedUpload")
+
+	var req completeUploadRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeFailure(w, http.StatusBadRequest, errors.New("invalid request body"))
+		return
+	}
+
+	expectedDigest, err := getExpectedDigest(r)
+	if err != nil {
+		writeFailure(w, http.StatusBadRequest, err)
+		return
+	}
+
+	var claims uploadClaims
+	err = utils.VerifyToken(req.UploadToken, &claims)
+	if err != nil || claims.Type != tokenTypeUpload || claims.OwnerID != getRequestUser(r).ID {
+		writeFailure(w, http.StatusBadRequest, utils.ErrInvalidToken)
+		return
+	}
+	if time.Now().Unix() > claims.ExpiresAt {
+		writeFailure(w, http.StatusBadRequest, errors.New("upload token has expired"))
+		return
+	}
+	// The folder may have been removed since the upload was presigned
+	if !ah.checkUploadFolder(w, claims.OwnerID, claims.FolderID) {
+		return
+	}
+
+	// Only one completion of the upload records a file
+	err = ah.MetadataOps.ClaimPresignedUpload(claims.Key, claims.OwnerID, time.Unix(claims.ExpiresAt, 0))
+	if errors.Is(err, utils.ErrUploadCompleted) {
+		writeFailure(w, http.StatusConflict, err)
+		return
+	} else if err != nil {
+		writeFailure(w, http.StatusInternalServerError, err)
+		return
+	}
+	completed := false
+	defer func() {
+		if completed {
+			return
+		}
+		if err := ah.MetadataOps.ReleasePresignedUpload(claims.Key); err != nil {
+			utils.ErrorLog("error releasing presigned upload: ", err)
+		}
+	}()
+
+	bucketName := getBucketName()
+	object, err := ah.S3Ops.GetObject(bucketName, claims.Key)
+	if errors.Is(err, utils.ErrObjectNotFound) {
+		writeFailure(w, http.StatusBadRequest, errors.New("object has not been uploaded"))
+		return
+	} else if err != nil {
+		utils.ErrorLog("Error fetching uploaded object: ", err)
+		writeFailure(w, http.StatusInternalServerError, errors.New("unable to fetch object"))
+		return
+	}
+	defer object.Close()
+
+	// The client can write to the object of the upload as long as its url is
+	// valid, the content is copied to an object of its own so that the blob
+	// of the file is never replaced
+	content, err := ah.streamObject(newBlobObjectKey(claims.Filename), object, expectedDigest)
+	if err != nil {
+		if errors.Is(err, errUploadTooLarge) || errors.Is(err, errDigestMismatch) {
+			// The object can be uploaded again with the same url until it expires
+			if err := ah.S3Ops.DeleteObject(bucketName, claims.Key); err != nil {
+				utils.ErrorLog("error deleting object: ", err)
+			}
+		}
+		writeFailure(w, getUploadStatusCode(err), err)
+		return
+	}
+
+	id, err := ah.MetadataOps.SaveRecord(models.Metadata{
+		Filename:    claims.Filename,
+		SizeInBytes: content.SizeInBytes,
+		S3ObjectKey: content.S3ObjectKey,
+		MimeType:    getMimeType(claims.Filename),
+		Description: claims.Description,
+		ContentHash: content.ContentHash,
+		ContentMD5:  content.ContentMD5,
+		FolderID:    claims.FolderID,
+		OwnerID:     claims.OwnerID,
+		Status:      models.STATUS_ACTIVE,
+	})
+	// The blob of a content is stored once whatever the number of files
+	// having it, the copy is dropped unless it became the blob
+	ah.discardObject(content.S3ObjectKey, content.ContentHash)
+	if err != nil {
+		utils.ErrorLog("Error saving metadata for presigned upload: ", err)
+		writeFailure(w, getErrorStatusCode(err), err)
+		return
+	}
+	completed = true
+	go ah.indexFile(claims.OwnerID, id)
+
+	// The content was copied, the object of the upload is no longer needed
+	if err := ah.S3Ops.DeleteObject(bucketName, claims.Key); err != nil {
+		utils.ErrorLog("error deleting object: ", err)
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"id": id,
+	})
+}
+
+// Issues a presigned URL to download the content of a file.
+func (ah *APIHandler) presignDownload(w http.ResponseWriter, r *http.Request) {
+	utils.DebugLog("inside presignDownload")
+
+	record := ah.getActiveRecord(w, r, models.ROLE_VIEWER)
+	if record == nil {
+		return
+	}
+
+	expiry := getPresignExpiry()
+	downloadURL, err := ah.presignURL(r, http.MethodGet, getS3KeyFromURI(record.S3ObjectKey), record.OwnerID, record.ID, expiry)
+	if err != nil {
+		utils.ErrorLog("Error presigning download: ", err)
+		writeFailure(w, http.StatusInternalServerError, errors.New("unable to presign download"))
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"download_url": downloadURL,
+		"expires_at":   time.Now().Add(expiry).UTC(),
+	})
+}
+
+// Serves the URLs presigned for the blob stores unable to presign them.
+func (ah *APIHandler) servePresigned(w http.ResponseWriter, r *http.Request) {
+	utils.DebugLog("inside servePresigned")
+
+	var claims objectClaims
+	if err := utils.VerifyToken(mux.Vars(r)["token"], &claims); err != nil || claims.Type != tokenTypeObject {
+		writeFailure(w, http.StatusForbidden, utils.ErrInvalidToken)
+		return
+	}
+	if time.Now().Unix() > claims.ExpiresAt {
+		writeFailure(w, http.StatusForbidden, errors.New("presigned url has expired"))
+		return
+	}
+
+	method := r.Method
+	if method == http.MethodHead {
+		method = http.MethodGet
+	}
+	if method != claims.Method {
+		writeFailure(w, http.StatusMethodNotAllowed, errors.New("method is not allowed for this url"))
+		return
+	}
+
+	if method == http.MethodPut {
+		// Objects of completed uploads are never written again, their content
+		// being recorded already
+		claimed, err := ah.MetadataOps.IsPresignedUploadClaimed(claims.Key)
+		if err != nil {
+			writeFailure(w, http.StatusInternalServerError, err)
+			return
+		}
+		if claimed {
+			writeFailure(w, http.StatusConflict, utils.ErrUploadCompleted)
+			return
+		}
+
+		expectedDigest, err := getExpectedDigest(r)
+		if err != nil {
+			writeFailure(w, http.StatusBadRequest, err)
+			return
+		}
+
+		// The size is checked again on completion, S3 presigned urls not
+		// limiting it
+		if err := limitUploadBody(w, r); err != nil {
+			writeFailure(w, http.StatusRequestEntityTooLarge, err)
+			return
+		}
+		if _, err := ah.streamObject(claims.Key, r.Body, expectedDigest); err != nil {
+			writeFailure(w, getUploadStatusCode(err), err)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	record, err := ah.MetadataOps.GetRecord(claims.OwnerID, claims.FileID)
+	if err != nil {
+		writeFailure(w, http.StatusInternalServerError, err)
+		return
+	}
+	if record == nil || getS3KeyFromURI(record.S3ObjectKey) != claims.Key {
+		writeFailure(w, http.StatusNotFound, errors.New("file no longer exists"))
+		return
+	}
+
+	ah.serveObject(w, r, record)
+}
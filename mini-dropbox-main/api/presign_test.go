@@ -0,0 +1,54 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/manishlpu/assignment/models"
+)
+
+// Presigned uploads land in the folder they were presigned for, and their
+// URL refuses writes once completed.
+func TestPresignedUploadsToFolder(t *testing.T) {
+	ts := newTestServer(t)
+	token := ts.signup("alice")
+
+	var folder struct {
+		ID int64 `json:"id"`
+	}
+	ts.decode(ts.expect(ts.do("POST", "/api/folders", token, map[string]interface{}{"name": "docs"}), http.StatusCreated), &folder)
+
+	refused := map[int64]int{-1: http.StatusBadRequest, folder.ID + 1: http.StatusNotFound}
+	for folderID, code := range refused {
+		ts.expect(ts.do("POST", "/api/files/presign/upload", token, map[string]interface{}{"filename": "a.txt", "folder_id": folderID}), code)
+	}
+
+	var presigned struct {
+		UploadURL   string `json:"upload_url"`
+		UploadToken string `json:"upload_token"`
+	}
+	req := map[string]interface{}{"filename": "a.txt", "folder_id": folder.ID}
+	ts.decode(ts.expect(ts.do("POST", "/api/files/presign/upload", token, req), http.StatusOK), &presigned)
+	uploadURL, err := url.Parse(presigned.UploadURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ts.expect(ts.do("PUT", uploadURL.Path, "", strings.NewReader("some text")), http.StatusOK)
+
+	complete := map[string]string{"upload_token": presigned.UploadToken}
+	var completed struct {
+		ID int64 `json:"id"`
+	}
+	ts.decode(ts.expect(ts.do("POST", "/api/files/presign/complete", token, complete), http.StatusOK), &completed)
+	ts.expect(ts.do("POST", "/api/files/presign/complete", token, complete), http.StatusConflict)
+	ts.expect(ts.do("PUT", uploadURL.Path, "", strings.NewReader("other text")), http.StatusConflict)
+
+	var file models.Metadata
+	ts.decode(ts.expect(ts.do("GET", fmt.Sprintf("/api/files/%d", completed.ID), token, nil), http.StatusOK), &file)
+	if file.FolderID != folder.ID || file.SizeInBytes != 9 || !strings.HasPrefix(getS3KeyFromURI(file.S3ObjectKey), "blobs/") {
+		t.Errorf("unexpected file: %+v", file)
+	}
+}
@@ -0,0 +1,120 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/manishlpu/assignment/utils"
+)
+
+const (
+	purgeJobLock = "purge"
+	// The lock is extended after every file, a server crashing in the middle
+	// of a purge holds it for at most this long
+	purgeJobLockTTL = 10 * time.Minute
+)
+
+var errPurgeLockLost = errors.New("purge lock taken over by another server")
+
+// PurgeReport counts what a run of the purge job removed.
+type PurgeReport struct {
+	Files int   `json:"files"`
+	Blobs int   `json:"blobs"`
+	Bytes int64 `json:"bytes"`
+}
+
+// PurgeJob permanently deletes the files kept in the trash beyond their
+// retention, along with the blobs no other file refers to. Servers sharing the
+// metadata store take turns through a job lock, and blobs released by a run
+// that crashed are removed by the next one.
+type PurgeJob struct {
+	ah     *APIHandler
+	holder string
+}
+
+func NewPurgeJob(ah *APIHandler) *PurgeJob {
+	return &PurgeJob{
+		ah:     ah,
+		holder: newJobHolder(),
+	}
+}
+
+// Returns the name a job holds its lock under, unique to the process.
+func newJobHolder() string {
+	hostname, _ := os.Hostname()
+	id, err := newRandomID()
+	if err != nil {
+		panic(err)
+	}
+	return fmt.Sprintf("%s/%d/%s", hostname, os.Getpid(), id)
+}
+
+// Runs the purge, unless another server is running it already in which case
+// nil is returned.
+func (pj *PurgeJob) Run() (*PurgeReport, error) {
+	acquired, err := pj.ah.MetadataOps.AcquireJobLock(purgeJobLock, pj.holder, purgeJobLockTTL)
+	if err != nil {
+		return nil, err
+	}
+	if !acquired {
+		utils.InfoLog("purge is running on another server, skipping")
+		return nil, nil
+	}
+	defer func() {
+		if err := pj.ah.MetadataOps.ReleaseJobLock(purgeJobLock, pj.holder); err != nil {
+			utils.ErrorLog("unable to release the purge lock: ", err)
+		}
+	}()
+
+	report := &PurgeReport{}
+	before := time.Now().Add(-getTrashRetention())
+	records, err := pj.ah.MetadataOps.FetchInactiveRecords(before)
+	if err != nil {
+		return report, err
+	}
+
+	for _, record := range records {
+		acquired, err := pj.ah.MetadataOps.AcquireJobLock(purgeJobLock, pj.holder, purgeJobLockTTL)
+		if err != nil {
+			return report, err
+		}
+		if !acquired {
+			return report, errPurgeLockLost
+		}
+
+		// The file and its versions are deleted in one transaction, the blobs
+		// they released stay recorded until their objects are removed
+		contentHashes, err := pj.ah.MetadataOps.PurgeInactiveRecord(record.ID, before)
+		if errors.Is(err, utils.ErrTrashedFileNotFound) {
+			// Restored or purged meanwhile
+			continue
+		} else if err != nil {
+			utils.ErrorLog("unable to purge file: ", record.ID, err)
+			continue
+		}
+		report.Files++
+
+		blobs, bytes := pj.ah.deleteBlobs(contentHashes)
+		report.Blobs += blobs
+		report.Bytes += bytes
+	}
+
+	// Blobs released by runs, version prunes or trash purges which did not get
+	// to remove them
+	blobs, err := pj.ah.MetadataOps.FetchUnreferencedBlobs()
+	if err != nil {
+		return report, err
+	}
+	contentHashes := make([]string, 0, len(blobs))
+	for _, blob := range blobs {
+		contentHashes = append(contentHashes, blob.ContentHash)
+	}
+	count, bytes := pj.ah.deleteBlobs(contentHashes)
+	report.Blobs += count
+	report.Bytes += bytes
+
+	utils.InfoLog(fmt.Sprintf("purged %d files and %d blobs of %d bytes", report.Files, report.Blobs, report.Bytes))
+	return report, nil
+}
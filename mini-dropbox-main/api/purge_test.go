@@ -0,0 +1,35 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+)
+
+// The purge job works on the stores of the handler serving the requests, so
+// that it removes the files deleted through the server.
+func TestPurgeJobSharesTheHandler(t *testing.T) {
+	t.Setenv("TRASH_RETENTION", "1ns")
+	ts := newTestServer(t)
+	token := ts.signup("alice")
+	id := ts.upload(token, "a.txt", "some text")
+	path := fmt.Sprintf("/api/files/%d", id)
+
+	var file struct {
+		S3ObjectKey string `json:"s3_object_key"`
+	}
+	ts.decode(ts.expect(ts.do("GET", path, token, nil), http.StatusOK), &file)
+	ts.expect(ts.do("DELETE", path, token, nil), http.StatusOK)
+
+	report, err := NewPurgeJob(ts.ah).Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report == nil || report.Files != 1 || report.Blobs != 1 {
+		t.Fatalf("expected the file and its blob to be purged, got %+v", report)
+	}
+	if _, err := ts.ah.S3Ops.GetObjectSize(getBucketName(), getS3KeyFromURI(file.S3ObjectKey)); err == nil {
+		t.Error("object of the purged file was kept")
+	}
+	ts.expect(ts.do("POST", fmt.Sprintf("/api/trash/%d/restore", id), token, nil), http.StatusNotFound)
+}
@@ -0,0 +1,226 @@
+package api
+
+import (
+	"fmt"
+	"mime"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/manishlpu/assignment/models"
+	"github.com/manishlpu/assignment/utils"
+)
+
+// quotaUsage is the storage used under a quota. Available amounts are null
+// when unlimited.
+type quotaUsage struct {
+	UsedBytes      int64  `json:"used_bytes"`
+	QuotaBytes     int64  `json:"quota_bytes"`
+	AvailableBytes *int64 `json:"available_bytes"`
+	Files          int64  `json:"files"`
+	QuotaFiles     int64  `json:"quota_files"`
+	AvailableFiles *int64 `json:"available_files"`
+}
+
+type mimeTypeUsage struct {
+	MimeType string `json:"mime_type"`
+	Files    int64  `json:"files"`
+	Bytes    int64  `json:"bytes"`
+}
+
+type groupUsage struct {
+	ID   int64  `json:"id"`
+	Name string `json:"name"`
+	quotaUsage
+}
+
+type usageResponse struct {
+	quotaUsage
+	CurrentBytes int64           `json:"current_bytes"`
+	VersionBytes int64           `json:"version_bytes"`
+	TrashBytes   int64           `json:"trash_bytes"`
+	ByMimeType   []mimeTypeUsage `json:"by_mime_type"`
+	Groups       []groupUsage    `json:"groups"`
+}
+
+func newQuotaUsage(quota *models.Quota, usage *models.Usage) quotaUsage {
+	qu := quotaUsage{
+		UsedBytes:  usage.Bytes,
+		QuotaBytes: quota.MaxBytes,
+		Files:      usage.Files,
+		QuotaFiles: quota.MaxFiles,
+	}
+	if quota.MaxBytes > 0 {
+		available := max(quota.MaxBytes-usage.Bytes, 0)
+		qu.AvailableBytes = &available
+	}
+	if quota.MaxFiles > 0 {
+		available := max(quota.MaxFiles-usage.Files, 0)
+		qu.AvailableFiles = &available
+	}
+	return qu
+}
+
+// Lowers the available amounts to the ones left under another quota.
+func (qu *quotaUsage) limitTo(other quotaUsage) {
+	if other.AvailableBytes != nil && (qu.AvailableBytes == nil || *other.AvailableBytes < *qu.AvailableBytes) {
+		available := *other.AvailableBytes
+		qu.AvailableBytes = &available
+	}
+	if other.AvailableFiles != nil && (qu.AvailableFiles == nil || *other.AvailableFiles < *qu.AvailableFiles) {
+		available := *other.AvailableFiles
+		qu.AvailableFiles = &available
+	}
+}
+
+// Returns the storage used by the user against its quota, by mime type and
+// state, along with the usage of its groups. Old versions and deleted files
+// count until they are pruned or purged. The available amounts account for
+// the quotas of the groups as well.
+func (ah *APIHandler) getUsage(w http.ResponseWriter, r *http.Request) {
+	utils.DebugLog("inside getUsage")
+
+	user := getRequestUser(r)
+	quota, err := ah.MetadataOps.GetQuota(models.QUOTA_USER, user.ID)
+	if err != nil {
+		writeFailure(w, http.StatusInternalServerError, err)
+		return
+	}
+	entries, err := ah.MetadataOps.FetchUsageEntries(user.ID)
+	if err != nil {
+		writeFailure(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	var usage models.Usage
+	resp := usageResponse{ByMimeType: []mimeTypeUsage{}, Groups: []groupUsage{}}
+	byMimeType := map[string]*mimeTypeUsage{}
+	for _, entry := range entries {
+		usage.Bytes += entry.Bytes
+		usage.Files += entry.Files
+		switch entry.State {
+		case models.USAGE_CURRENT:
+			resp.CurrentBytes += entry.Bytes
+		case models.USAGE_VERSION:
+			resp.VersionBytes += entry.Bytes
+		case models.USAGE_TRASH:
+			resp.TrashBytes += entry.Bytes
+		}
+
+		// Parameters such as the charset are left out of the breakdown
+		mimeType, _, err := mime.ParseMediaType(entry.MimeType)
+		if err != nil {
+			mimeType = strings.ToLower(strings.TrimSpace(entry.MimeType))
+		}
+		if mimeType == "" {
+			mimeType = "application/octet-stream"
+		}
+		if byMimeType[mimeType] == nil {
+			byMimeType[mimeType] = &mimeTypeUsage{MimeType: mimeType}
+		}
+		byMimeType[mimeType].Files += entry.Files
+		byMimeType[mimeType].Bytes += entry.Bytes
+	}
+	for _, mtu := range byMimeType {
+		resp.ByMimeType = append(resp.ByMimeType, *mtu)
+	}
+	sort.Slice(resp.ByMimeType, func(i, j int) bool {
+		if resp.ByMimeType[i].Bytes != resp.ByMimeType[j].Bytes {
+			return resp.ByMimeType[i].Bytes > resp.ByMimeType[j].Bytes
+		}
+		return resp.ByMimeType[i].MimeType < resp.ByMimeType[j].MimeType
+	})
+	resp.quotaUsage = newQuotaUsage(quota, &usage)
+
+	groups, err := ah.MetadataOps.FetchUserGroups(user.ID)
+	if err != nil {
+		writeFailure(w, http.StatusInternalServerError, err)
+		return
+	}
+	for _, group := range groups {
+		quota, err := ah.MetadataOps.GetQuota(models.QUOTA_GROUP, group.ID)
+		if err != nil {
+			writeFailure(w, http.StatusInternalServerError, err)
+			return
+		}
+		usage, err := ah.MetadataOps.FetchUsage(models.QUOTA_GROUP, group.ID)
+		if err != nil {
+			writeFailure(w, http.StatusInternalServerError, err)
+			return
+		}
+		gu := groupUsage{ID: group.ID, Name: group.Name, quotaUsage: newQuotaUsage(quota, usage)}
+		resp.Groups = append(resp.Groups, gu)
+		resp.limitTo(gu.quotaUsage)
+	}
+
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// Returns the id of the user or group of the given name.
+func getQuotaSubjectID(store utils.MetadataOps, subjectType, name string) (int64, error) {
+	switch subjectType {
+	case models.QUOTA_USER:
+		user, err := getUserByUsername(store, name)
+		if err != nil {
+			return 0, err
+		}
+		return user.ID, nil
+	case models.QUOTA_GROUP:
+		group, err := store.GetGroupByName(strings.TrimSpace(name))
+		if err != nil {
+			return 0, err
+		}
+		if group == nil {
+			return 0, fmt.Errorf("no group exists with name %q", name)
+		}
+		return group.ID, nil
+	default:
+		return 0, fmt.Errorf("unknown quota subject %q", subjectType)
+	}
+}
+
+// SetQuota limits the bytes and files stored by the user or group of the
+// given name, 0 being unlimited.
+func SetQuota(subjectType, name string, maxBytes, maxFiles int64) error {
+	if maxBytes < 0 || maxFiles < 0 {
+		return fmt.Errorf("quotas cannot be negative")
+	}
+
+	store, err := utils.NewMetadataStore()
+	if err != nil {
+		return err
+	}
+	id, err := getQuotaSubjectID(store, subjectType, name)
+	if err != nil {
+		return err
+	}
+	return store.SetQuota(models.Quota{
+		SubjectType: subjectType,
+		SubjectID:   id,
+		MaxBytes:    maxBytes,
+		MaxFiles:    maxFiles,
+	})
+}
+
+// GetQuota returns the quota of the user or group of the given name, along
+// with its usage.
+func GetQuota(subjectType, name string) (*models.Quota, *models.Usage, error) {
+	store, err := utils.NewMetadataStore()
+	if err != nil {
+		return nil, nil, err
+	}
+	id, err := getQuotaSubjectID(store, subjectType, name)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	quota, err := store.GetQuota(subjectType, id)
+	if err != nil {
+		return nil, nil, err
+	}
+	usage, err := store.FetchUsage(subjectType, id)
+	if err != nil {
+		return nil, nil, err
+	}
+	return quota, usage, nil
+}
@@ -0,0 +1,49 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/manishlpu/assignment/models"
+)
+
+// Uploads and updates going beyond the quota are refused, the resumable and
+// presigned ones upfront from their declared size.
+func TestUploadsBeyondTheQuotaAreRefused(t *testing.T) {
+	t.Setenv("DEFAULT_QUOTA_BYTES", "16")
+	ts := newTestServer(t)
+	token := ts.signup("alice")
+	id := ts.upload(token, "a.txt", "0123456789")
+
+	ts.expect(ts.do("PUT", "/api/files/upload/b.txt", token, strings.NewReader("0123456789")), http.StatusInsufficientStorage)
+	// Older versions count until they are purged
+	ts.expect(ts.do("PUT", fmt.Sprintf("/api/files/%d", id), token, strings.NewReader("9876543210")), http.StatusInsufficientStorage)
+	declared := map[string]interface{}{"filename": "b.txt", "size_in_bytes": 10}
+	ts.expect(ts.do("POST", "/api/uploads", token, declared), http.StatusInsufficientStorage)
+	ts.expect(ts.do("POST", "/api/files/presign/upload", token, declared), http.StatusInsufficientStorage)
+
+	ts.upload(token, "b.txt", "012345")
+}
+
+// The quota of a group only applies to its members, users joining it by
+// accepting its invitation.
+func TestGroupQuotaAppliesOnceInvitationAccepted(t *testing.T) {
+	ts := newTestServer(t)
+	owner := ts.signup("bob")
+	token := ts.signup("alice")
+
+	var group struct {
+		ID int64 `json:"id"`
+	}
+	ts.decode(ts.expect(ts.do("POST", "/api/groups", owner, map[string]string{"name": "team"}), http.StatusCreated), &group)
+	if err := ts.ah.MetadataOps.SetQuota(models.Quota{SubjectType: models.QUOTA_GROUP, SubjectID: group.ID, MaxBytes: 4}); err != nil {
+		t.Fatal(err)
+	}
+	ts.expect(ts.do("POST", fmt.Sprintf("/api/groups/%d/members", group.ID), owner, map[string]string{"username": "alice"}), http.StatusOK)
+
+	ts.upload(token, "a.txt", "01234")
+	ts.expect(ts.do("POST", fmt.Sprintf("/api/groups/invitations/%d", group.ID), token, nil), http.StatusOK)
+	ts.expect(ts.do("PUT", "/api/files/upload/b.txt", token, strings.NewReader("01234")), http.StatusInsufficientStorage)
+}
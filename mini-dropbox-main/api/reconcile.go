@@ -0,0 +1,166 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/manishlpu/assignment/utils"
+)
+
+const (
+	reconcileJobLock    = "reconcile"
+	reconcileJobLockTTL = 30 * time.Minute
+)
+
+var errReconcileLockLost = errors.New("reconcile lock taken over by another server")
+
+// ReconcileReport lists the inconsistencies between the metadata store and
+// the blob store found by a run of the reconcile job.
+type ReconcileReport struct {
+	// Uploads which failed, or were interrupted, before being committed
+	FailedUploads int `json:"failed_uploads"`
+	// Rows pointing at an object missing from the blob store
+	MissingObjects []utils.ObjectReference `json:"missing_objects"`
+	// Objects no row points at
+	OrphanObjects []utils.ObjectInfo `json:"orphan_objects"`
+	OrphanBytes   int64              `json:"orphan_bytes"`
+	Repaired      bool               `json:"repaired"`
+}
+
+// ReconcileJob compares the metadata store with the blob store. Repairing
+// deletes the failed uploads and the orphan objects. Rows whose object is
+// missing are only reported, their content being lost.
+type ReconcileJob struct {
+	ah     *APIHandler
+	holder string
+	repair bool
+	// Uploads and objects younger than this may belong to uploads in progress
+	grace time.Duration
+}
+
+func NewReconcileJob(ah *APIHandler, repair bool, grace time.Duration) *ReconcileJob {
+	return &ReconcileJob{
+		ah:     ah,
+		holder: newJobHolder(),
+		repair: repair,
+		grace:  grace,
+	}
+}
+
+// Runs the reconciliation, unless another server is running it already in
+// which case nil is returned.
+func (rj *ReconcileJob) Run() (*ReconcileReport, error) {
+	acquired, err := rj.ah.MetadataOps.AcquireJobLock(reconcileJobLock, rj.holder, reconcileJobLockTTL)
+	if err != nil {
+		return nil, err
+	}
+	if !acquired {
+		utils.InfoLog("reconcile is running on another server, skipping")
+		return nil, nil
+	}
+	defer func() {
+		if err := rj.ah.MetadataOps.ReleaseJobLock(reconcileJobLock, rj.holder); err != nil {
+			utils.ErrorLog("unable to release the reconcile lock: ", err)
+		}
+	}()
+
+	report := &ReconcileReport{Repaired: rj.repair}
+	before := time.Now().Add(-rj.grace)
+
+	// Failed uploads are removed first, so that the objects they were
+	// storing show up as orphans
+	if rj.repair {
+		count, err := rj.ah.MetadataOps.PurgeFailedRecords(before)
+		if err != nil {
+			return report, err
+		}
+		report.FailedUploads = int(count)
+	} else {
+		records, err := rj.ah.MetadataOps.FetchFailedRecords(before)
+		if err != nil {
+			return report, err
+		}
+		report.FailedUploads = len(records)
+	}
+
+	// Rows are read before and after listing the objects. Objects stored
+	// during the listing are only missing from the rows read after, and
+	// objects removed during the listing are only referenced by the rows
+	// read before.
+	previous, err := rj.ah.MetadataOps.FetchObjectReferences()
+	if err != nil {
+		return report, err
+	}
+	objects := map[string]utils.ObjectInfo{}
+	err = rj.ah.S3Ops.ListObjects(getBucketName(), "", func(object utils.ObjectInfo) error {
+		objects[object.Key] = object
+		return nil
+	})
+	if err != nil {
+		return report, err
+	}
+	current, err := rj.ah.MetadataOps.FetchObjectReferences()
+	if err != nil {
+		return report, err
+	}
+
+	referenced := map[string]bool{}
+	for _, reference := range current {
+		referenced[getS3KeyFromURI(reference.S3ObjectKey)] = true
+	}
+	for _, reference := range previous {
+		key := getS3KeyFromURI(reference.S3ObjectKey)
+		if _, ok := objects[key]; !ok && referenced[key] {
+			report.MissingObjects = append(report.MissingObjects, reference)
+		}
+	}
+	for key, object := range objects {
+		if !referenced[key] && object.LastModified.Before(before) {
+			report.OrphanObjects = append(report.OrphanObjects, object)
+			report.OrphanBytes += object.SizeInBytes
+		}
+	}
+	sort.Slice(report.OrphanObjects, func(i, j int) bool {
+		return report.OrphanObjects[i].Key < report.OrphanObjects[j].Key
+	})
+
+	if rj.repair {
+		if err := rj.deleteOrphans(report.OrphanObjects); err != nil {
+			return report, err
+		}
+	}
+
+	utils.InfoLog(fmt.Sprintf("reconciled %d failed uploads, %d missing objects and %d orphan objects of %d bytes",
+		report.FailedUploads, len(report.MissingObjects), len(report.OrphanObjects), report.OrphanBytes))
+	return report, nil
+}
+
+// Removes the orphan objects from the blob store, unless a row started
+// referring to them since they were listed. Chunks are referred to by their
+// key, the other rows by the URI of the object.
+func (rj *ReconcileJob) deleteOrphans(objects []utils.ObjectInfo) error {
+	acquired, err := rj.ah.MetadataOps.AcquireJobLock(reconcileJobLock, rj.holder, reconcileJobLockTTL)
+	if err != nil {
+		return err
+	}
+	if !acquired {
+		return errReconcileLockLost
+	}
+
+	bucketName := getBucketName()
+	for _, object := range objects {
+		referenced, err := rj.ah.MetadataOps.IsObjectReferenced(object.Key, getObjectURI(object.Key))
+		if err != nil {
+			return err
+		}
+		if referenced {
+			continue
+		}
+		if err := rj.ah.S3Ops.DeleteObject(bucketName, object.Key); err != nil {
+			utils.ErrorLog("error deleting orphan object: ", object.Key, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,42 @@
+package api
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/manishlpu/assignment/utils"
+)
+
+// Objects listed as orphans are kept when a row of any kind started
+// referring to them, such as the chunk of an upload in progress.
+func TestDeleteOrphansKeepsReferencedObjects(t *testing.T) {
+	ts := newTestServer(t)
+	token := ts.signup("alice")
+
+	var upload struct {
+		ID string `json:"id"`
+	}
+	ts.decode(ts.expect(ts.do("POST", "/api/uploads", token, map[string]interface{}{"filename": "a.txt", "size_in_bytes": 10}), http.StatusCreated), &upload)
+	ts.expect(ts.do("PATCH", "/api/uploads/"+upload.ID, token, strings.NewReader("01234"), "Upload-Offset", "0"), http.StatusNoContent)
+	chunks, err := ts.ah.MetadataOps.FetchUploadChunks(upload.ID)
+	if err != nil || len(chunks) != 1 {
+		t.Fatalf("expected a single chunk, got %v %v", chunks, err)
+	}
+
+	orphan := newBlobObjectKey("orphan.txt")
+	if err := ts.ah.S3Ops.UploadObject(getBucketName(), orphan, strings.NewReader("lost")); err != nil {
+		t.Fatal(err)
+	}
+
+	job := NewReconcileJob(ts.ah, true, 0)
+	if err := job.deleteOrphans([]utils.ObjectInfo{{Key: chunks[0].S3ObjectKey}, {Key: orphan}}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ts.ah.S3Ops.GetObjectSize(getBucketName(), chunks[0].S3ObjectKey); err != nil {
+		t.Errorf("chunk of the upload was deleted: %v", err)
+	}
+	if _, err := ts.ah.S3Ops.GetObjectSize(getBucketName(), orphan); err == nil {
+		t.Error("orphan object was kept")
+	}
+}
@@ -0,0 +1,447 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/manishlpu/assignment/models"
+	"github.com/manishlpu/assignment/utils"
+	"github.com/gorilla/mux"
+)
+
+type createUploadRequest struct {
+	Filename    string `json:"filename"`
+	Description string `json:"description"`
+	SizeInBytes int64  `json:"size_in_bytes"`
+	FolderID    int64  `json:"folder_id"`
+}
+
+// Returns for how long an upload session is kept without receiving any
+// chunk, read from UPLOAD_SESSION_TTL.
+func getUploadSessionTTL() time.Duration {
+	ttl, err := time.ParseDuration(utils.GetEnvValue("UPLOAD_SESSION_TTL", "24h"))
+	if err != nil || ttl <= 0 {
+		utils.WarnLog("invalid UPLOAD_SESSION_TTL, using the default of 24h")
+		return 24 * time.Hour
+	}
+	return ttl
+}
+
+// Returns the key of the object storing a chunk. Keys are unique per attempt,
+// so a chunk rejected on concurrent uploads never removes the accepted one.
+func getChunkObjectKey(sessionID string, offset int64) string {
+	return fmt.Sprintf("uploads/%s/%d_%d", sessionID, offset, time.Now().UnixNano())
+}
+
+func setUploadOffsetHeaders(w http.ResponseWriter, session *models.UploadSession) {
+	w.Header().Set("Upload-Offset", strconv.FormatInt(session.Offset, 10))
+	w.Header().Set("Upload-Length", strconv.FormatInt(session.SizeInBytes, 10))
+	w.Header().Set("Cache-Control", "no-store")
+}
+
+// Fetches the active session of the request path, writing the failure
+// response when there is none.
+func (ah *APIHandler) getActiveUploadSession(w http.ResponseWriter, r *http.Request) *models.UploadSession {
+	session, err := ah.MetadataOps.GetUploadSession(getRequestUser(r).ID, mux.Vars(r)["uploadID"])
+	if err != nil {
+		writeFailure(w, http.StatusInternalServerError, err)
+		return nil
+	}
+	if session == nil {
+		writeFailure(w, http.StatusNotFound, errors.New("no upload session exists with given id"))
+		return nil
+	}
+	if session.Status != models.UPLOAD_SESSION_ACTIVE {
+		writeFailure(w, http.StatusGone, errors.New("upload session is already finalized"))
+		return nil
+	}
+	return session
+}
+
+// Creates a session to upload a file in chunks.
+func (ah *APIHandler) createUpload(w http.ResponseWriter, r *http.Request) {
+	utils.DebugLog("inside createUpload")
+
+	var req createUploadRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeFailure(w, http.StatusBadRequest, errors.New("invalid request body"))
+		return
+	}
+	if err := validateName(req.Filename); err != nil {
+		writeFailure(w, http.StatusBadRequest, err)
+		return
+	}
+	if req.SizeInBytes <= 0 {
+		writeFailure(w, http.StatusBadRequest, errors.New("size_in_bytes must be positive"))
+		return
+	}
+	if req.SizeInBytes > getMaxUploadSize() {
+		writeFailure(w, http.StatusRequestEntityTooLarge, errUploadTooLarge)
+		return
+	}
+	if !ah.checkUploadFolder(w, getRequestUser(r).ID, req.FolderID) {
+		return
+	}
+	if err := ah.MetadataOps.CheckQuota(getRequestUser(r).ID, req.SizeInBytes, 1); err != nil {
+		writeFailure(w, getErrorStatusCode(err), err)
+		return
+	}
+
+	id, err := newRandomID()
+	if err != nil {
+		writeFailure(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	now := time.Now().UTC()
+	session := models.UploadSession{
+		ID:          id,
+		Filename:    req.Filename,
+		Description: req.Description,
+		SizeInBytes: req.SizeInBytes,
+		S3ObjectKey: newObjectKey(req.Filename),
+		FolderID:    req.FolderID,
+		OwnerID:     getRequestUser(r).ID,
+		ExpiresAt:   now.Add(getUploadSessionTTL()),
+		CreatedAt:   now,
+		UpdatedAt:   now,
+	}
+	if err := ah.MetadataOps.CreateUploadSession(session); err != nil {
+		utils.ErrorLog("Error creating upload session: ", err)
+		writeFailure(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	w.Header().Set("Location", "/api/uploads/"+session.ID)
+	setUploadOffsetHeaders(w, &session)
+	writeJSON(w, http.StatusCreated, session)
+}
+
+// Reports the progress of an upload session through the Upload-Offset header.
+func (ah *APIHandler) getUploadOffset(w http.ResponseWriter, r *http.Request) {
+	utils.DebugLog("inside getUploadOffset")
+
+	session, err := ah.MetadataOps.GetUploadSession(getRequestUser(r).ID, mux.Vars(r)["uploadID"])
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	if session == nil {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	setUploadOffsetHeaders(w, session)
+	if session.Status != models.UPLOAD_SESSION_ACTIVE {
+		w.Header().Set("Location", fmt.Sprintf("/api/files/%d", session.FileID))
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+// Receives the chunk of an upload session starting at the Upload-Offset header,
+// which must match the offset reached so far.
+func (ah *APIHandler) uploadChunk(w http.ResponseWriter, r *http.Request) {
+	utils.DebugLog("inside uploadChunk")
+
+	offset, err := strconv.ParseInt(r.Header.Get("Upload-Offset"), 10, 64)
+	if err != nil {
+		writeFailure(w, http.StatusBadRequest, errors.New("valid Upload-Offset header is required"))
+		return
+	}
+
+	session := ah.getActiveUploadSession(w, r)
+	if session == nil {
+		return
+	}
+	if offset != session.Offset {
+		setUploadOffsetHeaders(w, session)
+		writeFailure(w, http.StatusConflict, utils.ErrOffsetMismatch)
+		return
+	}
+
+	// Sessions created before the maximum size was lowered never complete
+	if session.SizeInBytes > getMaxUploadSize() {
+		writeFailure(w, http.StatusRequestEntityTooLarge, errUploadTooLarge)
+		return
+	}
+	remaining := session.SizeInBytes - session.Offset
+	if r.ContentLength > remaining {
+		writeFailure(w, http.StatusRequestEntityTooLarge, errors.New("chunk exceeds the size of the upload"))
+		return
+	}
+	if err := limitUploadBody(w, r); err != nil {
+		writeFailure(w, http.StatusRequestEntityTooLarge, err)
+		return
+	}
+
+	// Read one byte past the remaining size to detect oversized chunks of
+	// unknown length.
+	body := &countingReader{reader: io.LimitReader(r.Body, remaining+1)}
+	bucketName := getBucketName()
+	chunkKey := getChunkObjectKey(session.ID, offset)
+	if err := ah.S3Ops.UploadObjectParts(bucketName, chunkKey, body); err != nil {
+		utils.ErrorLog("Error uploading chunk: ", err)
+		err = getBodyError(body.err, errors.New("unable to upload chunk"))
+		writeFailure(w, getUploadStatusCode(err), err)
+		return
+	}
+
+	var chunkErr error
+	statusCode := http.StatusBadRequest
+	if body.count == 0 {
+		chunkErr = errors.New("chunk is empty")
+	} else if body.count > remaining {
+		chunkErr = errors.New("chunk exceeds the size of the upload")
+		statusCode = http.StatusRequestEntityTooLarge
+	} else {
+		chunkErr = ah.MetadataOps.AddUploadChunk(models.UploadChunk{
+			SessionID:   session.ID,
+			Offset:      offset,
+			SizeInBytes: body.count,
+			S3ObjectKey: chunkKey,
+		}, time.Now().Add(getUploadSessionTTL()))
+		statusCode = http.StatusInternalServerError
+		if errors.Is(chunkErr, utils.ErrOffsetMismatch) {
+			statusCode = http.StatusConflict
+		}
+	}
+
+	if chunkErr != nil {
+		if err := ah.S3Ops.DeleteObject(bucketName, chunkKey); err != nil {
+			utils.ErrorLog("error deleting rejected chunk: ", err)
+		}
+		writeFailure(w, statusCode, chunkErr)
+		return
+	}
+
+	session.Offset = offset + body.count
+	setUploadOffsetHeaders(w, session)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Assembles the chunks of a fully received upload into the file object and
+// records its metadata.
+func (ah *APIHandler) finalizeUpload(w http.ResponseWriter, r *http.Request) {
+	utils.DebugLog("inside finalizeUpload")
+
+	session := ah.getActiveUploadSession(w, r)
+	if session == nil {
+		return
+	}
+	if session.Offset != session.SizeInBytes {
+		setUploadOffsetHeaders(w, session)
+		writeFailure(w, http.StatusConflict, errors.New("upload is not complete"))
+		return
+	}
+	expectedDigest, err := getExpectedDigest(r)
+	if err != nil {
+		writeFailure(w, http.StatusBadRequest, err)
+		return
+	}
+
+	chunks, err := ah.MetadataOps.FetchUploadChunks(session.ID)
+	if err != nil {
+		writeFailure(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	bucketName := getBucketName()
+	chunkContent := newChunkReader(ah.S3Ops, bucketName, chunks)
+	defer chunkContent.Close()
+
+	// The key is unique per attempt, so that concurrent finalizes never
+	// remove the object of one another
+	key := newBlobObjectKey(session.Filename)
+	hasher := newContentHasher()
+	content := io.TeeReader(chunkContent, hasher)
+	if err := ah.S3Ops.UploadObjectParts(bucketName, key, content); err != nil {
+		utils.ErrorLog("Error assembling upload: ", err)
+		writeFailure(w, http.StatusInternalServerError, errors.New("unable to upload object"))
+		return
+	}
+
+	// The content is only known once assembled
+	contentHash := hasher.SHA256()
+	if err := verifyDigest(expectedDigest, contentHash); err != nil {
+		if err := ah.S3Ops.DeleteObject(bucketName, key); err != nil {
+			utils.ErrorLog("error deleting object: ", err)
+		}
+		writeFailure(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+
+	// The file is only recorded by the finalize completing the session
+	uri := getObjectURI(key)
+	id, err := ah.MetadataOps.CompleteUploadSession(session.ID, models.Metadata{
+		Filename:    session.Filename,
+		SizeInBytes: session.SizeInBytes,
+		S3ObjectKey: uri,
+		MimeType:    getMimeType(session.Filename),
+		Description: session.Description,
+		ContentHash: contentHash,
+		ContentMD5:  hasher.MD5(),
+		FolderID:    session.FolderID,
+		OwnerID:     session.OwnerID,
+		Status:      models.STATUS_ACTIVE,
+	})
+	// The blob of a content is stored once whatever the number of files
+	// having it, the object is dropped unless it became the blob
+	ah.discardObject(uri, contentHash)
+	if err != nil {
+		utils.ErrorLog("Error saving metadata for upload: ", err)
+		if errors.Is(err, utils.ErrUploadSessionFinalized) {
+			// Lost against a concurrent finalize, which recorded the file
+			writeFailure(w, http.StatusConflict, err)
+			return
+		}
+		writeFailure(w, getErrorStatusCode(err), err)
+		return
+	}
+
+	// Remove the chunks from blob store, the file object holds their content
+	go ah.deleteChunkObjects(bucketName, chunks)
+	go ah.indexFile(session.OwnerID, id)
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"id": id,
+	})
+}
+
+// Aborts an upload session, dropping the chunks received so far.
+func (ah *APIHandler) abortUpload(w http.ResponseWriter, r *http.Request) {
+	utils.DebugLog("inside abortUpload")
+
+	session := ah.getActiveUploadSession(w, r)
+	if session == nil {
+		return
+	}
+
+	chunks, err := ah.MetadataOps.FetchUploadChunks(session.ID)
+	if err != nil {
+		writeFailure(w, http.StatusInternalServerError, err)
+		return
+	}
+	if err := ah.MetadataOps.DeleteUploadSession(session.ID); err != nil {
+		writeFailure(w, http.StatusInternalServerError, err)
+		return
+	}
+	go ah.deleteChunkObjects(getBucketName(), chunks)
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (ah *APIHandler) deleteChunkObjects(bucket string, chunks []models.UploadChunk) {
+	for _, chunk := range chunks {
+		if err := ah.S3Ops.DeleteObject(bucket, chunk.S3ObjectKey); err != nil {
+			utils.ErrorLog("error deleting chunk object: ", err)
+		}
+	}
+}
+
+// Removes the expired upload sessions along with the chunks of the ones which
+// were abandoned, and forgets the presigned uploads which expired.
+func (ah *APIHandler) CleanupUploadSessions() error {
+	if err := ah.MetadataOps.DeleteExpiredPresignedUploads(); err != nil {
+		return err
+	}
+
+	sessions, err := ah.MetadataOps.FetchExpiredUploadSessions()
+	if err != nil {
+		return err
+	}
+
+	bucketName := getBucketName()
+	for _, session := range sessions {
+		chunks, err := ah.MetadataOps.FetchUploadChunks(session.ID)
+		if err != nil {
+			utils.ErrorLog("unable to fetch chunks of upload session: ", session.ID, err)
+			continue
+		}
+		if err := ah.MetadataOps.DeleteUploadSession(session.ID); err != nil {
+			utils.ErrorLog("unable to delete upload session: ", session.ID, err)
+			continue
+		}
+		ah.deleteChunkObjects(bucketName, chunks)
+	}
+	return nil
+}
+
+// chunkReader reads the chunks of an upload one after the other, opening the
+// object of each chunk only when reaching it.
+type chunkReader struct {
+	store   utils.S3Ops
+	bucket  string
+	chunks  []models.UploadChunk
+	current io.ReadCloser
+	offset  int64
+}
+
+func newChunkReader(store utils.S3Ops, bucket string, chunks []models.UploadChunk) *chunkReader {
+	return &chunkReader{
+		store:  store,
+		bucket: bucket,
+		chunks: chunks,
+	}
+}
+
+func (c *chunkReader) Read(p []byte) (int, error) {
+	for {
+		if c.current == nil {
+			if len(c.chunks) == 0 {
+				return 0, io.EOF
+			}
+			if c.chunks[0].Offset != c.offset {
+				return 0, fmt.Errorf("missing chunk at offset %d", c.offset)
+			}
+
+			object, err := c.store.GetObject(c.bucket, c.chunks[0].S3ObjectKey)
+			if err != nil {
+				return 0, err
+			}
+			c.current = object
+		}
+
+		n, err := c.current.Read(p)
+		c.offset += int64(n)
+		if err == io.EOF {
+			c.current.Close()
+			c.current = nil
+			c.chunks = c.chunks[1:]
+			err = nil
+		}
+		if n > 0 || err != nil {
+			return n, err
+		}
+	}
+}
+
+func (c *chunkReader) Close() error {
+	if c.current == nil {
+		return nil
+	}
+	err := c.current.Close()
+	c.current = nil
+	return err
+}
+
+// countingReader counts the bytes read through it, and keeps the error the
+// reading failed with since blob stores do not all wrap it in theirs.
+type countingReader struct {
+	reader io.Reader
+	count  int64
+	err    error
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.reader.Read(p)
+	c.count += int64(n)
+	if err != nil && err != io.EOF {
+		c.err = err
+	}
+	return n, err
+}
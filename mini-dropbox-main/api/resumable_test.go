@@ -0,0 +1,47 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/manishlpu/assignment/models"
+)
+
+// Resumable uploads land in the folder given on creation, which must exist.
+func TestResumableUploadsToFolder(t *testing.T) {
+	ts := newTestServer(t)
+	token := ts.signup("alice")
+
+	var folder struct {
+		ID int64 `json:"id"`
+	}
+	ts.decode(ts.expect(ts.do("POST", "/api/folders", token, map[string]interface{}{"name": "docs"}), http.StatusCreated), &folder)
+
+	refused := map[int64]int{-1: http.StatusBadRequest, folder.ID + 1: http.StatusNotFound}
+	for folderID, code := range refused {
+		ts.expect(ts.do("POST", "/api/uploads", token, map[string]interface{}{"filename": "a.txt", "size_in_bytes": 10, "folder_id": folderID}), code)
+	}
+
+	var upload struct {
+		ID string `json:"id"`
+	}
+	req := map[string]interface{}{"filename": "a.txt", "size_in_bytes": 10, "folder_id": folder.ID}
+	ts.decode(ts.expect(ts.do("POST", "/api/uploads", token, req), http.StatusCreated), &upload)
+	for offset, chunk := range []string{"01234", "56789"} {
+		ts.expect(ts.do("PATCH", "/api/uploads/"+upload.ID, token, strings.NewReader(chunk), "Upload-Offset", fmt.Sprint(offset*5)), http.StatusNoContent)
+	}
+
+	var finalized struct {
+		ID int64 `json:"id"`
+	}
+	ts.decode(ts.expect(ts.do("POST", "/api/uploads/"+upload.ID+"/finalize", token, nil), http.StatusOK), &finalized)
+	ts.expect(ts.do("POST", "/api/uploads/"+upload.ID+"/finalize", token, nil), http.StatusGone)
+
+	var file models.Metadata
+	ts.decode(ts.expect(ts.do("GET", fmt.Sprintf("/api/files/%d", finalized.ID), token, nil), http.StatusOK), &file)
+	if file.FolderID != folder.ID || file.SizeInBytes != 10 || !strings.HasPrefix(getS3KeyFromURI(file.S3ObjectKey), "blobs/") {
+		t.Errorf("unexpected file: %+v", file)
+	}
+}
@@ -8,12 +8,17 @@ import (
 	"github.com/gorilla/mux"
 )
 
-func New() (*mux.Router, error) {
+func New(dh *APIHandler) (*mux.Router, error) {
 	router := mux.NewRouter()
 
 	dropboxRouter := router.PathPrefix("/api").Subrouter()
 	dropboxRouter.Use(PanicRecoveryMiddleware)
-	dropboxHandler(dropboxRouter)
+	dropboxHandler(dropboxRouter, dh)
+
+	// Share links are public, outside of the authenticated api
+	shareRouter := router.PathPrefix("/s").Subrouter()
+	shareRouter.Use(PanicRecoveryMiddleware)
+	shareRouter.HandleFunc("/{token}", dh.serveShareLink).Methods("GET", "HEAD")
 
 	// Apply the CORS middleware to all routes
 	router.Use(corsMiddleware)
@@ -34,25 +39,6 @@ func PanicRecoveryMiddleware(next http.Handler) http.Handler {
 	})
 }
 
-func DeleteInactiveRecords() error {
-	ah := NewAPIHandler()
-
-	records, err := ah.MetadataOps.FetchInactiveRecords()
-	if err != nil {
-		return err
-	}
-
-	bucketName := utils.GetEnvValue("S3_BUCKET", "assignment")
-	for _, record := range records {
-		s3Key := getS3KeyFromURI(record.S3ObjectKey)
-		if err = ah.S3Ops.DeleteObject(bucketName, s3Key); err != nil {
-			utils.ErrorLog("unable to remove the s3 object with following details: ", record)
-			continue
-		}
-	}
-	return nil
-}
-
 func corsMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		enableCors(&w)
@@ -62,6 +48,7 @@ func corsMiddleware(next http.Handler) http.Handler {
 
 func enableCors(w *http.ResponseWriter) {
 	(*w).Header().Set("Access-Control-Allow-Origin", "*")
-	(*w).Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-	(*w).Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
+	(*w).Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, PATCH, DELETE, OPTIONS")
+	(*w).Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, If-Match")
+	(*w).Header().Set("Access-Control-Expose-Headers", "ETag, X-Next-Cursor, Link")
 }
@@ -0,0 +1,169 @@
+package api
+
+import (
+	"errors"
+	"html"
+	"net/http"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/manishlpu/assignment/models"
+	"github.com/manishlpu/assignment/utils"
+)
+
+const (
+	defaultSearchLimit = 20
+	maxSearchLimit     = 100
+
+	// Number of characters of content shown around the first match
+	snippetContext = 80
+)
+
+type searchResult struct {
+	models.Metadata
+	Score float64 `json:"score"`
+	// HTML escaped fields with the matching words wrapped in <mark> tags,
+	// content being an excerpt around the first match
+	Highlights map[string]string `json:"highlights,omitempty"`
+}
+
+// Searches the files of the user by the words of their filename, description
+// and content, most relevant first.
+func (ah *APIHandler) searchFiles(w http.ResponseWriter, r *http.Request) {
+	utils.DebugLog("inside searchFiles")
+
+	terms := utils.SearchTerms(r.URL.Query().Get("q"))
+	if len(terms) == 0 {
+		writeFailure(w, http.StatusBadRequest, errors.New("q must contain at least one word"))
+		return
+	}
+
+	limit := defaultSearchLimit
+	if value := r.URL.Query().Get("limit"); value != "" {
+		var err error
+		limit, err = strconv.Atoi(value)
+		if err != nil || limit <= 0 || limit > maxSearchLimit {
+			writeFailure(w, http.StatusBadRequest, errors.New("limit must be between 1 and "+strconv.Itoa(maxSearchLimit)))
+			return
+		}
+	}
+
+	hits, err := ah.MetadataOps.SearchRecords(getRequestUser(r).ID, terms, limit)
+	if err != nil {
+		writeFailure(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	// The files come with their tags and properties, as when listed
+	records := make([]models.Metadata, len(hits))
+	for i, hit := range hits {
+		records[i] = hit.Record
+	}
+	if err := ah.MetadataOps.LoadRecordLabels(records); err != nil {
+		writeFailure(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	results := make([]searchResult, 0, len(hits))
+	for i, hit := range hits {
+		result := searchResult{
+			Metadata:   records[i],
+			Score:      hit.Score,
+			Highlights: map[string]string{},
+		}
+		for field, text := range map[string]string{
+			"filename":    hit.Record.Filename,
+			"description": hit.Record.Description,
+		} {
+			if highlighted, ok := highlightTerms(text, terms); ok {
+				result.Highlights[field] = highlighted
+			}
+		}
+		if snippet, ok := contentSnippet(hit.Content, terms); ok {
+			result.Highlights["content"] = snippet
+		}
+		results = append(results, result)
+	}
+	writeJSON(w, http.StatusOK, results)
+}
+
+// Escapes the text for HTML, wrapping the words starting with one of the terms
+// in <mark> tags. Returns whether any word matched.
+func highlightTerms(text string, terms []string) (string, bool) {
+	var b strings.Builder
+	matched := false
+
+	runes := []rune(text)
+	for start := 0; start < len(runes); {
+		end := start + 1
+		isWord := isWordRune(runes[start])
+		for end < len(runes) && isWordRune(runes[end]) == isWord {
+			end++
+		}
+
+		segment := string(runes[start:end])
+		if isWord && hasTermPrefix(strings.ToLower(segment), terms) {
+			b.WriteString("<mark>" + html.EscapeString(segment) + "</mark>")
+			matched = true
+		} else {
+			b.WriteString(html.EscapeString(segment))
+		}
+		start = end
+	}
+	return b.String(), matched
+}
+
+// Returns the highlighted excerpt of the content around its first word
+// starting with one of the terms, cut at word boundaries.
+func contentSnippet(content string, terms []string) (string, bool) {
+	runes := []rune(content)
+	match := -1
+	for i := 0; i < len(runes) && match < 0; i++ {
+		if !isWordRune(runes[i]) || (i > 0 && isWordRune(runes[i-1])) {
+			continue
+		}
+		end := i
+		for end < len(runes) && isWordRune(runes[end]) {
+			end++
+		}
+		if hasTermPrefix(strings.ToLower(string(runes[i:end])), terms) {
+			match = i
+		}
+	}
+	if match < 0 {
+		return "", false
+	}
+
+	start := max(match-snippetContext, 0)
+	for start > 0 && start < match && isWordRune(runes[start-1]) {
+		start++
+	}
+	end := min(match+snippetContext, len(runes))
+	for end < len(runes) && isWordRune(runes[end]) {
+		end++
+	}
+
+	excerpt := strings.Join(strings.Fields(string(runes[start:end])), " ")
+	snippet, _ := highlightTerms(excerpt, terms)
+	if start > 0 {
+		snippet = "…" + snippet
+	}
+	if end < len(runes) {
+		snippet += "…"
+	}
+	return snippet, true
+}
+
+func isWordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+func hasTermPrefix(word string, terms []string) bool {
+	for _, term := range terms {
+		if strings.HasPrefix(word, term) {
+			return true
+		}
+	}
+	return false
+}
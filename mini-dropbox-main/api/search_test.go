@@ -0,0 +1,26 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+)
+
+// Search hits come with the tags and properties of the files, as listed.
+func TestSearchReturnsLabels(t *testing.T) {
+	ts := newTestServer(t)
+	token := ts.signup("alice")
+	id := ts.upload(token, "report.txt", "yearly figures")
+	path := fmt.Sprintf("/api/files/%d", id)
+	ts.expect(ts.do("PUT", path+"/tags", token, map[string]interface{}{"tags": []string{"work"}}), http.StatusOK)
+	ts.expect(ts.do("PUT", path+"/properties", token, map[string]interface{}{"properties": map[string]string{"client": "acme"}}), http.StatusOK)
+
+	var results []searchResult
+	ts.decode(ts.expect(ts.do("GET", "/api/search?q=report", token, nil), http.StatusOK), &results)
+	if len(results) != 1 {
+		t.Fatalf("expected a single hit, got %+v", results)
+	}
+	if hit := results[0]; len(hit.Tags) != 1 || hit.Tags[0] != "work" || hit.Properties["client"] != "acme" {
+		t.Errorf("expected the labels of the file, got %+v", hit)
+	}
+}
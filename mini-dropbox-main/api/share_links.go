@@ -0,0 +1,301 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/manishlpu/assignment/models"
+	"github.com/manishlpu/assignment/utils"
+	"github.com/gorilla/mux"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Header carrying the password of a protected share link, which can also be
+// sent as the password of basic authentication for browsers to prompt it.
+const sharePasswordHeader = "X-Share-Password"
+
+type createShareLinkRequest struct {
+	ExpiresAt    *time.Time `json:"expires_at"`
+	Password     string     `json:"password"`
+	MaxDownloads int64      `json:"max_downloads"`
+}
+
+type shareLinkResponse struct {
+	models.ShareLink
+	URL               string `json:"url"`
+	PasswordProtected bool   `json:"password_protected"`
+}
+
+func newShareLinkResponse(r *http.Request, link models.ShareLink) shareLinkResponse {
+	return shareLinkResponse{
+		ShareLink:         link,
+		URL:               getBaseURL(r) + "/s/" + link.Token,
+		PasswordProtected: link.PasswordHash != "",
+	}
+}
+
+// Parses the unique identifier of the share link from the request path.
+func getLinkID(r *http.Request) (int64, error) {
+	linkID, err := strconv.ParseInt(mux.Vars(r)["linkID"], 10, 64)
+	if err != nil {
+		return 0, errors.New("invalid link id")
+	}
+	return linkID, nil
+}
+
+// Returns the address of the client, without its port.
+func getClientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// statusRecorder remembers the status code written to the response.
+type statusRecorder struct {
+	http.ResponseWriter
+	statusCode int
+}
+
+func (s *statusRecorder) WriteHeader(statusCode int) {
+	s.statusCode = statusCode
+	s.ResponseWriter.WriteHeader(statusCode)
+}
+
+// Creates a share link of a file, optionally expiring, protected by a
+// password or limited to a number of downloads.
+func (ah *APIHandler) createShareLink(w http.ResponseWriter, r *http.Request) {
+	utils.DebugLog("inside createShareLink")
+
+	record := ah.getActiveRecord(w, r, models.ROLE_OWNER)
+	if record == nil {
+		return
+	}
+
+	var req createShareLinkRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeFailure(w, http.StatusBadRequest, errors.New("invalid request body"))
+		return
+	}
+	if req.ExpiresAt != nil && !req.ExpiresAt.After(time.Now()) {
+		writeFailure(w, http.StatusBadRequest, errors.New("expires_at must be in the future"))
+		return
+	}
+	if req.MaxDownloads < 0 {
+		writeFailure(w, http.StatusBadRequest, errors.New("max_downloads must be positive"))
+		return
+	}
+	if len(req.Password) > 72 {
+		writeFailure(w, http.StatusBadRequest, errors.New("password must not exceed 72 characters"))
+		return
+	}
+
+	token, err := newRandomID()
+	if err != nil {
+		writeFailure(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	now := time.Now().UTC()
+	link := models.ShareLink{
+		Token:        token,
+		FileID:       record.ID,
+		OwnerID:      record.OwnerID,
+		ExpiresAt:    req.ExpiresAt,
+		MaxDownloads: req.MaxDownloads,
+		Status:       models.STATUS_ACTIVE,
+		CreatedAt:    now,
+		UpdatedAt:    now,
+	}
+	if req.Password != "" {
+		passwordHash, err := bcrypt.GenerateFromPassword([]byte(req.Password), bcrypt.DefaultCost)
+		if err != nil {
+			writeFailure(w, http.StatusInternalServerError, err)
+			return
+		}
+		link.PasswordHash = string(passwordHash)
+	}
+
+	if link.ID, err = ah.MetadataOps.CreateShareLink(link); err != nil {
+		utils.ErrorLog("Error creating share link: ", err)
+		writeFailure(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, newShareLinkResponse(r, link))
+}
+
+// Lists the active share links of a file.
+func (ah *APIHandler) listShareLinks(w http.ResponseWriter, r *http.Request) {
+	utils.DebugLog("inside listShareLinks")
+
+	record := ah.getActiveRecord(w, r, models.ROLE_OWNER)
+	if record == nil {
+		return
+	}
+
+	links, err := ah.MetadataOps.FetchShareLinks(record.OwnerID, record.ID)
+	if err != nil {
+		writeFailure(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	responses := make([]shareLinkResponse, 0, len(links))
+	for _, link := range links {
+		responses = append(responses, newShareLinkResponse(r, link))
+	}
+	writeJSON(w, http.StatusOK, responses)
+}
+
+// Revokes a share link of a file.
+func (ah *APIHandler) revokeShareLink(w http.ResponseWriter, r *http.Request) {
+	utils.DebugLog("inside revokeShareLink")
+
+	record := ah.getActiveRecord(w, r, models.ROLE_OWNER)
+	if record == nil {
+		return
+	}
+	linkID, err := getLinkID(r)
+	if err != nil {
+		writeFailure(w, http.StatusBadRequest, err)
+		return
+	}
+
+	err = ah.MetadataOps.RevokeShareLink(record.OwnerID, record.ID, linkID)
+	if errors.Is(err, utils.ErrShareLinkNotFound) {
+		writeFailure(w, http.StatusNotFound, err)
+		return
+	} else if err != nil {
+		writeFailure(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(getSuccessMessage())
+}
+
+// Lists the recorded accesses of a share link of a file, latest first.
+func (ah *APIHandler) listShareLinkAccesses(w http.ResponseWriter, r *http.Request) {
+	utils.DebugLog("inside listShareLinkAccesses")
+
+	record := ah.getActiveRecord(w, r, models.ROLE_OWNER)
+	if record == nil {
+		return
+	}
+	linkID, err := getLinkID(r)
+	if err != nil {
+		writeFailure(w, http.StatusBadRequest, err)
+		return
+	}
+
+	accesses, err := ah.MetadataOps.FetchShareLinkAccesses(record.OwnerID, record.ID, linkID)
+	if errors.Is(err, utils.ErrShareLinkNotFound) {
+		writeFailure(w, http.StatusNotFound, err)
+		return
+	} else if err != nil {
+		writeFailure(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, accesses)
+}
+
+// Streams the file of a share link to anyone knowing its token. Every access
+// is recorded along with its outcome.
+func (ah *APIHandler) serveShareLink(w http.ResponseWriter, r *http.Request) {
+	utils.DebugLog("inside serveShareLink")
+
+	link, err := ah.MetadataOps.GetShareLink(mux.Vars(r)["token"])
+	if err != nil {
+		writeFailure(w, http.StatusInternalServerError, err)
+		return
+	}
+	if link == nil {
+		writeFailure(w, http.StatusNotFound, errors.New("share link does not exist"))
+		return
+	}
+
+	recorder := &statusRecorder{ResponseWriter: w, statusCode: http.StatusOK}
+	var claimed bool
+	defer func() {
+		// Downloads serving no content are not counted, those interrupted
+		// once the content is being sent are
+		if claimed && recorder.statusCode >= http.StatusMultipleChoices {
+			if err := ah.MetadataOps.ReleaseShareLinkDownload(link.ID); err != nil {
+				utils.ErrorLog("unable to release share link download: ", link.ID, err)
+			}
+		}
+
+		userAgent := r.UserAgent()
+		if len(userAgent) > 255 {
+			userAgent = userAgent[:255]
+		}
+		err := ah.MetadataOps.RecordShareLinkAccess(models.ShareLinkAccess{
+			LinkID:     link.ID,
+			IPAddress:  getClientIP(r),
+			UserAgent:  userAgent,
+			StatusCode: recorder.statusCode,
+		})
+		if err != nil {
+			utils.ErrorLog("unable to record share link access: ", link.ID, err)
+		}
+	}()
+	claimed = ah.serveShareLinkFile(recorder, r, link)
+}
+
+// Serves the file of the link, returning whether a download was counted.
+func (ah *APIHandler) serveShareLinkFile(w http.ResponseWriter, r *http.Request, link *models.ShareLink) bool {
+	if link.Status != models.STATUS_ACTIVE {
+		writeFailure(w, http.StatusGone, errors.New("share link has been revoked"))
+		return false
+	}
+	if link.ExpiresAt != nil && time.Now().After(*link.ExpiresAt) {
+		writeFailure(w, http.StatusGone, errors.New("share link has expired"))
+		return false
+	}
+
+	if link.PasswordHash != "" {
+		password := r.Header.Get(sharePasswordHeader)
+		if _, basicPassword, ok := r.BasicAuth(); ok && password == "" {
+			password = basicPassword
+		}
+		if bcrypt.CompareHashAndPassword([]byte(link.PasswordHash), []byte(password)) != nil {
+			w.Header().Set("WWW-Authenticate", `Basic realm="share link"`)
+			writeFailure(w, http.StatusUnauthorized, errors.New("share link requires a valid password"))
+			return false
+		}
+	}
+
+	record, err := ah.MetadataOps.GetRecord(link.OwnerID, link.FileID)
+	if err != nil {
+		writeFailure(w, http.StatusInternalServerError, err)
+		return false
+	}
+	if record == nil {
+		writeFailure(w, http.StatusGone, errors.New("shared file no longer exists"))
+		return false
+	}
+
+	// Every request for the content counts as a download, whatever its range
+	if r.Method != http.MethodGet {
+		ah.serveObject(w, r, record)
+		return false
+	}
+	claimed, err := ah.MetadataOps.ClaimShareLinkDownload(link.ID)
+	if err != nil {
+		writeFailure(w, http.StatusInternalServerError, err)
+		return false
+	}
+	if !claimed {
+		writeFailure(w, http.StatusGone, errors.New("share link has reached its download limit"))
+		return false
+	}
+
+	ah.serveObject(w, r, record)
+	return true
+}
@@ -0,0 +1,151 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/manishlpu/assignment/models"
+	"github.com/manishlpu/assignment/utils"
+)
+
+const (
+	maxFileTags       = 50
+	maxFileProperties = 50
+	maxPropertyValue  = 255
+)
+
+var (
+	tagPattern      = regexp.MustCompile(`^[\p{L}\p{N}][\p{L}\p{N} _.-]{0,63}$`)
+	propertyPattern = regexp.MustCompile(`^[A-Za-z0-9_.-]{1,64}$`)
+)
+
+type setTagsRequest struct {
+	Tags []string `json:"tags"`
+}
+
+type setPropertiesRequest struct {
+	Properties map[string]string `json:"properties"`
+}
+
+// Lowercases, deduplicates and sorts the tags, failing on invalid ones.
+func normalizeTags(tags []string) ([]string, error) {
+	seen := map[string]bool{}
+	normalized := []string{}
+	for _, tag := range tags {
+		tag = strings.ToLower(strings.TrimSpace(tag))
+		if !tagPattern.MatchString(tag) {
+			return nil, errors.New("tags must be 1 to 64 letters, digits, spaces, dots, dashes or underscores")
+		}
+		if !seen[tag] {
+			seen[tag] = true
+			normalized = append(normalized, tag)
+		}
+	}
+	if len(normalized) > maxFileTags {
+		return nil, errors.New("a file cannot have more than 50 tags")
+	}
+	sort.Strings(normalized)
+	return normalized, nil
+}
+
+func validateProperties(properties map[string]string) error {
+	if len(properties) > maxFileProperties {
+		return errors.New("a file cannot have more than 50 properties")
+	}
+	for name, value := range properties {
+		if !propertyPattern.MatchString(name) {
+			return errors.New("property names must be 1 to 64 letters, digits, dots, dashes or underscores")
+		}
+		if len(value) > maxPropertyValue || !utf8.ValidString(value) {
+			return errors.New("property values must be valid text of at most 255 bytes")
+		}
+	}
+	return nil
+}
+
+// Replaces the tags of a file.
+func (ah *APIHandler) setFileTags(w http.ResponseWriter, r *http.Request) {
+	utils.DebugLog("inside setFileTags")
+
+	record := ah.getActiveRecord(w, r, models.ROLE_EDITOR)
+	if record == nil {
+		return
+	}
+	if !checkIfMatch(w, r, record) {
+		return
+	}
+
+	var req setTagsRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeFailure(w, http.StatusBadRequest, errors.New("invalid request body"))
+		return
+	}
+	tags, err := normalizeTags(req.Tags)
+	if err != nil {
+		writeFailure(w, http.StatusBadRequest, err)
+		return
+	}
+
+	err = ah.MetadataOps.SetRecordTags(record.OwnerID, record.ID, record.Revision, tags)
+	if err != nil {
+		writeFailure(w, getErrorStatusCode(err), err)
+		return
+	}
+
+	record.Revision++
+	w.Header().Set("ETag", getMetadataETag(record))
+	writeJSON(w, http.StatusOK, setTagsRequest{Tags: tags})
+}
+
+// Replaces the properties of a file.
+func (ah *APIHandler) setFileProperties(w http.ResponseWriter, r *http.Request) {
+	utils.DebugLog("inside setFileProperties")
+
+	record := ah.getActiveRecord(w, r, models.ROLE_EDITOR)
+	if record == nil {
+		return
+	}
+	if !checkIfMatch(w, r, record) {
+		return
+	}
+
+	var req setPropertiesRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeFailure(w, http.StatusBadRequest, errors.New("invalid request body"))
+		return
+	}
+	if req.Properties == nil {
+		req.Properties = map[string]string{}
+	}
+	if err := validateProperties(req.Properties); err != nil {
+		writeFailure(w, http.StatusBadRequest, err)
+		return
+	}
+
+	err := ah.MetadataOps.SetRecordProperties(record.OwnerID, record.ID, record.Revision, req.Properties)
+	if err != nil {
+		writeFailure(w, getErrorStatusCode(err), err)
+		return
+	}
+
+	record.Revision++
+	w.Header().Set("ETag", getMetadataETag(record))
+	writeJSON(w, http.StatusOK, req)
+}
+
+// Lists the tags of the user along with the number of files carrying them.
+func (ah *APIHandler) listTags(w http.ResponseWriter, r *http.Request) {
+	utils.DebugLog("inside listTags")
+
+	tags, err := ah.MetadataOps.FetchTags(getRequestUser(r).ID)
+	if err != nil {
+		writeFailure(w, http.StatusInternalServerError, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, tags)
+}
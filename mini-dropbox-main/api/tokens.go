@@ -0,0 +1,138 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/manishlpu/assignment/models"
+	"github.com/manishlpu/assignment/utils"
+)
+
+// Prefix of the API tokens, telling them apart from session tokens.
+const apiTokenPrefix = "dbx_"
+
+// Returns the scope a token needs for the request: reads need the read
+// scope, deletes the delete scope and any other change the write scope.
+func getRequiredScope(r *http.Request) string {
+	switch r.Method {
+	case http.MethodGet, http.MethodHead:
+		return models.SCOPE_READ
+	case http.MethodDelete:
+		return models.SCOPE_DELETE
+	default:
+		return models.SCOPE_WRITE
+	}
+}
+
+// Checks the scopes of a new token, dropping duplicates.
+func validateScopes(scopes []string) ([]string, error) {
+	var valid []string
+	seen := make(map[string]bool)
+	for _, scope := range scopes {
+		scope = strings.ToLower(strings.TrimSpace(scope))
+		if !isKnownScope(scope) {
+			return nil, fmt.Errorf("unknown scope %q, must be one of %s", scope, strings.Join(models.Scopes, ", "))
+		}
+		if !seen[scope] {
+			seen[scope] = true
+			valid = append(valid, scope)
+		}
+	}
+	if len(valid) == 0 {
+		return nil, fmt.Errorf("at least one scope is required")
+	}
+	return valid, nil
+}
+
+func isKnownScope(scope string) bool {
+	for _, known := range models.Scopes {
+		if scope == known {
+			return true
+		}
+	}
+	return false
+}
+
+func getUserByUsername(store utils.MetadataOps, username string) (*models.User, error) {
+	user, err := store.GetUserByUsername(strings.ToLower(strings.TrimSpace(username)))
+	if err != nil {
+		return nil, err
+	}
+	if user == nil {
+		return nil, fmt.Errorf("no user exists with username %q", username)
+	}
+	return user, nil
+}
+
+// CreateAPIToken issues a token of the user with the given scopes, valid for
+// expiry or forever when 0. The returned value is only known to the caller,
+// only its hash is stored.
+func CreateAPIToken(username, name string, scopes []string, expiry time.Duration) (string, *models.APIToken, error) {
+	if utils.IsEmptyString(name) {
+		return "", nil, fmt.Errorf("name of the token is required")
+	}
+	scopes, err := validateScopes(scopes)
+	if err != nil {
+		return "", nil, err
+	}
+
+	store, err := utils.NewMetadataStore()
+	if err != nil {
+		return "", nil, err
+	}
+	user, err := getUserByUsername(store, username)
+	if err != nil {
+		return "", nil, err
+	}
+
+	randomID, err := newRandomID()
+	if err != nil {
+		return "", nil, err
+	}
+	value := apiTokenPrefix + randomID
+
+	token := models.APIToken{
+		UserID:    user.ID,
+		Name:      name,
+		TokenHash: hashToken(value),
+		Scopes:    scopes,
+		CreatedAt: time.Now().UTC(),
+	}
+	if expiry > 0 {
+		expiresAt := token.CreatedAt.Add(expiry)
+		token.ExpiresAt = &expiresAt
+	}
+
+	if token.ID, err = store.CreateAPIToken(token); err != nil {
+		return "", nil, err
+	}
+	return value, &token, nil
+}
+
+// ListAPITokens returns the tokens of the user.
+func ListAPITokens(username string) ([]models.APIToken, error) {
+	store, err := utils.NewMetadataStore()
+	if err != nil {
+		return nil, err
+	}
+	user, err := getUserByUsername(store, username)
+	if err != nil {
+		return nil, err
+	}
+	return store.FetchAPITokens(user.ID)
+}
+
+// RevokeAPIToken deletes a token of the user, which stops being accepted.
+func RevokeAPIToken(username string, id int64) error {
+	store, err := utils.NewMetadataStore()
+	if err != nil {
+		return err
+	}
+	user, err := getUserByUsername(store, username)
+	if err != nil {
+		return err
+	}
+	return store.DeleteAPIToken(user.ID, id)
+}
@@ -0,0 +1,128 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/manishlpu/assignment/models"
+	"github.com/manishlpu/assignment/utils"
+)
+
+type trashedFileResponse struct {
+	models.Metadata
+	DeletedAt time.Time `json:"deleted_at"`
+	PurgeAt   time.Time `json:"purge_at"`
+}
+
+// Returns for how long deleted files are kept in the trash before being
+// purged, read from TRASH_RETENTION.
+func getTrashRetention() time.Duration {
+	retention, err := time.ParseDuration(utils.GetEnvValue("TRASH_RETENTION", "720h"))
+	if err != nil || retention <= 0 {
+		utils.WarnLog("invalid TRASH_RETENTION, using the default of 720h")
+		return 720 * time.Hour
+	}
+	return retention
+}
+
+// Lists the deleted files of the user, latest deleted first, along with the
+// time they get purged at.
+func (ah *APIHandler) listTrash(w http.ResponseWriter, r *http.Request) {
+	utils.DebugLog("inside listTrash")
+
+	records, err := ah.MetadataOps.FetchTrashedRecords(getRequestUser(r).ID)
+	if err != nil {
+		writeFailure(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	retention := getTrashRetention()
+	responses := make([]trashedFileResponse, 0, len(records))
+	for _, record := range records {
+		responses = append(responses, trashedFileResponse{
+			Metadata:  record,
+			DeletedAt: record.UpdatedAt,
+			PurgeAt:   record.UpdatedAt.Add(retention),
+		})
+	}
+	writeJSON(w, http.StatusOK, responses)
+}
+
+// Restores a deleted file into its folder, or into the root folder when its
+// folder was deleted as well.
+func (ah *APIHandler) restoreTrashedFile(w http.ResponseWriter, r *http.Request) {
+	utils.DebugLog("inside restoreTrashedFile")
+
+	fileID, err := getFileID(r)
+	if err != nil {
+		writeFailure(w, http.StatusBadRequest, err)
+		return
+	}
+
+	record, err := ah.MetadataOps.RestoreRecord(getRequestUser(r).ID, fileID)
+	if errors.Is(err, utils.ErrTrashedFileNotFound) {
+		writeFailure(w, http.StatusNotFound, err)
+		return
+	} else if err != nil {
+		writeFailure(w, getErrorStatusCode(err), err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, record)
+}
+
+// Permanently deletes a deleted file, without waiting for the purge.
+func (ah *APIHandler) purgeTrashedFile(w http.ResponseWriter, r *http.Request) {
+	utils.DebugLog("inside purgeTrashedFile")
+
+	fileID, err := getFileID(r)
+	if err != nil {
+		writeFailure(w, http.StatusBadRequest, err)
+		return
+	}
+
+	contentHashes, err := ah.MetadataOps.PurgeRecord(getRequestUser(r).ID, fileID)
+	if errors.Is(err, utils.ErrTrashedFileNotFound) {
+		writeFailure(w, http.StatusNotFound, err)
+		return
+	} else if err != nil {
+		writeFailure(w, http.StatusInternalServerError, err)
+		return
+	}
+	ah.deleteBlobs(contentHashes)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(getSuccessMessage())
+}
+
+// Permanently deletes all the deleted files of the user.
+func (ah *APIHandler) emptyTrash(w http.ResponseWriter, r *http.Request) {
+	utils.DebugLog("inside emptyTrash")
+
+	ownerID := getRequestUser(r).ID
+	records, err := ah.MetadataOps.FetchTrashedRecords(ownerID)
+	if err != nil {
+		writeFailure(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	purged := 0
+	for _, record := range records {
+		contentHashes, err := ah.MetadataOps.PurgeRecord(ownerID, record.ID)
+		if errors.Is(err, utils.ErrTrashedFileNotFound) {
+			// Restored or purged meanwhile
+			continue
+		} else if err != nil {
+			utils.ErrorLog("unable to purge file: ", record.ID, err)
+			writeFailure(w, http.StatusInternalServerError, err)
+			return
+		}
+		ah.deleteBlobs(contentHashes)
+		purged++
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"purged": purged,
+	})
+}
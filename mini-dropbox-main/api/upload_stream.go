@@ -0,0 +1,208 @@
+package api
+
+import (
+	"errors"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/manishlpu/assignment/models"
+	"github.com/manishlpu/assignment/utils"
+	"github.com/gorilla/mux"
+)
+
+const (
+	defaultMaxUploadSize = 5 << 30
+	// Room left around the content of a multipart upload for its form values
+	// and the headers of its parts
+	multipartOverhead = 1 << 20
+	maxFormValueSize  = 64 << 10
+	maxFormValues     = 32
+)
+
+var errUploadTooLarge = errors.New("file exceeds the maximum upload size")
+
+// Returns the size in bytes of the largest file accepted by an upload, read
+// from MAX_UPLOAD_SIZE.
+func getMaxUploadSize() int64 {
+	size, err := strconv.ParseInt(utils.GetEnvValue("MAX_UPLOAD_SIZE", strconv.Itoa(defaultMaxUploadSize)), 10, 64)
+	if err != nil || size <= 0 {
+		utils.WarnLog("invalid MAX_UPLOAD_SIZE, using the default of 5 GiB")
+		return defaultMaxUploadSize
+	}
+	return size
+}
+
+// uploadRequest is an upload whose content is yet to be read.
+type uploadRequest struct {
+	Filename    string
+	Description string
+	FolderID    string
+	Content     io.Reader
+	// Size of the content when known upfront, 0 otherwise
+	SizeInBytes int64
+}
+
+// Limits the size of the body of an upload request, failing right away when
+// its announced length is already too large.
+func limitUploadBody(w http.ResponseWriter, r *http.Request) error {
+	limit := getMaxUploadSize() + multipartOverhead
+	if r.ContentLength > limit {
+		return errUploadTooLarge
+	}
+	r.Body = http.MaxBytesReader(w, r.Body, limit)
+	return nil
+}
+
+// Reads an upload sent either as multipart/form-data, with the content in the
+// upload_file part, or as the raw body of the request, with the filename in
+// the path or the query string along with the other values. Only the form
+// values preceding the upload_file part are read, the content itself is left
+// to stream from the body.
+func readUploadRequest(r *http.Request) (*uploadRequest, error) {
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if mediaType != "multipart/form-data" {
+		query := r.URL.Query()
+		filename := mux.Vars(r)["filename"]
+		if filename == "" {
+			filename = query.Get("filename")
+		}
+		upload := &uploadRequest{
+			Filename:    filename,
+			Description: query.Get("description"),
+			FolderID:    query.Get("folder_id"),
+			Content:     r.Body,
+		}
+		if r.ContentLength > 0 {
+			upload.SizeInBytes = r.ContentLength
+		}
+		return upload, nil
+	}
+
+	reader, err := r.MultipartReader()
+	if err != nil {
+		return nil, errors.New("unable to parse form")
+	}
+	// Form values are held in memory, they are limited in number and in
+	// size altogether
+	values := url.Values{}
+	valuesSize := 0
+	for parts := 0; ; parts++ {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			return nil, errors.New("upload_file is required")
+		} else if err != nil {
+			return nil, getBodyError(err, errors.New("unable to parse form"))
+		}
+
+		if part.FormName() == "upload_file" && part.FileName() != "" {
+			return &uploadRequest{
+				Filename:    part.FileName(),
+				Description: values.Get("description"),
+				FolderID:    values.Get("folder_id"),
+				Content:     part,
+			}, nil
+		}
+
+		if parts >= maxFormValues {
+			return nil, errors.New("too many form values")
+		}
+		value, err := io.ReadAll(io.LimitReader(part, maxFormValueSize+1))
+		if err != nil {
+			return nil, getBodyError(err, errors.New("unable to parse form"))
+		}
+		if len(value) > maxFormValueSize {
+			return nil, errors.New(part.FormName() + " is too large")
+		}
+		valuesSize += len(part.FormName()) + len(value)
+		if valuesSize > multipartOverhead {
+			return nil, errors.New("form values are too large")
+		}
+		values.Add(part.FormName(), string(value))
+	}
+}
+
+// Reports bodies exceeding their limit as such, and other read failures as
+// the given error.
+func getBodyError(err, fallback error) error {
+	var maxBytesErr *http.MaxBytesError
+	if errors.As(err, &maxBytesErr) {
+		return errUploadTooLarge
+	}
+	return fallback
+}
+
+// Returns the status code matching an error of an upload.
+func getUploadStatusCode(err error) int {
+	switch {
+	case errors.Is(err, errUploadTooLarge):
+		return http.StatusRequestEntityTooLarge
+	case errors.Is(err, errDigestMismatch):
+		return http.StatusUnprocessableEntity
+	default:
+		return getErrorStatusCode(err)
+	}
+}
+
+// Streams the content into the object of the given key while hashing it, so
+// that nothing is buffered by the server. Returns the content as recorded in
+// the metadata of a file. The object is of no use once the file is recorded
+// when a blob of the same content is stored already, see discardObject.
+func (ah *APIHandler) streamObject(key string, content io.Reader, expectedDigest []byte) (models.Metadata, error) {
+	// Read one byte past the maximum size to detect larger content of
+	// unknown length
+	maxSize := getMaxUploadSize()
+	body := &countingReader{reader: io.LimitReader(content, maxSize+1)}
+	hasher := newContentHasher()
+
+	bucketName := getBucketName()
+	if err := ah.S3Ops.UploadObjectParts(bucketName, key, io.TeeReader(body, hasher)); err != nil {
+		utils.ErrorLog("Error uploading object: ", err)
+		return models.Metadata{}, getBodyError(body.err, errors.New("unable to upload object"))
+	}
+
+	contentHash := hasher.SHA256()
+	err := verifyDigest(expectedDigest, contentHash)
+	if body.count > maxSize {
+		err = errUploadTooLarge
+	}
+	if err != nil {
+		if err := ah.S3Ops.DeleteObject(bucketName, key); err != nil {
+			utils.ErrorLog("error deleting object: ", err)
+		}
+		return models.Metadata{}, err
+	}
+
+	return models.Metadata{
+		SizeInBytes: body.count,
+		S3ObjectKey: getObjectURI(key),
+		ContentHash: contentHash,
+		ContentMD5:  hasher.MD5(),
+	}, nil
+}
+
+// Checks that the folder an upload is made to exists, before any content is
+// received, writing the failure response when it does not. The folder is
+// checked again once the file is recorded.
+func (ah *APIHandler) checkUploadFolder(w http.ResponseWriter, ownerID, folderID int64) bool {
+	if folderID < 0 {
+		writeFailure(w, http.StatusBadRequest, errors.New("invalid folder_id"))
+		return false
+	}
+	if folderID == models.ROOT_FOLDER_ID {
+		return true
+	}
+
+	folder, err := ah.MetadataOps.GetFolder(ownerID, folderID)
+	if err != nil {
+		writeFailure(w, http.StatusInternalServerError, err)
+		return false
+	}
+	if folder == nil {
+		writeFailure(w, http.StatusNotFound, utils.ErrFolderNotFound)
+		return false
+	}
+	return true
+}
@@ -0,0 +1,115 @@
+package api
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/manishlpu/assignment/models"
+	"github.com/manishlpu/assignment/utils"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+)
+
+// awsBlobStore fails uploads the way the S3 client does, with an error which
+// does not unwrap to the one reading the content failed with.
+type awsBlobStore struct {
+	utils.S3Ops
+}
+
+func (s awsBlobStore) UploadObjectParts(bucket, key string, file io.Reader) error {
+	if err := s.S3Ops.UploadObjectParts(bucket, key, file); err != nil {
+		return awserr.New("ReadRequestBody", "read upload data failed", err)
+	}
+	return nil
+}
+
+func TestUploadsOverTheSizeLimitAreRefused(t *testing.T) {
+	t.Setenv("MAX_UPLOAD_SIZE", "100")
+	ts := newTestServer(t)
+	ts.ah.S3Ops = awsBlobStore{ts.ah.S3Ops}
+	token := ts.signup("alice")
+	large := strings.Repeat("x", 150)
+
+	ts.expect(ts.do("PUT", "/api/files/upload/large.txt", token, strings.NewReader(large)), http.StatusRequestEntityTooLarge)
+
+	// Without the length, the content is only found too large once read
+	r := ts.request("PUT", "/api/files/upload/large.txt", token, strings.NewReader(large))
+	r.ContentLength = -1
+	ts.expect(ts.serve(r), http.StatusRequestEntityTooLarge)
+
+	ts.expect(ts.do("POST", "/api/uploads", token, map[string]interface{}{"filename": "large.txt", "size_in_bytes": 150}), http.StatusRequestEntityTooLarge)
+	ts.upload(token, "small.txt", "small")
+}
+
+// The body of a request over its limit fails the upload as too large, even
+// when the blob store reading it does not let the error through.
+func TestStreamObjectReportsBodiesOverTheLimit(t *testing.T) {
+	ts := newTestServer(t)
+	ts.ah.S3Ops = awsBlobStore{ts.ah.S3Ops}
+
+	body := http.MaxBytesReader(httptest.NewRecorder(), io.NopCloser(strings.NewReader(strings.Repeat("x", 100))), 10)
+	if _, err := ts.ah.streamObject(newObjectKey("large.txt"), body, nil); err != errUploadTooLarge {
+		t.Errorf("expected errUploadTooLarge, got %v", err)
+	}
+}
+
+func TestChunksOverTheUploadSizeAreRefused(t *testing.T) {
+	ts := newTestServer(t)
+	ts.ah.S3Ops = awsBlobStore{ts.ah.S3Ops}
+	token := ts.signup("alice")
+
+	var upload struct {
+		ID string `json:"id"`
+	}
+	ts.decode(ts.expect(ts.do("POST", "/api/uploads", token, map[string]interface{}{"filename": "a.txt", "size_in_bytes": 10}), http.StatusCreated), &upload)
+
+	chunk := strings.Repeat("x", 20)
+	ts.expect(ts.do("PATCH", "/api/uploads/"+upload.ID, token, strings.NewReader(chunk), "Upload-Offset", "0"), http.StatusRequestEntityTooLarge)
+	r := ts.request("PATCH", "/api/uploads/"+upload.ID, token, strings.NewReader(chunk), "Upload-Offset", "0")
+	r.ContentLength = -1
+	ts.expect(ts.serve(r), http.StatusRequestEntityTooLarge)
+}
+
+func TestMultipartFormValuesAreLimited(t *testing.T) {
+	ts := newTestServer(t)
+	token := ts.signup("alice")
+
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	for i := 0; i <= maxFormValues; i++ {
+		form.WriteField(fmt.Sprintf("value%d", i), "x")
+	}
+	part, _ := form.CreateFormFile("upload_file", "a.txt")
+	part.Write([]byte("content"))
+	form.Close()
+
+	w := ts.expect(ts.do("POST", "/api/files/upload", token, &body, "Content-Type", form.FormDataContentType()), http.StatusBadRequest)
+	if !strings.Contains(w.Body.String(), "too many form values") {
+		t.Errorf("unexpected failure: %s", w.Body)
+	}
+}
+
+// The content of uploaded and updated files is stored under the blobs/
+// prefix, which presigned uploads never write to.
+func TestUploadsAreStoredAsBlobs(t *testing.T) {
+	ts := newTestServer(t)
+	token := ts.signup("alice")
+	id := ts.upload(token, "a.txt", "first")
+	path := fmt.Sprintf("/api/files/%d", id)
+
+	for _, content := range []string{"", "second"} {
+		if content != "" {
+			ts.expect(ts.do("PUT", path, token, strings.NewReader(content)), http.StatusOK)
+		}
+		var file models.Metadata
+		ts.decode(ts.expect(ts.do("GET", path, token, nil), http.StatusOK), &file)
+		if key := getS3KeyFromURI(file.S3ObjectKey); !strings.HasPrefix(key, "blobs/") {
+			t.Errorf("expected the content under blobs/, got %s", key)
+		}
+	}
+}
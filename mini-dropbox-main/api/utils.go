@@ -1,11 +1,21 @@
 package api
 
 import (
+	"crypto/rand"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"mime"
+	"net/http"
+	"path/filepath"
+	"strconv"
 	"strings"
+	"time"
 
+	"github.com/manishlpu/assignment/models"
 	"github.com/manishlpu/assignment/utils"
+	"github.com/gorilla/mux"
 )
 
 var (
@@ -27,16 +37,41 @@ func getSuccessMessage() []byte {
 }
 
 func getFailureMessage(err error) []byte {
-	// Append error to failure message
-	FAILURE_MSG["error"] = err.Error()
+	// Append error to a copy of the failure message, which handlers failing
+	// concurrently share
+	msg := make(map[string]interface{}, len(FAILURE_MSG))
+	for key, value := range FAILURE_MSG {
+		msg[key] = value
+	}
+	msg["error"] = err.Error()
 
-	data, err := json.Marshal(FAILURE_MSG)
+	data, err := json.Marshal(msg)
 	if err != nil {
 		return nil
 	}
 	return data
 }
 
+// Writes the failure message of the error with the given status code.
+func writeFailure(w http.ResponseWriter, statusCode int, err error) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+	w.Write(getFailureMessage(err))
+}
+
+// Writes the JSON encoding of data with the given status code.
+func writeJSON(w http.ResponseWriter, statusCode int, data interface{}) {
+	jsonBytes, err := json.Marshal(data)
+	if err != nil {
+		writeFailure(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+	w.Write(jsonBytes)
+}
+
 func getCustomMessage(msg map[string]interface{}) ([]byte, error) {
 	data, err := json.Marshal(msg)
 	if err != nil {
@@ -45,9 +80,112 @@ func getCustomMessage(msg map[string]interface{}) ([]byte, error) {
 	return data, nil
 }
 
+// Returns the bucket in which all the file objects are stored.
+func getBucketName() string {
+	return utils.GetEnvValue("S3_BUCKET", "dropbox_files")
+}
+
+// Returns a new unique key for an object of the given file, such as the
+// object a presigned upload is written to.
+func newObjectKey(filename string) string {
+	return filename + "_" + fmt.Sprint(time.Now().UnixNano())
+}
+
+// Returns a new unique key under the blobs/ prefix, where the content of every
+// file is stored. Clients are never granted to write there, unlike the keys of
+// presigned uploads.
+func newBlobObjectKey(filename string) string {
+	return "blobs/" + newObjectKey(filename)
+}
+
+// Returns the URI of an object, as stored in the metadata of the files.
+func getObjectURI(key string) string {
+	return fmt.Sprintf("https://%s.s3.amazonaws.com/%s", getBucketName(), key)
+}
+
 func getS3KeyFromURI(uri string) string {
-	bucketName := utils.GetEnvValue("S3_BUCKET", "bucket")
+	bucketName := getBucketName()
 
 	prefix := fmt.Sprintf("https://%s.s3.amazonaws.com/", bucketName)
 	return strings.TrimPrefix(uri, prefix)
 }
+
+// Parses the unique identifier of the file from the request path.
+func getFileID(r *http.Request) (int64, error) {
+	id := mux.Vars(r)["fileID"]
+	if utils.IsEmptyString(id) {
+		return 0, errors.New("unique id of file is required")
+	}
+	return strconv.ParseInt(id, 10, 64)
+}
+
+// Sets the headers describing the file content being sent to the client.
+func setContentHeaders(w http.ResponseWriter, record *models.Metadata) {
+	contentType := record.MimeType
+	if utils.IsEmptyString(contentType) {
+		contentType = "application/octet-stream"
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{
+		"filename": record.Filename,
+	}))
+}
+
+// Guesses the mime type of a file from the extension of its name.
+func getMimeType(filename string) string {
+	return mime.TypeByExtension(filepath.Ext(filename))
+}
+
+// Returns a random hex encoded identifier, hard to guess.
+func newRandomID() (string, error) {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buf), nil
+}
+
+// Returns the status code matching an error of the metadata store.
+func getErrorStatusCode(err error) int {
+	switch {
+	case errors.Is(err, utils.ErrNameConflict), errors.Is(err, utils.ErrFolderNotEmpty):
+		return http.StatusConflict
+	case errors.Is(err, utils.ErrFolderNotFound), errors.Is(err, utils.ErrFileNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, utils.ErrPreconditionFailed):
+		return http.StatusPreconditionFailed
+	case errors.Is(err, utils.ErrQuotaExceeded):
+		return http.StatusInsufficientStorage
+	case errors.Is(err, utils.ErrFolderCycle):
+		return http.StatusBadRequest
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// Parses the optional folder_id value of an upload, files go to the root folder by default.
+func parseFolderID(value string) (int64, error) {
+	if utils.IsEmptyString(value) {
+		return models.ROOT_FOLDER_ID, nil
+	}
+
+	folderID, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || folderID < 0 {
+		return 0, errors.New("invalid folder_id")
+	}
+	return folderID, nil
+}
+
+// Validates the name of a file or folder.
+func validateName(name string) error {
+	if utils.IsEmptyString(name) {
+		return errors.New("name is required")
+	}
+	if len(name) > 255 {
+		return errors.New("name must not exceed 255 characters")
+	}
+	if name == "." || name == ".." || strings.ContainsAny(name, "/\\\x00") {
+		return errors.New("name must not be . or .. nor contain slashes")
+	}
+	return nil
+}
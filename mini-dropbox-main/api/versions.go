@@ -0,0 +1,162 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/manishlpu/assignment/models"
+	"github.com/manishlpu/assignment/utils"
+	"github.com/gorilla/mux"
+)
+
+type versionRetentionRequest struct {
+	Versions int `json:"versions"`
+}
+
+// Returns the number of versions kept per file unless set on the file itself,
+// read from VERSION_RETENTION.
+func getDefaultVersionRetention() int {
+	retention, err := strconv.Atoi(utils.GetEnvValue("VERSION_RETENTION", "10"))
+	if err != nil || retention < 1 {
+		utils.WarnLog("invalid VERSION_RETENTION, using the default of 10")
+		return 10
+	}
+	return retention
+}
+
+// Fetches the version of the request path, writing the failure response when
+// there is none.
+func (ah *APIHandler) getRequestedVersion(w http.ResponseWriter, r *http.Request, record *models.Metadata) *models.FileVersion {
+	versionNo, err := strconv.ParseInt(mux.Vars(r)["version"], 10, 64)
+	if err != nil {
+		writeFailure(w, http.StatusBadRequest, errors.New("invalid version"))
+		return nil
+	}
+
+	version, err := ah.MetadataOps.GetVersion(record.ID, versionNo)
+	if err != nil {
+		writeFailure(w, http.StatusInternalServerError, err)
+		return nil
+	}
+	if version == nil {
+		writeFailure(w, http.StatusNotFound, errors.New("no such version of the file exists"))
+		return nil
+	}
+	return version
+}
+
+// Lists the versions of a file, latest first.
+func (ah *APIHandler) listVersions(w http.ResponseWriter, r *http.Request) {
+	utils.DebugLog("inside listVersions")
+
+	record := ah.getActiveRecord(w, r, models.ROLE_VIEWER)
+	if record == nil {
+		return
+	}
+
+	versions, err := ah.MetadataOps.FetchVersions(record.ID)
+	if err != nil {
+		writeFailure(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, versions)
+}
+
+// Streams the content of a specific version of a file.
+func (ah *APIHandler) downloadVersion(w http.ResponseWriter, r *http.Request) {
+	utils.DebugLog("inside downloadVersion")
+
+	record := ah.getActiveRecord(w, r, models.ROLE_VIEWER)
+	if record == nil {
+		return
+	}
+
+	version := ah.getRequestedVersion(w, r, record)
+	if version == nil {
+		return
+	}
+
+	metadata := version.Metadata()
+	ah.serveObject(w, r, &metadata)
+}
+
+// Makes an old version the current content of the file. The restore is
+// recorded as a new version sharing the object of the restored one.
+func (ah *APIHandler) restoreVersion(w http.ResponseWriter, r *http.Request) {
+	utils.DebugLog("inside restoreVersion")
+
+	record := ah.getActiveRecord(w, r, models.ROLE_EDITOR)
+	if record == nil {
+		return
+	}
+
+	version := ah.getRequestedVersion(w, r, record)
+	if version == nil {
+		return
+	}
+
+	// The restored version adds to the storage used, the quota is checked
+	// along with the update
+	restored := version.Metadata()
+	restored.Revision = record.Revision
+	if err := ah.MetadataOps.UpdateRecord(record.OwnerID, record.ID, restored); err != nil {
+		writeFailure(w, getErrorStatusCode(err), err)
+		return
+	}
+	go ah.pruneVersions(record)
+	go ah.indexFile(record.OwnerID, record.ID)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(getSuccessMessage())
+}
+
+// Sets the number of versions kept for a file, 0 restores the default.
+func (ah *APIHandler) setVersionRetention(w http.ResponseWriter, r *http.Request) {
+	utils.DebugLog("inside setVersionRetention")
+
+	record := ah.getActiveRecord(w, r, models.ROLE_EDITOR)
+	if record == nil {
+		return
+	}
+	if !checkIfMatch(w, r, record) {
+		return
+	}
+
+	var req versionRetentionRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Versions < 0 {
+		writeFailure(w, http.StatusBadRequest, errors.New("versions must be a positive number"))
+		return
+	}
+
+	if err := ah.MetadataOps.SetVersionRetention(record.ID, record.Revision, req.Versions); err != nil {
+		writeFailure(w, getErrorStatusCode(err), err)
+		return
+	}
+	record.VersionRetention = req.Versions
+	record.Revision++
+	w.Header().Set("ETag", getMetadataETag(record))
+	go ah.pruneVersions(record)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(getSuccessMessage())
+}
+
+// Drops the versions of the file beyond its retention, along with the blobs
+// no other version of any file refers to.
+func (ah *APIHandler) pruneVersions(record *models.Metadata) {
+	keep := record.VersionRetention
+	if keep <= 0 {
+		keep = getDefaultVersionRetention()
+	}
+
+	contentHashes, err := ah.MetadataOps.PruneVersions(record.ID, keep)
+	if err != nil {
+		utils.ErrorLog("error pruning versions of file: ", record.ID, err)
+		return
+	}
+
+	ah.deleteBlobs(contentHashes)
+}
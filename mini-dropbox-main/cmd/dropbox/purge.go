@@ -0,0 +1,39 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/manishlpu/assignment/api"
+	"github.com/manishlpu/assignment/utils"
+	"github.com/joho/godotenv"
+	"github.com/spf13/cobra"
+)
+
+func init() {
+	purgeCmd := &cobra.Command{
+		Use:   "purge",
+		Short: "Runs the purge of the files deleted beyond the trash retention once",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cmd.SilenceUsage = true
+
+			// Environment variables may also be set without the .env file
+			if err := godotenv.Load(); err != nil {
+				utils.WarnLog("unable to load .env file: ", err)
+			}
+
+			report, err := api.NewPurgeJob(api.NewAPIHandler()).Run()
+			if err != nil {
+				return err
+			}
+			if report == nil {
+				fmt.Println("Purge is running on another server")
+				return nil
+			}
+			fmt.Printf("Purged %d files, removing %d blobs of %d bytes\n", report.Files, report.Blobs, report.Bytes)
+			return nil
+		},
+	}
+
+	rootCmd.AddCommand(purgeCmd)
+}
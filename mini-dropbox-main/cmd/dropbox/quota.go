@@ -0,0 +1,100 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/manishlpu/assignment/api"
+	"github.com/manishlpu/assignment/models"
+	"github.com/manishlpu/assignment/utils"
+	"github.com/joho/godotenv"
+	"github.com/spf13/cobra"
+)
+
+func init() {
+	var username, groupName string
+
+	// Returns the type and name of the subject of the quota given by the flags
+	getSubject := func() (string, string, error) {
+		switch {
+		case username != "" && groupName != "":
+			return "", "", fmt.Errorf("only one of --user and --group can be given")
+		case username != "":
+			return models.QUOTA_USER, username, nil
+		case groupName != "":
+			return models.QUOTA_GROUP, groupName, nil
+		default:
+			return "", "", fmt.Errorf("one of --user and --group is required")
+		}
+	}
+
+	quotaCmd := &cobra.Command{
+		Use:   "quota",
+		Short: "Manages the storage quotas of the users and groups",
+		PersistentPreRun: func(cmd *cobra.Command, args []string) {
+			// Flags are valid by now, errors are not about the usage
+			cmd.SilenceUsage = true
+
+			// Environment variables may also be set without the .env file
+			if err := godotenv.Load(); err != nil {
+				utils.WarnLog("unable to load .env file: ", err)
+			}
+		},
+	}
+	quotaCmd.PersistentFlags().StringVarP(&username, "user", "u", "", "username the quota applies to")
+	quotaCmd.PersistentFlags().StringVarP(&groupName, "group", "g", "", "group whose members the quota applies to together")
+
+	var maxBytes, maxFiles int64
+	setCmd := &cobra.Command{
+		Use:   "set",
+		Short: "Sets the quota of a user or group",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			subjectType, name, err := getSubject()
+			if err != nil {
+				return err
+			}
+			if err := api.SetQuota(subjectType, name, maxBytes, maxFiles); err != nil {
+				return err
+			}
+
+			fmt.Printf("Set the quota of %s %s to %s and %s\n", subjectType, name,
+				formatLimit(maxBytes, "bytes"), formatLimit(maxFiles, "files"))
+			return nil
+		},
+	}
+	setCmd.Flags().Int64VarP(&maxBytes, "bytes", "b", 0, "bytes stored at most, unlimited when 0")
+	setCmd.Flags().Int64VarP(&maxFiles, "files", "f", 0, "files stored at most, unlimited when 0")
+
+	showCmd := &cobra.Command{
+		Use:   "show",
+		Short: "Shows the quota of a user or group along with its usage",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			subjectType, name, err := getSubject()
+			if err != nil {
+				return err
+			}
+			quota, usage, err := api.GetQuota(subjectType, name)
+			if err != nil {
+				return err
+			}
+
+			fmt.Printf("Bytes: %d used of %s\n", usage.Bytes, formatLimit(quota.MaxBytes, ""))
+			fmt.Printf("Files: %d stored of %s\n", usage.Files, formatLimit(quota.MaxFiles, ""))
+			return nil
+		},
+	}
+
+	quotaCmd.AddCommand(setCmd, showCmd)
+	rootCmd.AddCommand(quotaCmd)
+}
+
+// Formats a limit of the quota followed by its unit, if any.
+func formatLimit(limit int64, unit string) string {
+	value := "unlimited"
+	if limit > 0 {
+		value = fmt.Sprint(limit)
+	}
+	return strings.TrimSpace(value + " " + unit)
+}
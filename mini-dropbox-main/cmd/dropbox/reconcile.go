@@ -0,0 +1,58 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/manishlpu/assignment/api"
+	"github.com/manishlpu/assignment/utils"
+	"github.com/joho/godotenv"
+	"github.com/spf13/cobra"
+)
+
+func init() {
+	var repair bool
+	var grace time.Duration
+
+	reconcileCmd := &cobra.Command{
+		Use:   "reconcile",
+		Short: "Reports the files whose object is missing and the objects no file refers to",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cmd.SilenceUsage = true
+
+			// Environment variables may also be set without the .env file
+			if err := godotenv.Load(); err != nil {
+				utils.WarnLog("unable to load .env file: ", err)
+			}
+
+			report, err := api.NewReconcileJob(api.NewAPIHandler(), repair, grace).Run()
+			if err != nil {
+				return err
+			}
+			if report == nil {
+				fmt.Println("Reconcile is running on another server")
+				return nil
+			}
+
+			for _, reference := range report.MissingObjects {
+				fmt.Printf("missing object %s of %s %s\n", reference.S3ObjectKey, reference.Table, reference.ID)
+			}
+			for _, object := range report.OrphanObjects {
+				fmt.Printf("orphan object %s of %d bytes\n", object.Key, object.SizeInBytes)
+			}
+
+			action := "Found"
+			if report.Repaired {
+				action = "Removed"
+			}
+			fmt.Printf("%s %d failed uploads and %d orphan objects of %d bytes, %d objects are missing\n",
+				action, report.FailedUploads, len(report.OrphanObjects), report.OrphanBytes, len(report.MissingObjects))
+			return nil
+		},
+	}
+	reconcileCmd.Flags().BoolVar(&repair, "repair", false, "remove the failed uploads and the orphan objects")
+	reconcileCmd.Flags().DurationVar(&grace, "grace", 24*time.Hour, "leave alone the uploads and objects younger than this")
+
+	rootCmd.AddCommand(reconcileCmd)
+}
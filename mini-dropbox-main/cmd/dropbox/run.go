@@ -1,11 +1,13 @@
 package main
 
 import (
+	"log"
 	"time"
 
 	"github.com/manishlpu/assignment/api"
 	"github.com/manishlpu/assignment/utils"
 	"github.com/go-co-op/gocron"
+	"github.com/joho/godotenv"
 	"github.com/spf13/cobra"
 )
 
@@ -14,22 +16,39 @@ func init() {
 		Use:   "run",
 		Short: "Starts running the application server",
 		Run: func(cmd *cobra.Command, args []string) {
-			srv, err := NewServer()
+			// Load environment variables from the .env file
+			if err := godotenv.Load(); err != nil {
+				log.Fatalf("Error loading .env file: %v", err)
+			}
+
+			// The server and the jobs share a handler, and with it their
+			// connections
+			ah := api.NewAPIHandler()
+			srv, err := NewServer(ah)
 			if err != nil {
 				utils.ErrorLog("Error getting new server:", err)
 				return
 			}
 
+			purgeJob := api.NewPurgeJob(ah)
 			s := gocron.NewScheduler(time.Local)
 			_, _ = s.Cron("30 1 * * *").Do(func() {
 				utils.InfoLog("Cron runs at 1:30 AM every night asynchronously")
 
-				err = api.DeleteInactiveRecords()
-				if err != nil {
-					utils.ErrorLog("unable to delete records through cron job:", err)
-					return
+				if _, err := purgeJob.Run(); err != nil {
+					utils.ErrorLog("unable to purge records through cron job:", err)
+				}
+			})
+			_, _ = s.Every(1).Hour().Do(func() {
+				if err := ah.CleanupUploadSessions(); err != nil {
+					utils.ErrorLog("unable to cleanup upload sessions through cron job:", err)
+				}
+				if err := ah.CleanupSessions(); err != nil {
+					utils.ErrorLog("unable to cleanup sessions through cron job:", err)
+				}
+				if err := ah.IndexContents(); err != nil {
+					utils.ErrorLog("unable to index file contents through cron job:", err)
 				}
-
 			})
 			s.StartAsync()
 
@@ -11,16 +11,10 @@ import (
 
 	"github.com/manishlpu/assignment/api"
 	"github.com/manishlpu/assignment/utils"
-	"github.com/joho/godotenv"
 )
 
-func NewServer() (*http.Server, error) {
-	// Load environment variables from the .env file
-	if err := godotenv.Load(); err != nil {
-		log.Fatalf("Error loading .env file: %v", err)
-	}
-
-	api, err := api.New()
+func NewServer(ah *api.APIHandler) (*http.Server, error) {
+	api, err := api.New(ah)
 	if err != nil {
 		return nil, err
 	}
@@ -32,13 +26,29 @@ func NewServer() (*http.Server, error) {
 	srv := http.Server{
 		Addr:    srvAddress,
 		Handler: api,
-		// Read will Timeout after 2s if anything goes wrong.
-		ReadTimeout: time.Duration(2 * time.Second),
+		// Headers are short, a client not sending them in time is dropped.
+		ReadHeaderTimeout: 10 * time.Second,
+		// Bodies and responses are as large as the files, uploads and
+		// downloads get as long as SERVER_TRANSFER_TIMEOUT to complete.
+		ReadTimeout:  getTransferTimeout(),
+		WriteTimeout: getTransferTimeout(),
+		IdleTimeout:  2 * time.Minute,
 	}
 
 	return &srv, nil
 }
 
+// Returns how long a request may take to be read or answered, read from
+// SERVER_TRANSFER_TIMEOUT.
+func getTransferTimeout() time.Duration {
+	timeout, err := time.ParseDuration(utils.GetEnvValue("SERVER_TRANSFER_TIMEOUT", "1h"))
+	if err != nil || timeout <= 0 {
+		utils.WarnLog("invalid SERVER_TRANSFER_TIMEOUT, using the default of 1h")
+		return time.Hour
+	}
+	return timeout
+}
+
 func StartServer(srv *http.Server) {
 	log.Println("Starting Server...")
 
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/manishlpu/assignment/api"
+	"github.com/manishlpu/assignment/utils"
+	"github.com/joho/godotenv"
+	"github.com/spf13/cobra"
+)
+
+func init() {
+	var username string
+
+	tokenCmd := &cobra.Command{
+		Use:   "token",
+		Short: "Manages the API tokens of a user",
+		PersistentPreRun: func(cmd *cobra.Command, args []string) {
+			// Flags are valid by now, errors are not about the usage
+			cmd.SilenceUsage = true
+
+			// Environment variables may also be set without the .env file
+			if err := godotenv.Load(); err != nil {
+				utils.WarnLog("unable to load .env file: ", err)
+			}
+		},
+	}
+	tokenCmd.PersistentFlags().StringVarP(&username, "user", "u", "", "username owning the tokens")
+	tokenCmd.MarkPersistentFlagRequired("user")
+
+	var name, scopes string
+	var expiry time.Duration
+	createCmd := &cobra.Command{
+		Use:   "create",
+		Short: "Creates an API token, printing its value once",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			value, token, err := api.CreateAPIToken(username, name, strings.Split(scopes, ","), expiry)
+			if err != nil {
+				return err
+			}
+
+			fmt.Printf("Created token %d (%s) with scopes %s\n", token.ID, token.Name, strings.Join(token.Scopes, ","))
+			if token.ExpiresAt != nil {
+				fmt.Printf("Expires at %s\n", token.ExpiresAt.Format(time.RFC3339))
+			}
+			fmt.Println("Store it safely, it cannot be displayed again:")
+			fmt.Println(value)
+			return nil
+		},
+	}
+	createCmd.Flags().StringVarP(&name, "name", "n", "", "name describing the use of the token")
+	createCmd.Flags().StringVarP(&scopes, "scopes", "s", "read", "comma separated scopes: read, write, delete, admin")
+	createCmd.Flags().DurationVarP(&expiry, "expires-in", "e", 0, "validity of the token, e.g. 720h, never expires when 0")
+	createCmd.MarkFlagRequired("name")
+
+	listCmd := &cobra.Command{
+		Use:   "list",
+		Short: "Lists the API tokens",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			tokens, err := api.ListAPITokens(username)
+			if err != nil {
+				return err
+			}
+
+			tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+			fmt.Fprintln(tw, "ID\tNAME\tSCOPES\tEXPIRES AT\tLAST USED AT\tCREATED AT")
+			for _, token := range tokens {
+				expiresAt, lastUsedAt := "never", "never"
+				if token.ExpiresAt != nil {
+					expiresAt = token.ExpiresAt.Format(time.RFC3339)
+				}
+				if token.LastUsedAt != nil {
+					lastUsedAt = token.LastUsedAt.Format(time.RFC3339)
+				}
+				fmt.Fprintf(tw, "%d\t%s\t%s\t%s\t%s\t%s\n", token.ID, token.Name, strings.Join(token.Scopes, ","),
+					expiresAt, lastUsedAt, token.CreatedAt.Format(time.RFC3339))
+			}
+			return tw.Flush()
+		},
+	}
+
+	revokeCmd := &cobra.Command{
+		Use:   "revoke <token-id>",
+		Short: "Revokes an API token",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			id, err := strconv.ParseInt(args[0], 10, 64)
+			if err != nil {
+				return fmt.Errorf("invalid token id: %s", args[0])
+			}
+			if err := api.RevokeAPIToken(username, id); err != nil {
+				return err
+			}
+
+			fmt.Printf("Revoked token %d\n", id)
+			return nil
+		},
+	}
+
+	tokenCmd.AddCommand(createCmd, listCmd, revokeCmd)
+	rootCmd.AddCommand(tokenCmd)
+}
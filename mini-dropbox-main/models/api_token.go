@@ -0,0 +1,37 @@
+package models
+
+import "time"
+
+// Scopes granted to API tokens. The admin scope grants all the others, and
+// sessions opened by a login have every scope.
+const (
+	SCOPE_READ   = "read"
+	SCOPE_WRITE  = "write"
+	SCOPE_DELETE = "delete"
+	SCOPE_ADMIN  = "admin"
+)
+
+var Scopes = []string{SCOPE_READ, SCOPE_WRITE, SCOPE_DELETE, SCOPE_ADMIN}
+
+// APIToken is a long lived token of a user, meant for scripts and CI which
+// cannot log in interactively.
+type APIToken struct {
+	ID         int64      `db:"id" json:"id"`
+	UserID     int64      `db:"user_id" json:"user_id"`
+	Name       string     `db:"name" json:"name"`
+	TokenHash  string     `db:"token_hash" json:"-"`
+	Scopes     []string   `db:"scopes" json:"scopes"`
+	ExpiresAt  *time.Time `db:"expires_at" json:"expires_at,omitempty"`
+	LastUsedAt *time.Time `db:"last_used_at" json:"last_used_at,omitempty"`
+	CreatedAt  time.Time  `db:"created_at" json:"created_at"`
+}
+
+// HasScope checks if the token grants the scope.
+func (t APIToken) HasScope(scope string) bool {
+	for _, granted := range t.Scopes {
+		if granted == scope || granted == SCOPE_ADMIN {
+			return true
+		}
+	}
+	return false
+}
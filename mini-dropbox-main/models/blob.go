@@ -0,0 +1,15 @@
+package models
+
+import "time"
+
+// Blob is a content stored once in the blob store, however many files or
+// versions of files have that content. It is removed from the blob store once
+// no version refers to it anymore.
+type Blob struct {
+	ContentHash string    `db:"content_hash" json:"content_hash"`
+	S3ObjectKey string    `db:"s3_object_key" json:"-"`
+	SizeInBytes int64     `db:"size_in_bytes" json:"size_in_bytes"`
+	RefCount    int64     `db:"ref_count" json:"ref_count"`
+	CreatedAt   time.Time `db:"created_at" json:"created_at"`
+	UpdatedAt   time.Time `db:"updated_at" json:"updated_at"`
+}
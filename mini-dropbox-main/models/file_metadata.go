@@ -5,17 +5,25 @@ import "time"
 const (
 	STATUS_INACTIVE = iota
 	STATUS_ACTIVE
+	// Uploaded files are pending until their blob is stored, and failed when
+	// it could not be. Neither is visible to users.
+	STATUS_PENDING
+	STATUS_FAILED
 )
 
 var (
 	FileStatus_name = map[int8]string{
 		STATUS_INACTIVE: "inactive",
 		STATUS_ACTIVE:   "active",
+		STATUS_PENDING:  "pending",
+		STATUS_FAILED:   "failed",
 	}
 
 	FileStatus_value = map[string]int8{
 		"active":   STATUS_ACTIVE,
 		"inactive": STATUS_INACTIVE,
+		"pending":  STATUS_PENDING,
+		"failed":   STATUS_FAILED,
 	}
 )
 
@@ -35,7 +43,18 @@ type Metadata struct {
 	S3ObjectKey string     `db:"s3_object_key" json:"s3_object_key"`
 	Description string     `db:"description" json:"description,omitempty"`
 	MimeType    string     `db:"mime_type" json:"mime_type,omitempty"`
+	ContentHash string     `db:"content_hash" json:"sha256,omitempty"`
+	ContentMD5  string     `db:"content_md5" json:"md5,omitempty"`
 	Status      FileStatus `db:"status" json:"-"`
+	Version     int64      `db:"version" json:"version"`
+	Revision    int64      `db:"revision" json:"revision"`
+	FolderID    int64      `db:"folder_id" json:"folder_id"`
+	OwnerID     int64      `db:"owner_id" json:"owner_id"`
+	// Number of versions kept for the file, 0 uses the deployment default
+	VersionRetention int `db:"version_retention" json:"version_retention,omitempty"`
+	// User-defined labels, stored apart from the row
+	Tags       []string          `db:"-" json:"tags,omitempty"`
+	Properties map[string]string `db:"-" json:"properties,omitempty"`
 	// PrevKey     string     `db:"prev_key" json:"-"`
 	CreatedAt time.Time `db:"created_at" json:"created_at"`
 	UpdatedAt time.Time `db:"updated_at" json:"updated_at"`
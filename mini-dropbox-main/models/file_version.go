@@ -0,0 +1,37 @@
+package models
+
+import "time"
+
+// FileVersion is a snapshot of the content of a file, recorded on every upload
+// so that previous contents can be downloaded or restored.
+type FileVersion struct {
+	ID          int64     `db:"id" json:"-"`
+	FileID      int64     `db:"file_id" json:"file_id"`
+	Version     int64     `db:"version" json:"version"`
+	Filename    string    `db:"filename" json:"filename"`
+	SizeInBytes int64     `db:"size_in_bytes" json:"size_in_bytes"`
+	S3ObjectKey string    `db:"s3_object_key" json:"-"`
+	Description string    `db:"description" json:"description,omitempty"`
+	MimeType    string    `db:"mime_type" json:"mime_type,omitempty"`
+	ContentHash string    `db:"content_hash" json:"sha256,omitempty"`
+	ContentMD5  string    `db:"content_md5" json:"md5,omitempty"`
+	CreatedAt   time.Time `db:"created_at" json:"created_at"`
+}
+
+// Metadata returns the file as it was at this version.
+func (v FileVersion) Metadata() Metadata {
+	return Metadata{
+		ID:          v.FileID,
+		Filename:    v.Filename,
+		SizeInBytes: v.SizeInBytes,
+		S3ObjectKey: v.S3ObjectKey,
+		Description: v.Description,
+		MimeType:    v.MimeType,
+		ContentHash: v.ContentHash,
+		ContentMD5:  v.ContentMD5,
+		Status:      STATUS_ACTIVE,
+		Version:     v.Version,
+		CreatedAt:   v.CreatedAt,
+		UpdatedAt:   v.CreatedAt,
+	}
+}
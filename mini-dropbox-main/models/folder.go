@@ -0,0 +1,24 @@
+package models
+
+import "time"
+
+// Identifier of the root folder, which is implicit and has no row. Every user
+// has its own root folder.
+const ROOT_FOLDER_ID = 0
+
+type Folder struct {
+	ID        int64      `db:"id" json:"id"`
+	Name      string     `db:"name" json:"name"`
+	ParentID  int64      `db:"parent_id" json:"parent_id"`
+	OwnerID   int64      `db:"owner_id" json:"owner_id"`
+	Status    FileStatus `db:"status" json:"-"`
+	CreatedAt time.Time  `db:"created_at" json:"created_at"`
+	UpdatedAt time.Time  `db:"updated_at" json:"updated_at"`
+}
+
+// FolderChildren lists the content of a folder.
+type FolderChildren struct {
+	Folder  *Folder    `json:"folder,omitempty"`
+	Folders []Folder   `json:"folders"`
+	Files   []Metadata `json:"files"`
+}
@@ -0,0 +1,11 @@
+package models
+
+import "time"
+
+// Group is a named set of users, which files and folders can be shared with.
+type Group struct {
+	ID        int64     `db:"id" json:"id"`
+	Name      string    `db:"name" json:"name"`
+	OwnerID   int64     `db:"owner_id" json:"owner_id"`
+	CreatedAt time.Time `db:"created_at" json:"created_at"`
+}
@@ -0,0 +1,78 @@
+package models
+
+import "time"
+
+// Roles granted on a file or folder, each one including the rights of the
+// previous ones: viewers download, editors update and owners delete and
+// share.
+const (
+	ROLE_VIEWER = "viewer"
+	ROLE_EDITOR = "editor"
+	ROLE_OWNER  = "owner"
+)
+
+const (
+	RESOURCE_FILE   = "file"
+	RESOURCE_FOLDER = "folder"
+)
+
+const (
+	GRANTEE_USER  = "user"
+	GRANTEE_GROUP = "group"
+)
+
+var roleRanks = map[string]int{
+	ROLE_VIEWER: 1,
+	ROLE_EDITOR: 2,
+	ROLE_OWNER:  3,
+}
+
+func IsValidRole(role string) bool {
+	_, ok := roleRanks[role]
+	return ok
+}
+
+// RoleAllows checks if the role grants at least the rights of the required one.
+func RoleAllows(role, required string) bool {
+	return IsValidRole(role) && roleRanks[role] >= roleRanks[required]
+}
+
+// MaxRole returns the role granting the most rights.
+func MaxRole(a, b string) string {
+	if roleRanks[b] > roleRanks[a] {
+		return b
+	}
+	return a
+}
+
+// Permission grants a role on a file or folder to a user or a group. Roles
+// granted on a folder apply to everything inside it.
+type Permission struct {
+	ID           int64     `db:"id" json:"id"`
+	ResourceType string    `db:"resource_type" json:"resource_type"`
+	ResourceID   int64     `db:"resource_id" json:"resource_id"`
+	GranteeType  string    `db:"grantee_type" json:"grantee_type"`
+	GranteeID    int64     `db:"grantee_id" json:"grantee_id"`
+	GranteeName  string    `db:"grantee_name" json:"grantee_name"`
+	Role         string    `db:"role" json:"role"`
+	GrantedBy    int64     `db:"granted_by" json:"granted_by"`
+	CreatedAt    time.Time `db:"created_at" json:"created_at"`
+	UpdatedAt    time.Time `db:"updated_at" json:"updated_at"`
+}
+
+type SharedFile struct {
+	Metadata
+	Role string `json:"role"`
+}
+
+type SharedFolder struct {
+	Folder
+	Role string `json:"role"`
+}
+
+// SharedWithMe lists the files and folders other users shared with a user,
+// directly or through a group.
+type SharedWithMe struct {
+	Files   []SharedFile   `json:"files"`
+	Folders []SharedFolder `json:"folders"`
+}
@@ -0,0 +1,40 @@
+package models
+
+const (
+	QUOTA_USER  = "user"
+	QUOTA_GROUP = "group"
+)
+
+// States of the stored content accounted in the usage of a user. Old
+// versions and deleted files use storage until pruned or purged.
+const (
+	USAGE_CURRENT = "current"
+	USAGE_VERSION = "version"
+	USAGE_TRASH   = "trash"
+)
+
+// Quota limits the storage of a user, or of the members of a group together.
+// Zero limits are unlimited.
+type Quota struct {
+	SubjectType string `db:"subject_type" json:"subject_type"`
+	SubjectID   int64  `db:"subject_id" json:"subject_id"`
+	MaxBytes    int64  `db:"max_bytes" json:"max_bytes"`
+	MaxFiles    int64  `db:"max_files" json:"max_files"`
+}
+
+// Usage is the storage used by a user or a group: the bytes of every version
+// of their files, deleted ones included, and the number of files.
+type Usage struct {
+	Bytes int64 `json:"bytes"`
+	Files int64 `json:"files"`
+}
+
+// UsageEntry is the storage used by the versions of a given mime type and
+// state, along with the number of files they are the latest version of.
+type UsageEntry struct {
+	MimeType string `json:"mime_type"`
+	State    string `json:"state"`
+	Files    int64  `json:"files"`
+	Versions int64  `json:"versions"`
+	Bytes    int64  `json:"bytes"`
+}
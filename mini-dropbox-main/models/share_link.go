@@ -0,0 +1,29 @@
+package models
+
+import "time"
+
+// ShareLink grants anyone knowing its token the download of a file, until it
+// expires, is revoked or reaches its maximum number of downloads.
+type ShareLink struct {
+	ID            int64      `db:"id" json:"id"`
+	Token         string     `db:"token" json:"token"`
+	FileID        int64      `db:"file_id" json:"file_id"`
+	OwnerID       int64      `db:"owner_id" json:"-"`
+	PasswordHash  string     `db:"password_hash" json:"-"`
+	ExpiresAt     *time.Time `db:"expires_at" json:"expires_at,omitempty"`
+	MaxDownloads  int64      `db:"max_downloads" json:"max_downloads,omitempty"`
+	DownloadCount int64      `db:"download_count" json:"download_count"`
+	Status        FileStatus `db:"status" json:"-"`
+	CreatedAt     time.Time  `db:"created_at" json:"created_at"`
+	UpdatedAt     time.Time  `db:"updated_at" json:"updated_at"`
+}
+
+// ShareLinkAccess records an attempt to download a file through a link.
+type ShareLinkAccess struct {
+	ID         int64     `db:"id" json:"id"`
+	LinkID     int64     `db:"link_id" json:"link_id"`
+	IPAddress  string    `db:"ip_address" json:"ip_address"`
+	UserAgent  string    `db:"user_agent" json:"user_agent,omitempty"`
+	StatusCode int       `db:"status_code" json:"status_code"`
+	AccessedAt time.Time `db:"accessed_at" json:"accessed_at"`
+}
@@ -0,0 +1,9 @@
+package models
+
+// Tag labels files of its owner, along with the number of active files it is
+// attached to.
+type Tag struct {
+	ID         int64  `db:"id" json:"id"`
+	Name       string `db:"name" json:"name"`
+	UsageCount int64  `db:"usage_count" json:"usage_count"`
+}
@@ -0,0 +1,34 @@
+package models
+
+import "time"
+
+const (
+	UPLOAD_SESSION_ACTIVE = iota
+	UPLOAD_SESSION_COMPLETED
+)
+
+// UploadSession tracks a resumable upload, whose content is received in
+// chunks stored as separate objects until the upload is finalized.
+type UploadSession struct {
+	ID          string    `db:"id" json:"id"`
+	Filename    string    `db:"filename" json:"filename"`
+	Description string    `db:"description" json:"description,omitempty"`
+	SizeInBytes int64     `db:"size_in_bytes" json:"size_in_bytes"`
+	Offset      int64     `db:"upload_offset" json:"offset"`
+	S3ObjectKey string    `db:"s3_object_key" json:"-"`
+	FolderID    int64     `db:"folder_id" json:"folder_id"`
+	Status      int8      `db:"status" json:"-"`
+	FileID      int64     `db:"file_id" json:"file_id,omitempty"`
+	OwnerID     int64     `db:"owner_id" json:"-"`
+	ExpiresAt   time.Time `db:"expires_at" json:"expires_at"`
+	CreatedAt   time.Time `db:"created_at" json:"created_at"`
+	UpdatedAt   time.Time `db:"updated_at" json:"updated_at"`
+}
+
+// UploadChunk is a received part of a resumable upload.
+type UploadChunk struct {
+	SessionID   string `db:"session_id" json:"-"`
+	Offset      int64  `db:"chunk_offset" json:"offset"`
+	SizeInBytes int64  `db:"size_in_bytes" json:"size_in_bytes"`
+	S3ObjectKey string `db:"s3_object_key" json:"-"`
+}
@@ -0,0 +1,133 @@
+package utils
+
+import (
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/manishlpu/assignment/models"
+)
+
+var ErrAPITokenNotFound = errors.New("no api token exists with given id")
+
+// The last use of a token is recorded at most once per interval, to avoid a
+// write on every request.
+const apiTokenTouchInterval = time.Minute
+
+type APITokenOps interface {
+	CreateAPIToken(token models.APIToken) (int64, error)
+	FetchAPITokens(userID int64) ([]models.APIToken, error)
+	DeleteAPIToken(userID, id int64) error
+	GetAPITokenUser(tokenHash string) (*models.User, *models.APIToken, error)
+	TouchAPIToken(id int64) error
+}
+
+const apiTokenColumns = "id, user_id, name, token_hash, scopes, expires_at, last_used_at, created_at"
+
+func scanAPIToken(row interface{ Scan(...interface{}) error }) (*models.APIToken, error) {
+	var token models.APIToken
+	var scopes string
+	var expiresAt, lastUsedAt sql.NullTime
+	err := row.Scan(&token.ID, &token.UserID, &token.Name, &token.TokenHash, &scopes, &expiresAt, &lastUsedAt, &token.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	// Scopes are stored comma separated
+	token.Scopes = strings.Split(scopes, ",")
+	if expiresAt.Valid {
+		token.ExpiresAt = &expiresAt.Time
+	}
+	if lastUsedAt.Valid {
+		token.LastUsedAt = &lastUsedAt.Time
+	}
+	return &token, nil
+}
+
+// Tokens are stored by the hash of their value, which is only known to the
+// client.
+func (pdb *PersistenceDBLayer) CreateAPIToken(token models.APIToken) (int64, error) {
+	query := "INSERT INTO api_tokens (user_id, name, token_hash, scopes, expires_at) VALUES (?, ?, ?, ?, ?)"
+
+	var expiresAt interface{}
+	if token.ExpiresAt != nil {
+		expiresAt = token.ExpiresAt.UTC()
+	}
+
+	res, err := pdb.db.Exec(query, token.UserID, token.Name, token.TokenHash, strings.Join(token.Scopes, ","), expiresAt)
+	if err != nil {
+		return int64(-1), err
+	}
+	return res.LastInsertId()
+}
+
+func (pdb *PersistenceDBLayer) FetchAPITokens(userID int64) ([]models.APIToken, error) {
+	query := "SELECT " + apiTokenColumns + " FROM api_tokens WHERE user_id = ? ORDER BY id"
+
+	rows, err := pdb.db.Query(query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tokens := []models.APIToken{}
+	for rows.Next() {
+		token, err := scanAPIToken(rows)
+		if err != nil {
+			return nil, err
+		}
+		tokens = append(tokens, *token)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return tokens, nil
+}
+
+// Revokes the token of the user.
+func (pdb *PersistenceDBLayer) DeleteAPIToken(userID, id int64) error {
+	res, err := pdb.db.Exec("DELETE FROM api_tokens WHERE id = ? AND user_id = ?", id, userID)
+	if err != nil {
+		return err
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return ErrAPITokenNotFound
+	}
+	return nil
+}
+
+// Returns the token along with its user, nil when the token does not exist
+// or has expired.
+func (pdb *PersistenceDBLayer) GetAPITokenUser(tokenHash string) (*models.User, *models.APIToken, error) {
+	query := "SELECT " + apiTokenColumns + " FROM api_tokens WHERE token_hash = ? AND (expires_at IS NULL OR expires_at > ?)"
+
+	token, err := scanAPIToken(pdb.db.QueryRow(query, tokenHash, time.Now().UTC()))
+	if err == sql.ErrNoRows {
+		return nil, nil, nil
+	} else if err != nil {
+		return nil, nil, err
+	}
+
+	user, err := scanUser(pdb.db.QueryRow("SELECT "+userColumns+" FROM users WHERE id = ?", token.UserID))
+	if err == sql.ErrNoRows {
+		return nil, nil, nil
+	} else if err != nil {
+		return nil, nil, err
+	}
+	return user, token, nil
+}
+
+// Records that the token was just used.
+func (pdb *PersistenceDBLayer) TouchAPIToken(id int64) error {
+	query := "UPDATE api_tokens SET last_used_at = ? WHERE id = ? AND (last_used_at IS NULL OR last_used_at < ?)"
+
+	now := time.Now().UTC()
+	_, err := pdb.db.Exec(query, now, id, now.Add(-apiTokenTouchInterval))
+	return err
+}
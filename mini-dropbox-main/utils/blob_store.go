@@ -2,12 +2,16 @@ package utils
 
 import (
 	"errors"
+	"fmt"
 	"io"
+	"net/http"
+	"time"
 
 	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/s3"
 
 	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
 	"github.com/aws/aws-sdk-go/service/s3/s3manager"
 )
 
@@ -32,8 +36,43 @@ func NewS3Client() (S3Ops, error) {
 	}, nil
 }
 
+// NewBlobStore returns the blob store selected by the BLOB_STORE environment
+// variable: "s3" (default) or "local" for a disk backed store rooted at
+// LOCAL_STORAGE_ROOT.
+func NewBlobStore() (S3Ops, error) {
+	switch backend := GetEnvValue("BLOB_STORE", "s3"); backend {
+	case "s3":
+		return NewS3Client()
+	case "local":
+		return NewLocalBlobStore(GetEnvValue("LOCAL_STORAGE_ROOT", "storage/blobs"))
+	default:
+		return nil, fmt.Errorf("unsupported blob store: %s", backend)
+	}
+}
+
+// Returned by GetObject when the requested object does not exist.
+var ErrObjectNotFound = errors.New("object not found")
+
+// Presigner is implemented by the blob stores able to issue URLs granting
+// temporary access to an object without going through the server.
+type Presigner interface {
+	PresignGetObject(bucket, key string, expiry time.Duration) (string, error)
+	PresignPutObject(bucket, key string, expiry time.Duration) (string, error)
+}
+
+// ObjectInfo describes an object listed from the blob store.
+type ObjectInfo struct {
+	Key          string    `json:"key"`
+	SizeInBytes  int64     `json:"size_in_bytes"`
+	LastModified time.Time `json:"last_modified"`
+}
+
 type S3Ops interface {
 	DeleteObject(bucket, key string) error
+	GetObject(bucket, key string) (io.ReadCloser, error)
+	GetObjectRange(bucket, key string, offset, length int64) (io.ReadCloser, error)
+	GetObjectSize(bucket, key string) (int64, error)
+	ListObjects(bucket, prefix string, fn func(ObjectInfo) error) error
 	UploadObject(bucket, key string, file io.Reader) error
 	UploadObjectParts(bucket, key string, file io.Reader) error
 }
@@ -52,6 +91,93 @@ func (bs *blobStore) DeleteObject(bucket, key string) error {
 	return err
 }
 
+// Returns a stream of the object content, the caller must close it.
+func (bs *blobStore) GetObject(bucket, key string) (io.ReadCloser, error) {
+	input := &s3.GetObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(key),
+	}
+
+	output, err := bs.client.GetObject(input)
+	if err != nil {
+		if aerr, ok := err.(awserr.Error); ok && aerr.Code() == s3.ErrCodeNoSuchKey {
+			return nil, ErrObjectNotFound
+		}
+		return nil, err
+	}
+	return output.Body, nil
+}
+
+// Returns a stream of length bytes of the object starting at offset, a
+// negative length reads till the end of the object.
+func (bs *blobStore) GetObjectRange(bucket, key string, offset, length int64) (io.ReadCloser, error) {
+	byteRange := fmt.Sprintf("bytes=%d-", offset)
+	if length >= 0 {
+		byteRange = fmt.Sprintf("bytes=%d-%d", offset, offset+length-1)
+	}
+
+	input := &s3.GetObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(key),
+		Range:  aws.String(byteRange),
+	}
+
+	output, err := bs.client.GetObject(input)
+	if err != nil {
+		if aerr, ok := err.(awserr.Error); ok && aerr.Code() == s3.ErrCodeNoSuchKey {
+			return nil, ErrObjectNotFound
+		}
+		return nil, err
+	}
+	return output.Body, nil
+}
+
+// Returns the size in bytes of the object.
+func (bs *blobStore) GetObjectSize(bucket, key string) (int64, error) {
+	input := &s3.HeadObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(key),
+	}
+
+	output, err := bs.client.HeadObject(input)
+	if err != nil {
+		// HEAD responses carry no body, a missing key is only reported as 404
+		if aerr, ok := err.(awserr.RequestFailure); ok && aerr.StatusCode() == http.StatusNotFound {
+			return 0, ErrObjectNotFound
+		}
+		return 0, err
+	}
+	return aws.Int64Value(output.ContentLength), nil
+}
+
+// Calls fn for every object of the bucket whose key starts with the prefix,
+// stopping at the first error it returns.
+func (bs *blobStore) ListObjects(bucket, prefix string, fn func(ObjectInfo) error) error {
+	input := &s3.ListObjectsV2Input{
+		Bucket: aws.String(bucket),
+		Prefix: aws.String(prefix),
+	}
+
+	var fnErr error
+	err := bs.client.ListObjectsV2Pages(input, func(page *s3.ListObjectsV2Output, lastPage bool) bool {
+		for _, object := range page.Contents {
+			fnErr = fn(ObjectInfo{
+				Key:          aws.StringValue(object.Key),
+				SizeInBytes:  aws.Int64Value(object.Size),
+				LastModified: aws.TimeValue(object.LastModified),
+			})
+			if fnErr != nil {
+				return false
+			}
+		}
+		return true
+	})
+	if fnErr != nil {
+		return fnErr
+	}
+	return err
+}
+
 func (bs *blobStore) UploadObject(bucket, key string, file io.Reader) error {
 	// Create an uploader with the S3 client and specify the bucket and object key
 	uploader := s3manager.NewUploaderWithClient(bs.client)
@@ -85,3 +211,19 @@ func (bs *blobStore) UploadObjectParts(bucket, key string, file io.Reader) error
 
 	return err
 }
+
+func (bs *blobStore) PresignGetObject(bucket, key string, expiry time.Duration) (string, error) {
+	req, _ := bs.client.GetObjectRequest(&s3.GetObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(key),
+	})
+	return req.Presign(expiry)
+}
+
+func (bs *blobStore) PresignPutObject(bucket, key string, expiry time.Duration) (string, error) {
+	req, _ := bs.client.PutObjectRequest(&s3.PutObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(key),
+	})
+	return req.Presign(expiry)
+}
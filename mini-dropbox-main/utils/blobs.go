@@ -0,0 +1,138 @@
+package utils
+
+import (
+	"database/sql"
+
+	"github.com/manishlpu/assignment/models"
+)
+
+type BlobOps interface {
+	GetBlob(contentHash string) (*models.Blob, error)
+	FetchUnreferencedBlobs() ([]models.Blob, error)
+	ClaimBlob(contentHash string) (*models.Blob, error)
+}
+
+const blobColumns = "content_hash, s3_object_key, size_in_bytes, ref_count, created_at, updated_at"
+
+func scanBlob(row interface{ Scan(...interface{}) error }) (*models.Blob, error) {
+	var blob models.Blob
+	err := row.Scan(&blob.ContentHash, &blob.S3ObjectKey, &blob.SizeInBytes, &blob.RefCount, &blob.CreatedAt, &blob.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &blob, nil
+}
+
+// Returns the blob of the content, including when no version refers to it
+// anymore as long as it is not claimed.
+func (pdb *PersistenceDBLayer) GetBlob(contentHash string) (*models.Blob, error) {
+	query := "SELECT " + blobColumns + " FROM blobs WHERE content_hash = ?"
+
+	blob, err := scanBlob(pdb.db.QueryRow(query, contentHash))
+	if err == sql.ErrNoRows {
+		// No blob of the given content, not an error.
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	return blob, nil
+}
+
+// Returns the blobs no version refers to anymore, whose objects are yet to be
+// removed from the blob store.
+func (pdb *PersistenceDBLayer) FetchUnreferencedBlobs() ([]models.Blob, error) {
+	rows, err := pdb.db.Query("SELECT " + blobColumns + " FROM blobs WHERE ref_count <= 0")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var blobs []models.Blob
+	for rows.Next() {
+		blob, err := scanBlob(rows)
+		if err != nil {
+			return nil, err
+		}
+		blobs = append(blobs, *blob)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return blobs, nil
+}
+
+// Removes the blob of the content if no version refers to it, in which case
+// the caller is in charge of removing its object from the blob store. Returns
+// nil when the blob is referenced again or claimed by someone else.
+func (pdb *PersistenceDBLayer) ClaimBlob(contentHash string) (*models.Blob, error) {
+	pdb.Lock()
+	defer pdb.Unlock()
+
+	tx, err := pdb.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	blob, err := scanBlob(tx.QueryRow("SELECT "+blobColumns+" FROM blobs WHERE content_hash = ? AND ref_count <= 0", contentHash))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	res, err := tx.Exec("DELETE FROM blobs WHERE content_hash = ? AND ref_count <= 0", contentHash)
+	if err != nil {
+		return nil, err
+	}
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return nil, err
+	}
+	if affected == 0 {
+		return nil, nil
+	}
+	return blob, tx.Commit()
+}
+
+// Adds a reference to the blob of the content of the record, recording the
+// blob on its first reference. Blobs left without reference are referenced
+// again as long as they are not claimed. The record is pointed at the object
+// of the blob, which differs from the one it was uploaded to when the same
+// content was recorded meanwhile.
+func retainBlob(tx *sql.Tx, record *models.Metadata) error {
+	res, err := tx.Exec("UPDATE blobs SET ref_count = ref_count + 1, updated_at = CURRENT_TIMESTAMP WHERE content_hash = ?", record.ContentHash)
+	if err != nil {
+		return err
+	}
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if affected == 0 {
+		insertSQL := "INSERT INTO blobs (content_hash, s3_object_key, size_in_bytes, ref_count) VALUES (?, ?, ?, 1)"
+		_, err := tx.Exec(insertSQL, record.ContentHash, record.S3ObjectKey, record.SizeInBytes)
+		return err
+	}
+	return tx.QueryRow("SELECT s3_object_key FROM blobs WHERE content_hash = ?", record.ContentHash).Scan(&record.S3ObjectKey)
+}
+
+// Drops a reference to the blob of the content. Blobs left without reference
+// are kept until claimed, so that their objects are still removed when the
+// removal gets interrupted. Returns whether no reference is left.
+func releaseBlob(tx *sql.Tx, contentHash string) (bool, error) {
+	_, err := tx.Exec("UPDATE blobs SET ref_count = ref_count - 1, updated_at = CURRENT_TIMESTAMP WHERE content_hash = ?", contentHash)
+	if err != nil {
+		return false, err
+	}
+
+	var unreferenced bool
+	err = tx.QueryRow("SELECT 1 FROM blobs WHERE content_hash = ? AND ref_count <= 0", contentHash).Scan(&unreferenced)
+	if err == sql.ErrNoRows {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+	return true, nil
+}
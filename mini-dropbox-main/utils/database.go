@@ -3,9 +3,7 @@ package utils
 import (
 	"context"
 	"database/sql"
-	"errors"
 	"fmt"
-	"log"
 	"sync"
 	"time"
 
@@ -16,16 +14,67 @@ import (
 type PersistenceDBLayer struct {
 	db *sql.DB
 	sync.Mutex
+	// Words left out of the FULLTEXT indexes of MySQL
+	fullText fullTextSettings
 }
 
 type MetadataOps interface {
-	Exists(id int64) (bool, error)
+	Exists(ownerID, id int64) (bool, error)
 	SaveRecord(record models.Metadata) (int64, error)
-	UpdateRecord(id int64, record models.Metadata) error
-	FetchRecords() ([]models.Metadata, error)
-	GetRecord(id int64) (*models.Metadata, error)
-	DeactivateRecord(id int64) error
-	FetchInactiveRecords() ([]models.Metadata, error)
+	UpdateRecord(ownerID, id int64, record models.Metadata) error
+	FetchRecords(ownerID int64, opts FileListOptions) ([]models.Metadata, error)
+	GetRecord(ownerID, id int64) (*models.Metadata, error)
+	DeactivateRecord(ownerID, id, revision int64) error
+	FetchInactiveRecords(before time.Time) ([]models.Metadata, error)
+	UploadSessionOps
+	VersionOps
+	FolderOps
+	UserOps
+	APITokenOps
+	ShareLinkOps
+	GroupOps
+	PermissionOps
+	BlobOps
+	TrashOps
+	JobLockOps
+	SearchOps
+	ContentIndexOps
+	TagOps
+	FilePatchOps
+	PendingRecordOps
+	ReconcileOps
+	QuotaOps
+	PresignedUploadOps
+}
+
+// NewMetadataStore returns the metadata store selected by the METADATA_DRIVER
+// environment variable: "mysql" (default) or "sqlite" for an embedded database
+// file at METADATA_SQLITE_PATH.
+func NewMetadataStore() (MetadataOps, error) {
+	switch driver := GetEnvValue("METADATA_DRIVER", "mysql"); driver {
+	case "mysql":
+		return NewPersistenceDBLayer()
+	case "sqlite":
+		return NewSQLiteDBLayer(GetEnvValue("METADATA_SQLITE_PATH", "storage/metadata.db"))
+	default:
+		return nil, fmt.Errorf("unsupported metadata driver: %s", driver)
+	}
+}
+
+// Columns of file_metadata scanned by scanMetadata.
+const metadataColumns = "id, filename, size_in_bytes, s3_object_key, description, mime_type, content_hash, content_md5, version, revision, version_retention, folder_id, owner_id, created_at, updated_at"
+
+func scanMetadata(row interface{ Scan(...interface{}) error }) (*models.Metadata, error) {
+	var metadata models.Metadata
+	err := row.Scan(
+		&metadata.ID, &metadata.Filename, &metadata.SizeInBytes, &metadata.S3ObjectKey, &metadata.Description,
+		&metadata.MimeType, &metadata.ContentHash, &metadata.ContentMD5, &metadata.Version, &metadata.Revision, &metadata.VersionRetention, &metadata.FolderID,
+		&metadata.OwnerID, &metadata.CreatedAt, &metadata.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &metadata, nil
 }
 
 func NewPersistenceDBLayer() (MetadataOps, error) {
@@ -51,18 +100,30 @@ func NewPersistenceDBLayer() (MetadataOps, error) {
 		return nil, err
 	}
 
+	if err := migrateMySQL(db); err != nil {
+		ErrorLog("could not apply mysql schema: ", err)
+		db.Close()
+		return nil, err
+	}
+
+	fullText, err := loadFullTextSettings(db)
+	if err != nil {
+		WarnLog("could not read the mysql full-text settings, using the defaults: ", err)
+	}
+
 	return &PersistenceDBLayer{
-		db: db,
+		db:       db,
+		fullText: fullText,
 	}, nil
 }
 
-func (pdb *PersistenceDBLayer) Exists(id int64) (bool, error) {
+func (pdb *PersistenceDBLayer) Exists(ownerID, id int64) (bool, error) {
 	// Query to check if a record with the given ID exists
-	query := "SELECT 1 FROM file_metadata WHERE id = ? AND status = 1 LIMIT 1"
+	query := "SELECT 1 FROM file_metadata WHERE id = ? AND owner_id = ? AND status = 1 LIMIT 1"
 
 	// Execute the query with the target ID
 	var exists bool
-	err := pdb.db.QueryRow(query, id).Scan(&exists)
+	err := pdb.db.QueryRow(query, id, ownerID).Scan(&exists)
 
 	// Check for errors
 	if err == sql.ErrNoRows {
@@ -73,36 +134,94 @@ func (pdb *PersistenceDBLayer) Exists(id int64) (bool, error) {
 	return exists, nil
 }
 
-// Insert a new metadata record into the database
+// Insert a new metadata record into the database, along with its first version.
 func (pdb *PersistenceDBLayer) SaveRecord(record models.Metadata) (int64, error) {
-	_, cancel := context.WithTimeout(context.Background(), 2*time.Second)
-	defer cancel()
+	pdb.Lock()
+	defer pdb.Unlock()
+
+	tx, err := pdb.db.Begin()
+	if err != nil {
+		return int64(-1), err
+	}
+	defer tx.Rollback()
+
+	id, err := saveRecord(tx, record)
+	if err != nil {
+		return int64(-1), err
+	}
+	return id, tx.Commit()
+}
+
+// Inserts the record along with its first version within the transaction.
+func saveRecord(tx *sql.Tx, record models.Metadata) (int64, error) {
+	// Names are unique within a folder
+	if err := checkFolderExists(tx, record.OwnerID, record.FolderID); err != nil {
+		return int64(-1), err
+	}
+	if err := checkNameAvailable(tx, record.OwnerID, record.FolderID, record.Filename, 0, 0); err != nil {
+		return int64(-1), err
+	}
+	if err := checkQuota(tx, record.OwnerID, record.SizeInBytes, 1); err != nil {
+		return int64(-1), err
+	}
+	if err := retainBlob(tx, &record); err != nil {
+		return int64(-1), err
+	}
 
 	// Insert new metadata into the "file_metadata" table.
-	stmt, err := pdb.db.Prepare("INSERT INTO file_metadata (filename, size_in_bytes, s3_object_key, description, mime_type, status) VALUES (?, ?, ?, ?, ?, ?)")
+	insertSQL := "INSERT INTO file_metadata (filename, size_in_bytes, s3_object_key, description, mime_type, content_hash, content_md5, status, version, folder_id, owner_id) VALUES (?, ?, ?, ?, ?, ?, ?, ?, 1, ?, ?)"
+	res, err := tx.Exec(insertSQL, record.Filename, record.SizeInBytes, record.S3ObjectKey, record.Description, record.MimeType, record.ContentHash, record.ContentMD5, record.Status, record.FolderID, record.OwnerID)
 	if err != nil {
 		return int64(-1), err
 	}
-	defer stmt.Close()
 
-	pdb.Lock()
-	defer pdb.Unlock()
-	// Execute the SQL statement to insert the new row
-	res, err := stmt.Exec(record.Filename, record.SizeInBytes, record.S3ObjectKey, record.Description, record.MimeType, record.Status)
+	id, err := res.LastInsertId()
 	if err != nil {
 		return int64(-1), err
 	}
 
-	return res.LastInsertId()
+	if err := insertVersion(tx, id, 1, record); err != nil {
+		return int64(-1), err
+	}
+	return id, nil
 }
 
-// Update an existing metadata row in the database.
-func (pdb *PersistenceDBLayer) UpdateRecord(id int64, record models.Metadata) error {
-	// Replace with your update statement
-	updateSQL := "UPDATE file_metadata SET filename = ?, size_in_bytes = ?, s3_object_key = ?, mime_type = ?, description = ? WHERE id = ? AND status = 1"
+// Update an existing metadata row in the database. The content is recorded as
+// a new version of the file, previous versions are kept.
+func (pdb *PersistenceDBLayer) UpdateRecord(ownerID, id int64, record models.Metadata) error {
+	pdb.Lock()
+	defer pdb.Unlock()
+
+	tx, err := pdb.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// The file may be renamed, names are unique within its folder
+	var folderID int64
+	err = tx.QueryRow("SELECT folder_id FROM file_metadata WHERE id = ? AND owner_id = ? AND status = 1", id, ownerID).Scan(&folderID)
+	if err == sql.ErrNoRows {
+		return ErrFileNotFound
+	} else if err != nil {
+		return err
+	}
+	if err := checkNameAvailable(tx, ownerID, folderID, record.Filename, 0, id); err != nil {
+		return err
+	}
+	// Previous versions are kept, the new one adds to the storage used
+	if err := checkQuota(tx, ownerID, record.SizeInBytes, 0); err != nil {
+		return err
+	}
+	if err := retainBlob(tx, &record); err != nil {
+		return err
+	}
+
+	updateSQL := "UPDATE file_metadata SET filename = ?, size_in_bytes = ?, s3_object_key = ?, mime_type = ?, description = ?, content_hash = ?, content_md5 = ?, version = version + 1, revision = revision + 1, updated_at = CURRENT_TIMESTAMP WHERE id = ? AND owner_id = ? AND status = 1 AND revision = ?"
 
-	// Execute the update statement
-	result, err := pdb.db.Exec(updateSQL, record.Filename, record.SizeInBytes, record.S3ObjectKey, record.MimeType, record.Description, id)
+	// Execute the update statement, which only applies to the revision of the
+	// file the update is based on
+	result, err := tx.Exec(updateSQL, record.Filename, record.SizeInBytes, record.S3ObjectKey, record.MimeType, record.Description, record.ContentHash, record.ContentMD5, id, ownerID, record.Revision)
 	if err != nil {
 		return err
 	}
@@ -113,35 +232,52 @@ func (pdb *PersistenceDBLayer) UpdateRecord(id int64, record models.Metadata) er
 		return err
 	}
 
-	if rowsAffected > 0 {
-		InfoLog("Row updated successfully with id: ", id)
-	} else {
-		WarnLog("No rows were updated for ID ", id)
+	if rowsAffected == 0 {
+		return ErrPreconditionFailed
 	}
+
+	var version int64
+	if err := tx.QueryRow("SELECT version FROM file_metadata WHERE id = ?", id).Scan(&version); err != nil {
+		return err
+	}
+	if err := insertVersion(tx, id, version, record); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	InfoLog("Row updated successfully with id: ", id)
 	return nil
 }
 
-// Returns all the active metadata records from Database.
-func (pdb *PersistenceDBLayer) FetchRecords() ([]models.Metadata, error) {
-	// Query to retrieve records with "filename" and "description" fields.
-	query := "SELECT id, filename, size_in_bytes, s3_object_key, description, mime_type, created_at, updated_at FROM file_metadata WHERE status = 1"
+// Returns a page of the active files of the owner, selected and sorted by the
+// options.
+func (pdb *PersistenceDBLayer) FetchRecords(ownerID int64, opts FileListOptions) ([]models.Metadata, error) {
+	where, orderBy, args := opts.clauses()
+	query := "SELECT " + metadataColumns + " FROM file_metadata WHERE owner_id = ? AND status = 1" + where + orderBy
+	args = append([]interface{}{ownerID}, args...)
+	if opts.Limit > 0 {
+		query += " LIMIT ?"
+		args = append(args, opts.Limit)
+	}
 
 	// Execute the query and retrieve the results.
-	rows, err := pdb.db.Query(query)
+	rows, err := pdb.db.Query(query, args...)
 	if err != nil {
-		log.Fatal(err)
+		return nil, err
 	}
 	defer rows.Close()
 
 	// Iterate through the rows and store results in a slice of File structs.
 	var files []models.Metadata
 	for rows.Next() {
-		var file models.Metadata
-		if err := rows.Scan(&file.ID, &file.Filename, &file.SizeInBytes, &file.S3ObjectKey, &file.Description, &file.MimeType, &file.CreatedAt, &file.UpdatedAt); err != nil {
+		file, err := scanMetadata(rows)
+		if err != nil {
 			ErrorLog("unable to get file metadata")
 			continue
 		}
-		files = append(files, file)
+		files = append(files, *file)
 	}
 	if err := rows.Err(); err != nil {
 		return nil, err
@@ -150,16 +286,12 @@ func (pdb *PersistenceDBLayer) FetchRecords() ([]models.Metadata, error) {
 	return files, nil
 }
 
-func (pdb *PersistenceDBLayer) GetRecord(id int64) (*models.Metadata, error) {
+func (pdb *PersistenceDBLayer) GetRecord(ownerID, id int64) (*models.Metadata, error) {
 	// Query to fetch the metadata associated with the given identifier.
-	query := "SELECT id, filename, size_in_bytes, s3_object_key, description, mime_type, created_at, updated_at FROM file_metadata WHERE id = ? AND status = 1"
+	query := "SELECT " + metadataColumns + " FROM file_metadata WHERE id = ? AND owner_id = ? AND status = 1"
 
 	// Execute the query with the primary key value
-	var metadata models.Metadata
-	err := pdb.db.QueryRow(query, id).Scan(
-		&metadata.ID, &metadata.Filename, &metadata.SizeInBytes, &metadata.S3ObjectKey,
-		&metadata.Description, &metadata.MimeType, &metadata.CreatedAt, &metadata.UpdatedAt,
-	)
+	metadata, err := scanMetadata(pdb.db.QueryRow(query, id, ownerID))
 
 	// Check for errors
 	if err == sql.ErrNoRows {
@@ -169,15 +301,23 @@ func (pdb *PersistenceDBLayer) GetRecord(id int64) (*models.Metadata, error) {
 		return nil, err
 	}
 
-	return &metadata, nil
+	return metadata, nil
 }
 
-func (pdb *PersistenceDBLayer) DeactivateRecord(id int64) error {
-	query := "UPDATE file_metadata SET status = 0 WHERE id =?"
+// Soft deletes the active file, provided it is still at the given revision
+// unless the revision is 0. Fails with ErrFileNotFound when the file is not
+// active, such as when deleted already.
+func (pdb *PersistenceDBLayer) DeactivateRecord(ownerID, id, revision int64) error {
+	query := "UPDATE file_metadata SET status = 0, revision = revision + 1, updated_at = CURRENT_TIMESTAMP WHERE id = ? AND owner_id = ? AND status = 1"
+	args := []interface{}{id, ownerID}
+	if revision > 0 {
+		query += " AND revision = ?"
+		args = append(args, revision)
+	}
 	pdb.Lock()
 	defer pdb.Unlock()
 
-	res, err := pdb.db.Exec(query, id)
+	res, err := pdb.db.Exec(query, args...)
 	if err != nil {
 		return err
 	}
@@ -187,20 +327,25 @@ func (pdb *PersistenceDBLayer) DeactivateRecord(id int64) error {
 		return err
 	}
 	if affected == 0 {
-		return errors.New("no rows affected")
+		exists, err := pdb.Exists(ownerID, id)
+		if err != nil {
+			return err
+		}
+		if exists {
+			return ErrPreconditionFailed
+		}
+		return ErrFileNotFound
 	}
-	return err
+	return nil
 }
 
-func (pdb *PersistenceDBLayer) FetchInactiveRecords() ([]models.Metadata, error) {
-	// Calculate the date 30 days ago
-	thirtyDaysAgo := time.Now().AddDate(0, 0, -30).Format("2006-01-02 15:04:05")
-
-	// Query to delete rows with status = 1 and updatedAt < 30 days ago
-	query := "SELECT id, filename, s3_object_key, status, created_at updated_at FROM file_metadata WHERE status = 0 AND updatedAt < " + thirtyDaysAgo
+// Returns the records deleted before the given time.
+func (pdb *PersistenceDBLayer) FetchInactiveRecords(before time.Time) ([]models.Metadata, error) {
+	// Query to fetch rows with status = 0 and updated_at before the given time
+	query := "SELECT id, filename, s3_object_key, status, created_at, updated_at FROM file_metadata WHERE status = 0 AND updated_at < ?"
 
 	// Execute the query and retrieve the results.
-	rows, err := pdb.db.Query(query)
+	rows, err := pdb.db.Query(query, before.UTC())
 	if err != nil {
 		return nil, err
 	}
@@ -0,0 +1,65 @@
+package utils
+
+import (
+	"github.com/manishlpu/assignment/models"
+)
+
+// ContentIndexOps stores the text extracted from the content of files, which
+// is searched along with their filename and description.
+type ContentIndexOps interface {
+	SaveRecordContent(fileID int64, sourceHash, content string) error
+	FetchUnindexedRecords(afterID int64, limit int) ([]models.Metadata, error)
+}
+
+// Records the text extracted from the content of the file, replacing the text
+// of its previous content. Nothing is recorded when the content of the file
+// was replaced meanwhile, the newer content being indexed on its own.
+func (pdb *PersistenceDBLayer) SaveRecordContent(fileID int64, sourceHash, content string) error {
+	pdb.Lock()
+	defer pdb.Unlock()
+
+	tx, err := pdb.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// The text of the newer content is kept when the content was replaced
+	deleteSQL := "DELETE FROM file_contents WHERE file_id = ? AND EXISTS (SELECT 1 FROM file_metadata WHERE id = ? AND content_hash = ?)"
+	if _, err := tx.Exec(deleteSQL, fileID, fileID, sourceHash); err != nil {
+		return err
+	}
+
+	insertSQL := "INSERT INTO file_contents (file_id, source_hash, content) SELECT id, ?, ? FROM file_metadata WHERE id = ? AND content_hash = ?"
+	if _, err := tx.Exec(insertSQL, sourceHash, content, fileID, sourceHash); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// Returns active files whose current content has not been indexed yet, by
+// increasing id from the given one excluded.
+func (pdb *PersistenceDBLayer) FetchUnindexedRecords(afterID int64, limit int) ([]models.Metadata, error) {
+	query := "SELECT " + metadataColumns + " FROM file_metadata WHERE status = 1 AND id > ? AND NOT EXISTS" +
+		" (SELECT 1 FROM file_contents WHERE file_id = file_metadata.id AND source_hash = file_metadata.content_hash)" +
+		" ORDER BY id LIMIT ?"
+
+	rows, err := pdb.db.Query(query, afterID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var files []models.Metadata
+	for rows.Next() {
+		file, err := scanMetadata(rows)
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, *file)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return files, nil
+}
@@ -0,0 +1,143 @@
+package utils
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/manishlpu/assignment/models"
+)
+
+// Columns files can be listed by, keyed by the name clients sort with.
+var FileSortColumns = map[string]string{
+	"name":       "filename",
+	"size":       "size_in_bytes",
+	"created_at": "created_at",
+	"updated_at": "updated_at",
+}
+
+const timestampLayout = "2006-01-02 15:04:05"
+
+// Formats the time the way timestamps are stored, to the second, so that
+// stored timestamps compare equal to it on every driver.
+func formatTimestamp(t time.Time) string {
+	return t.UTC().Format(timestampLayout)
+}
+
+// FileCursor points after a file in a listing sorted by Sort, by the value of
+// the sort column for the file and its id breaking ties. Files inserted or
+// updated meanwhile do not shift the following pages.
+type FileCursor struct {
+	Sort       string `json:"s"`
+	Descending bool   `json:"d,omitempty"`
+	Value      string `json:"v"`
+	ID         int64  `json:"id"`
+}
+
+// FileListOptions selects the page of files listed by FetchRecords. Zero
+// values leave a filter out.
+type FileListOptions struct {
+	Sort          string
+	Descending    bool
+	MimeType      string // exact type, or a prefix such as "image/*"
+	MinSize       int64
+	MaxSize       int64
+	CreatedAfter  time.Time
+	CreatedBefore time.Time
+	UpdatedAfter  time.Time
+	UpdatedBefore time.Time
+	Tags          []string          // files carrying every tag
+	Properties    map[string]string // files having every property set to the value
+	After         *FileCursor
+	Limit         int
+}
+
+// Returns the cursor of the page following the given file.
+func (opts FileListOptions) CursorAfter(file models.Metadata) *FileCursor {
+	cursor := &FileCursor{Sort: opts.Sort, Descending: opts.Descending, ID: file.ID}
+	switch opts.Sort {
+	case "name":
+		cursor.Value = file.Filename
+	case "size":
+		cursor.Value = strconv.FormatInt(file.SizeInBytes, 10)
+	case "updated_at":
+		cursor.Value = formatTimestamp(file.UpdatedAt)
+	default:
+		cursor.Value = formatTimestamp(file.CreatedAt)
+	}
+	return cursor
+}
+
+// Builds the WHERE and ORDER BY clauses of the listing, along with their
+// arguments.
+func (opts FileListOptions) clauses() (string, string, []interface{}) {
+	var conditions []string
+	var args []interface{}
+
+	if opts.MimeType != "" {
+		if prefix, ok := strings.CutSuffix(opts.MimeType, "*"); ok {
+			conditions = append(conditions, "mime_type LIKE ?")
+			args = append(args, prefix+"%")
+		} else {
+			conditions = append(conditions, "mime_type = ?")
+			args = append(args, opts.MimeType)
+		}
+	}
+	if opts.MinSize > 0 {
+		conditions = append(conditions, "size_in_bytes >= ?")
+		args = append(args, opts.MinSize)
+	}
+	if opts.MaxSize > 0 {
+		conditions = append(conditions, "size_in_bytes <= ?")
+		args = append(args, opts.MaxSize)
+	}
+	for _, filter := range []struct {
+		condition string
+		t         time.Time
+	}{
+		{"created_at >= ?", opts.CreatedAfter},
+		{"created_at <= ?", opts.CreatedBefore},
+		{"updated_at >= ?", opts.UpdatedAfter},
+		{"updated_at <= ?", opts.UpdatedBefore},
+	} {
+		if !filter.t.IsZero() {
+			conditions = append(conditions, filter.condition)
+			args = append(args, formatTimestamp(filter.t))
+		}
+	}
+
+	for _, tag := range opts.Tags {
+		conditions = append(conditions, "id IN (SELECT file_id FROM file_tags JOIN tags ON tags.id = file_tags.tag_id WHERE tags.name = ?)")
+		args = append(args, tag)
+	}
+	for name, value := range opts.Properties {
+		conditions = append(conditions, "id IN (SELECT file_id FROM file_properties WHERE name = ? AND value = ?)")
+		args = append(args, name, value)
+	}
+
+	column, ok := FileSortColumns[opts.Sort]
+	if !ok {
+		column = FileSortColumns["created_at"]
+	}
+	direction, comparison := "ASC", ">"
+	if opts.Descending {
+		direction, comparison = "DESC", "<"
+	}
+
+	if opts.After != nil {
+		var value interface{} = opts.After.Value
+		if opts.Sort == "size" {
+			size, _ := strconv.ParseInt(opts.After.Value, 10, 64)
+			value = size
+		}
+		conditions = append(conditions, "("+column+" "+comparison+" ? OR ("+column+" = ? AND id "+comparison+" ?))")
+		args = append(args, value, value, opts.After.ID)
+	}
+
+	var where string
+	if len(conditions) > 0 {
+		where = " AND " + strings.Join(conditions, " AND ")
+	}
+	orderBy := " ORDER BY " + column + " " + direction + ", id " + direction
+	return where, orderBy, args
+}
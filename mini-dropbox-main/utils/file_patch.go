@@ -0,0 +1,96 @@
+package utils
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/manishlpu/assignment/models"
+)
+
+var ErrPreconditionFailed = errors.New("file was modified meanwhile")
+
+// FilePatch lists the metadata of a file to change, nil fields being left as
+// they are.
+type FilePatch struct {
+	Filename    *string
+	MimeType    *string
+	Description *string
+	FolderID    *int64
+	Tags        *[]string
+}
+
+type FilePatchOps interface {
+	PatchRecord(record *models.Metadata, patch FilePatch) error
+}
+
+// Applies the patch to the metadata of the file, leaving its content as it is.
+// The record is the file as read before, the patch failing with
+// ErrPreconditionFailed when the file was changed meanwhile. The record is
+// updated along with the file.
+func (pdb *PersistenceDBLayer) PatchRecord(record *models.Metadata, patch FilePatch) error {
+	pdb.Lock()
+	defer pdb.Unlock()
+
+	tx, err := pdb.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	updated := *record
+	if patch.Filename != nil {
+		updated.Filename = *patch.Filename
+	}
+	if patch.MimeType != nil {
+		updated.MimeType = *patch.MimeType
+	}
+	if patch.Description != nil {
+		updated.Description = *patch.Description
+	}
+	if patch.FolderID != nil {
+		updated.FolderID = *patch.FolderID
+		if err := checkFolderExists(tx, record.OwnerID, updated.FolderID); err != nil {
+			return err
+		}
+	}
+	if updated.FolderID != record.FolderID || !strings.EqualFold(updated.Filename, record.Filename) {
+		if err := checkNameAvailable(tx, record.OwnerID, updated.FolderID, updated.Filename, 0, record.ID); err != nil {
+			return err
+		}
+	}
+
+	updateSQL := "UPDATE file_metadata SET filename = ?, mime_type = ?, description = ?, folder_id = ?, revision = revision + 1, updated_at = CURRENT_TIMESTAMP" +
+		" WHERE id = ? AND owner_id = ? AND status = 1 AND revision = ?"
+	res, err := tx.Exec(updateSQL, updated.Filename, updated.MimeType, updated.Description, updated.FolderID,
+		record.ID, record.OwnerID, record.Revision)
+	if err != nil {
+		return err
+	}
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return ErrPreconditionFailed
+	}
+
+	if patch.Tags != nil {
+		if err := setRecordTags(tx, record.OwnerID, record.ID, *patch.Tags); err != nil {
+			return err
+		}
+		updated.Tags = *patch.Tags
+	}
+
+	query := "SELECT " + metadataColumns + " FROM file_metadata WHERE id = ?"
+	current, err := scanMetadata(tx.QueryRow(query, record.ID))
+	if err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	current.Tags, current.Properties = updated.Tags, updated.Properties
+	*record = *current
+	return nil
+}
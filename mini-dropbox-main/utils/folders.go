@@ -0,0 +1,307 @@
+package utils
+
+import (
+	"database/sql"
+	"errors"
+	"strings"
+
+	"github.com/manishlpu/assignment/models"
+)
+
+var (
+	ErrNameConflict   = errors.New("an item with the same name already exists in the folder")
+	ErrFolderNotFound = errors.New("no folder exists with given id")
+	ErrFolderNotEmpty = errors.New("folder is not empty")
+	ErrFolderCycle    = errors.New("folder cannot be moved inside itself")
+)
+
+type FolderOps interface {
+	CreateFolder(folder models.Folder) (int64, error)
+	GetFolder(ownerID, id int64) (*models.Folder, error)
+	UpdateFolder(ownerID, id int64, name string, parentID int64) error
+	DeleteFolder(ownerID, id int64, recursive bool) error
+	FetchFolderChildren(ownerID, id int64) ([]models.Folder, []models.Metadata, error)
+	ResolvePath(ownerID int64, segments []string) (*models.Folder, *models.Metadata, error)
+}
+
+const folderColumns = "id, name, parent_id, owner_id, status, created_at, updated_at"
+
+func scanFolder(row interface{ Scan(...interface{}) error }) (*models.Folder, error) {
+	var folder models.Folder
+	err := row.Scan(&folder.ID, &folder.Name, &folder.ParentID, &folder.OwnerID, &folder.Status, &folder.CreatedAt, &folder.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &folder, nil
+}
+
+// Queries of the helpers below run either on the database or a transaction.
+type queryer interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
+
+// Checks that no other active folder or file of the parent folder has the
+// name, ignoring case. The ids of the item being renamed are excluded.
+func checkNameAvailable(q queryer, ownerID, parentID int64, name string, folderID, fileID int64) error {
+	query := "SELECT 1 FROM folders WHERE owner_id = ? AND parent_id = ? AND LOWER(name) = ? AND status = 1 AND id <> ? " +
+		"UNION ALL SELECT 1 FROM file_metadata WHERE owner_id = ? AND folder_id = ? AND LOWER(filename) = ? AND status = 1 AND id <> ? LIMIT 1"
+
+	lowerName := strings.ToLower(name)
+	var taken bool
+	err := q.QueryRow(query, ownerID, parentID, lowerName, folderID, ownerID, parentID, lowerName, fileID).Scan(&taken)
+	if err == sql.ErrNoRows {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	return ErrNameConflict
+}
+
+// Checks that the folder of the owner exists and is active, the root folder
+// always does.
+func checkFolderExists(q queryer, ownerID, id int64) error {
+	if id == models.ROOT_FOLDER_ID {
+		return nil
+	}
+
+	var exists bool
+	err := q.QueryRow("SELECT 1 FROM folders WHERE id = ? AND owner_id = ? AND status = 1", id, ownerID).Scan(&exists)
+	if err == sql.ErrNoRows {
+		return ErrFolderNotFound
+	}
+	return err
+}
+
+func (pdb *PersistenceDBLayer) CreateFolder(folder models.Folder) (int64, error) {
+	pdb.Lock()
+	defer pdb.Unlock()
+
+	tx, err := pdb.db.Begin()
+	if err != nil {
+		return int64(-1), err
+	}
+	defer tx.Rollback()
+
+	if err := checkFolderExists(tx, folder.OwnerID, folder.ParentID); err != nil {
+		return int64(-1), err
+	}
+	if err := checkNameAvailable(tx, folder.OwnerID, folder.ParentID, folder.Name, 0, 0); err != nil {
+		return int64(-1), err
+	}
+
+	res, err := tx.Exec("INSERT INTO folders (name, parent_id, owner_id, status) VALUES (?, ?, ?, 1)", folder.Name, folder.ParentID, folder.OwnerID)
+	if err != nil {
+		return int64(-1), err
+	}
+
+	id, err := res.LastInsertId()
+	if err != nil {
+		return int64(-1), err
+	}
+	return id, tx.Commit()
+}
+
+func (pdb *PersistenceDBLayer) GetFolder(ownerID, id int64) (*models.Folder, error) {
+	query := "SELECT " + folderColumns + " FROM folders WHERE id = ? AND owner_id = ? AND status = 1"
+
+	folder, err := scanFolder(pdb.db.QueryRow(query, id, ownerID))
+	if err == sql.ErrNoRows {
+		// No folder found with the given identifier, not an error.
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	return folder, nil
+}
+
+// Renames the folder and moves it under the parent folder.
+func (pdb *PersistenceDBLayer) UpdateFolder(ownerID, id int64, name string, parentID int64) error {
+	pdb.Lock()
+	defer pdb.Unlock()
+
+	tx, err := pdb.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := checkFolderExists(tx, ownerID, id); err != nil {
+		return err
+	}
+	if err := checkFolderExists(tx, ownerID, parentID); err != nil {
+		return err
+	}
+
+	// Walk up from the new parent, the folder must not be one of its ancestors
+	for ancestor := parentID; ancestor != models.ROOT_FOLDER_ID; {
+		if ancestor == id {
+			return ErrFolderCycle
+		}
+		if err := tx.QueryRow("SELECT parent_id FROM folders WHERE id = ?", ancestor).Scan(&ancestor); err != nil {
+			return err
+		}
+	}
+
+	if err := checkNameAvailable(tx, ownerID, parentID, name, id, 0); err != nil {
+		return err
+	}
+
+	updateSQL := "UPDATE folders SET name = ?, parent_id = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ?"
+	if _, err := tx.Exec(updateSQL, name, parentID, id); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// Soft deletes the folder. A folder with content is only deleted when
+// recursive, in which case all the folders and files below it are deleted.
+func (pdb *PersistenceDBLayer) DeleteFolder(ownerID, id int64, recursive bool) error {
+	pdb.Lock()
+	defer pdb.Unlock()
+
+	tx, err := pdb.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := checkFolderExists(tx, ownerID, id); err != nil {
+		return err
+	}
+
+	// Collect the folder and all its descendants, level by level
+	folderIDs := []int64{id}
+	for level := []int64{id}; len(level) > 0; {
+		var next []int64
+		for _, parentID := range level {
+			children, err := queryIDs(tx, "SELECT id FROM folders WHERE parent_id = ? AND status = 1", parentID)
+			if err != nil {
+				return err
+			}
+			next = append(next, children...)
+		}
+		folderIDs = append(folderIDs, next...)
+		level = next
+	}
+
+	if !recursive {
+		var hasFiles bool
+		err := tx.QueryRow("SELECT 1 FROM file_metadata WHERE folder_id = ? AND status = 1 LIMIT 1", id).Scan(&hasFiles)
+		if err != nil && err != sql.ErrNoRows {
+			return err
+		}
+		if hasFiles || len(folderIDs) > 1 {
+			return ErrFolderNotEmpty
+		}
+	}
+
+	for _, folderID := range folderIDs {
+		if _, err := tx.Exec("UPDATE file_metadata SET status = 0, revision = revision + 1, updated_at = CURRENT_TIMESTAMP WHERE folder_id = ? AND status = 1", folderID); err != nil {
+			return err
+		}
+		if _, err := tx.Exec("UPDATE folders SET status = 0, updated_at = CURRENT_TIMESTAMP WHERE id = ?", folderID); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// Returns the active folders and files directly inside the folder.
+func (pdb *PersistenceDBLayer) FetchFolderChildren(ownerID, id int64) ([]models.Folder, []models.Metadata, error) {
+	if err := checkFolderExists(pdb.db, ownerID, id); err != nil {
+		return nil, nil, err
+	}
+
+	rows, err := pdb.db.Query("SELECT "+folderColumns+" FROM folders WHERE owner_id = ? AND parent_id = ? AND status = 1 ORDER BY name", ownerID, id)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+
+	folders := []models.Folder{}
+	for rows.Next() {
+		folder, err := scanFolder(rows)
+		if err != nil {
+			return nil, nil, err
+		}
+		folders = append(folders, *folder)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, nil, err
+	}
+
+	fileRows, err := pdb.db.Query("SELECT "+metadataColumns+" FROM file_metadata WHERE owner_id = ? AND folder_id = ? AND status = 1 ORDER BY filename", ownerID, id)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer fileRows.Close()
+
+	files := []models.Metadata{}
+	for fileRows.Next() {
+		file, err := scanMetadata(fileRows)
+		if err != nil {
+			return nil, nil, err
+		}
+		files = append(files, *file)
+	}
+	if err := fileRows.Err(); err != nil {
+		return nil, nil, err
+	}
+
+	return folders, files, nil
+}
+
+// Resolves a path from the root folder to either a folder or a file. Nothing
+// is returned when the path does not exist, an empty path is the root folder.
+func (pdb *PersistenceDBLayer) ResolvePath(ownerID int64, segments []string) (*models.Folder, *models.Metadata, error) {
+	folder := &models.Folder{ID: models.ROOT_FOLDER_ID, OwnerID: ownerID}
+	for i, segment := range segments {
+		child, err := scanFolder(pdb.db.QueryRow(
+			"SELECT "+folderColumns+" FROM folders WHERE owner_id = ? AND parent_id = ? AND LOWER(name) = ? AND status = 1",
+			ownerID, folder.ID, strings.ToLower(segment),
+		))
+		if err == nil {
+			folder = child
+			continue
+		} else if err != sql.ErrNoRows {
+			return nil, nil, err
+		}
+
+		// Only the last segment of the path may name a file
+		if i < len(segments)-1 {
+			return nil, nil, nil
+		}
+
+		file, err := scanMetadata(pdb.db.QueryRow(
+			"SELECT "+metadataColumns+" FROM file_metadata WHERE owner_id = ? AND folder_id = ? AND LOWER(filename) = ? AND status = 1",
+			ownerID, folder.ID, strings.ToLower(segment),
+		))
+		if err == sql.ErrNoRows {
+			return nil, nil, nil
+		} else if err != nil {
+			return nil, nil, err
+		}
+		return nil, file, nil
+	}
+	return folder, nil, nil
+}
+
+func queryIDs(q queryer, query string, args ...interface{}) ([]int64, error) {
+	rows, err := q.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []int64
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
@@ -0,0 +1,290 @@
+package utils
+
+import (
+	"database/sql"
+	"errors"
+
+	"github.com/manishlpu/assignment/models"
+)
+
+var (
+	ErrGroupNameTaken     = errors.New("group name is already taken")
+	ErrGroupNotFound      = errors.New("no group exists with given id")
+	ErrInvitationNotFound = errors.New("no invitation to the group exists for the user")
+)
+
+type GroupOps interface {
+	CreateGroup(group models.Group) (int64, error)
+	GetGroup(id int64) (*models.Group, error)
+	GetGroupByName(name string) (*models.Group, error)
+	FetchUserGroups(userID int64) ([]models.Group, error)
+	DeleteGroup(id int64) error
+	InviteGroupMember(groupID, userID int64) error
+	FetchGroupInvitations(userID int64) ([]models.Group, error)
+	AcceptGroupInvitation(groupID, userID int64) error
+	DeclineGroupInvitation(groupID, userID int64) error
+	RemoveGroupMember(groupID, userID int64) error
+	FetchGroupMembers(groupID int64) ([]models.User, error)
+	IsGroupMember(groupID, userID int64) (bool, error)
+}
+
+const groupColumns = "id, name, owner_id, created_at"
+
+func scanGroup(row interface{ Scan(...interface{}) error }) (*models.Group, error) {
+	var group models.Group
+	if err := row.Scan(&group.ID, &group.Name, &group.OwnerID, &group.CreatedAt); err != nil {
+		return nil, err
+	}
+	return &group, nil
+}
+
+// Creates the group, its owner being its first member.
+func (pdb *PersistenceDBLayer) CreateGroup(group models.Group) (int64, error) {
+	pdb.Lock()
+	defer pdb.Unlock()
+
+	tx, err := pdb.db.Begin()
+	if err != nil {
+		return int64(-1), err
+	}
+	defer tx.Rollback()
+
+	var taken bool
+	err = tx.QueryRow("SELECT 1 FROM user_groups WHERE name = ?", group.Name).Scan(&taken)
+	if err == nil {
+		return int64(-1), ErrGroupNameTaken
+	} else if err != sql.ErrNoRows {
+		return int64(-1), err
+	}
+
+	res, err := tx.Exec("INSERT INTO user_groups (name, owner_id) VALUES (?, ?)", group.Name, group.OwnerID)
+	if err != nil {
+		return int64(-1), err
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return int64(-1), err
+	}
+
+	if _, err := tx.Exec("INSERT INTO group_members (group_id, user_id) VALUES (?, ?)", id, group.OwnerID); err != nil {
+		return int64(-1), err
+	}
+	return id, tx.Commit()
+}
+
+func (pdb *PersistenceDBLayer) GetGroup(id int64) (*models.Group, error) {
+	group, err := scanGroup(pdb.db.QueryRow("SELECT "+groupColumns+" FROM user_groups WHERE id = ?", id))
+	if err == sql.ErrNoRows {
+		// No group found with the given identifier, not an error.
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	return group, nil
+}
+
+func (pdb *PersistenceDBLayer) GetGroupByName(name string) (*models.Group, error) {
+	group, err := scanGroup(pdb.db.QueryRow("SELECT "+groupColumns+" FROM user_groups WHERE name = ?", name))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	return group, nil
+}
+
+// Returns the groups the user is a member of.
+func (pdb *PersistenceDBLayer) FetchUserGroups(userID int64) ([]models.Group, error) {
+	query := "SELECT g.id, g.name, g.owner_id, g.created_at FROM user_groups g " +
+		"JOIN group_members m ON m.group_id = g.id WHERE m.user_id = ? ORDER BY g.name"
+	return pdb.fetchGroups(query, userID)
+}
+
+// Returns the groups the user is invited to.
+func (pdb *PersistenceDBLayer) FetchGroupInvitations(userID int64) ([]models.Group, error) {
+	query := "SELECT g.id, g.name, g.owner_id, g.created_at FROM user_groups g " +
+		"JOIN group_invitations i ON i.group_id = g.id WHERE i.user_id = ? ORDER BY g.name"
+	return pdb.fetchGroups(query, userID)
+}
+
+func (pdb *PersistenceDBLayer) fetchGroups(query string, args ...interface{}) ([]models.Group, error) {
+	rows, err := pdb.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	groups := []models.Group{}
+	for rows.Next() {
+		group, err := scanGroup(rows)
+		if err != nil {
+			return nil, err
+		}
+		groups = append(groups, *group)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return groups, nil
+}
+
+// Deletes the group along with its members, its invitations and the
+// permissions granted to it.
+func (pdb *PersistenceDBLayer) DeleteGroup(id int64) error {
+	tx, err := pdb.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec("DELETE FROM permissions WHERE grantee_type = ? AND grantee_id = ?", models.GRANTEE_GROUP, id); err != nil {
+		return err
+	}
+	if _, err := tx.Exec("DELETE FROM group_invitations WHERE group_id = ?", id); err != nil {
+		return err
+	}
+	if _, err := tx.Exec("DELETE FROM group_members WHERE group_id = ?", id); err != nil {
+		return err
+	}
+
+	res, err := tx.Exec("DELETE FROM user_groups WHERE id = ?", id)
+	if err != nil {
+		return err
+	}
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return ErrGroupNotFound
+	}
+	return tx.Commit()
+}
+
+// Invites the user to the group, nothing changes when already a member or
+// invited. Users only become members, sharing the quota of the group, once
+// they accept.
+func (pdb *PersistenceDBLayer) InviteGroupMember(groupID, userID int64) error {
+	pdb.Lock()
+	defer pdb.Unlock()
+
+	tx, err := pdb.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var exists bool
+	query := "SELECT 1 FROM group_members WHERE group_id = ? AND user_id = ?" +
+		" UNION ALL SELECT 1 FROM group_invitations WHERE group_id = ? AND user_id = ?"
+	err = tx.QueryRow(query, groupID, userID, groupID, userID).Scan(&exists)
+	if err == nil {
+		return nil
+	} else if err != sql.ErrNoRows {
+		return err
+	}
+
+	if _, err := tx.Exec("INSERT INTO group_invitations (group_id, user_id) VALUES (?, ?)", groupID, userID); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// Makes the user a member of the group it is invited to.
+func (pdb *PersistenceDBLayer) AcceptGroupInvitation(groupID, userID int64) error {
+	pdb.Lock()
+	defer pdb.Unlock()
+
+	tx, err := pdb.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	res, err := tx.Exec("DELETE FROM group_invitations WHERE group_id = ? AND user_id = ?", groupID, userID)
+	if err != nil {
+		return err
+	}
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return ErrInvitationNotFound
+	}
+
+	if _, err := tx.Exec("INSERT INTO group_members (group_id, user_id) VALUES (?, ?)", groupID, userID); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (pdb *PersistenceDBLayer) DeclineGroupInvitation(groupID, userID int64) error {
+	res, err := pdb.db.Exec("DELETE FROM group_invitations WHERE group_id = ? AND user_id = ?", groupID, userID)
+	if err != nil {
+		return err
+	}
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return ErrInvitationNotFound
+	}
+	return nil
+}
+
+// Removes the user from the group, or withdraws its invitation.
+func (pdb *PersistenceDBLayer) RemoveGroupMember(groupID, userID int64) error {
+	pdb.Lock()
+	defer pdb.Unlock()
+
+	tx, err := pdb.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec("DELETE FROM group_invitations WHERE group_id = ? AND user_id = ?", groupID, userID); err != nil {
+		return err
+	}
+	if _, err := tx.Exec("DELETE FROM group_members WHERE group_id = ? AND user_id = ?", groupID, userID); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (pdb *PersistenceDBLayer) FetchGroupMembers(groupID int64) ([]models.User, error) {
+	query := "SELECT u.id, u.username, u.password_hash, u.created_at, u.updated_at FROM users u " +
+		"JOIN group_members m ON m.user_id = u.id WHERE m.group_id = ? ORDER BY u.username"
+
+	rows, err := pdb.db.Query(query, groupID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	users := []models.User{}
+	for rows.Next() {
+		user, err := scanUser(rows)
+		if err != nil {
+			return nil, err
+		}
+		users = append(users, *user)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return users, nil
+}
+
+func (pdb *PersistenceDBLayer) IsGroupMember(groupID, userID int64) (bool, error) {
+	var member bool
+	err := pdb.db.QueryRow("SELECT 1 FROM group_members WHERE group_id = ? AND user_id = ?", groupID, userID).Scan(&member)
+	if err == sql.ErrNoRows {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+	return true, nil
+}
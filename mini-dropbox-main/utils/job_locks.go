@@ -0,0 +1,47 @@
+package utils
+
+import (
+	"database/sql"
+	"time"
+)
+
+// JobLockOps provides locks through which scheduled jobs run on a single
+// server at a time, when several servers share the metadata store.
+type JobLockOps interface {
+	AcquireJobLock(name, holder string, ttl time.Duration) (bool, error)
+	ReleaseJobLock(name, holder string) error
+}
+
+// Acquires the lock of the job for the holder until the ttl elapses, or
+// extends it when the holder has it already. Returns false when another holder
+// has the lock. Locks left by holders that crashed are taken over once expired.
+func (pdb *PersistenceDBLayer) AcquireJobLock(name, holder string, ttl time.Duration) (bool, error) {
+	now := time.Now().UTC()
+	expiresAt := now.Add(ttl)
+
+	updateSQL := "UPDATE job_locks SET holder = ?, expires_at = ? WHERE name = ? AND (holder = ? OR expires_at < ?)"
+	if _, err := pdb.db.Exec(updateSQL, holder, expiresAt, name, holder, now); err != nil {
+		return false, err
+	}
+
+	var current string
+	err := pdb.db.QueryRow("SELECT holder FROM job_locks WHERE name = ?", name).Scan(&current)
+	if err == sql.ErrNoRows {
+		_, err = pdb.db.Exec("INSERT INTO job_locks (name, holder, expires_at) VALUES (?, ?, ?)", name, holder, expiresAt)
+		if err == nil {
+			return true, nil
+		}
+		// Another holder inserted the lock meanwhile
+		err = pdb.db.QueryRow("SELECT holder FROM job_locks WHERE name = ?", name).Scan(&current)
+	}
+	if err != nil {
+		return false, err
+	}
+	return current == holder, nil
+}
+
+// Releases the lock of the job, unless another holder has taken it over.
+func (pdb *PersistenceDBLayer) ReleaseJobLock(name, holder string) error {
+	_, err := pdb.db.Exec("DELETE FROM job_locks WHERE name = ? AND holder = ?", name, holder)
+	return err
+}
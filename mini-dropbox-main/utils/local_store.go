@@ -0,0 +1,220 @@
+package utils
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Prefix of the temporary files created while an object is being written.
+// Such files are never visible as objects of the store.
+const localTempPrefix = ".upload-"
+
+type localBlobStore struct {
+	root string
+}
+
+// NewLocalBlobStore returns a disk backed implementation of S3Ops which stores
+// every object as a regular file at <root>/<bucket>/<key>.
+func NewLocalBlobStore(root string) (S3Ops, error) {
+	absRoot, err := filepath.Abs(root)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := os.MkdirAll(absRoot, 0755); err != nil {
+		ErrorLog("could not create local blob store root: ", err)
+		return nil, err
+	}
+
+	return &localBlobStore{
+		root: absRoot,
+	}, nil
+}
+
+// Resolves the path of an object on disk, rejecting keys that would escape
+// the bucket directory.
+func (ls *localBlobStore) objectPath(bucket, key string) (string, error) {
+	if !filepath.IsLocal(bucket) || !filepath.IsLocal(key) {
+		return "", errors.New("invalid bucket or object key")
+	}
+	return filepath.Join(ls.root, bucket, key), nil
+}
+
+func (ls *localBlobStore) DeleteObject(bucket, key string) error {
+	path, err := ls.objectPath(bucket, key)
+	if err != nil {
+		return err
+	}
+
+	// Deleting a missing object is not an error, same as S3.
+	if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	DebugLog("Local object is deleted successfully. Key:", key)
+
+	return nil
+}
+
+func (ls *localBlobStore) openObject(bucket, key string) (*os.File, error) {
+	path, err := ls.objectPath(bucket, key)
+	if err != nil {
+		return nil, err
+	}
+
+	file, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, ErrObjectNotFound
+	} else if err != nil {
+		return nil, err
+	}
+	return file, nil
+}
+
+// Returns a stream of the object content, the caller must close it.
+func (ls *localBlobStore) GetObject(bucket, key string) (io.ReadCloser, error) {
+	file, err := ls.openObject(bucket, key)
+	if err != nil {
+		return nil, err
+	}
+	return file, nil
+}
+
+// Returns a stream of length bytes of the object starting at offset, a
+// negative length reads till the end of the object.
+func (ls *localBlobStore) GetObjectRange(bucket, key string, offset, length int64) (io.ReadCloser, error) {
+	file, err := ls.openObject(bucket, key)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := file.Seek(offset, io.SeekStart); err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	if length < 0 {
+		return file, nil
+	}
+	return &limitedReadCloser{io.LimitReader(file, length), file}, nil
+}
+
+// Returns the size in bytes of the object.
+func (ls *localBlobStore) GetObjectSize(bucket, key string) (int64, error) {
+	path, err := ls.objectPath(bucket, key)
+	if err != nil {
+		return 0, err
+	}
+
+	info, err := os.Stat(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return 0, ErrObjectNotFound
+	} else if err != nil {
+		return 0, err
+	}
+	return info.Size(), nil
+}
+
+// Calls fn for every object of the bucket whose key starts with the prefix,
+// stopping at the first error it returns. Objects being written are skipped.
+func (ls *localBlobStore) ListObjects(bucket, prefix string, fn func(ObjectInfo) error) error {
+	dir, err := ls.objectPath(bucket, ".")
+	if err != nil {
+		return err
+	}
+
+	return filepath.WalkDir(dir, func(path string, entry fs.DirEntry, err error) error {
+		// Objects deleted meanwhile, or a bucket nothing was written to yet
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		if entry.IsDir() || strings.HasPrefix(entry.Name(), localTempPrefix) {
+			return nil
+		}
+
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		key := filepath.ToSlash(rel)
+		if !strings.HasPrefix(key, prefix) {
+			return nil
+		}
+
+		info, err := entry.Info()
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		return fn(ObjectInfo{Key: key, SizeInBytes: info.Size(), LastModified: info.ModTime()})
+	})
+}
+
+func (ls *localBlobStore) UploadObject(bucket, key string, file io.Reader) error {
+	path, err := ls.objectPath(bucket, key)
+	if err != nil {
+		return err
+	}
+
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+
+	// Write into a temp file of the same directory and rename it once the
+	// content is flushed, so a crash never leaves a half written object.
+	tmp, err := os.CreateTemp(dir, localTempPrefix+"*")
+	if err != nil {
+		return err
+	}
+	tmpName := tmp.Name()
+
+	if _, err := io.Copy(tmp, file); err != nil {
+		tmp.Close()
+		os.Remove(tmpName)
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		os.Remove(tmpName)
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmpName)
+		return err
+	}
+
+	if err := os.Rename(tmpName, path); err != nil {
+		os.Remove(tmpName)
+		return err
+	}
+
+	return syncDir(dir)
+}
+
+// Parts are only meaningful for S3, the local store writes the whole object at once.
+func (ls *localBlobStore) UploadObjectParts(bucket, key string, file io.Reader) error {
+	return ls.UploadObject(bucket, key, file)
+}
+
+// Flushes the directory entry so that a completed rename survives a crash.
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+
+	return d.Sync()
+}
+
+type limitedReadCloser struct {
+	io.Reader
+	io.Closer
+}
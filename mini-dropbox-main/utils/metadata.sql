@@ -0,0 +1,245 @@
+CREATE TABLE IF NOT EXISTS file_metadata (
+    id INTEGER PRIMARY KEY AUTO_INCREMENT,
+    filename VARCHAR(255) NOT NULL,
+    size_in_bytes BIGINT NOT NULL,
+    s3_object_key VARCHAR(255) NOT NULL,
+    description TEXT,
+    mime_type VARCHAR(255),
+    content_hash VARCHAR(64) NOT NULL DEFAULT '',
+    content_md5 VARCHAR(32) NOT NULL DEFAULT '',
+    status TINYINT(4) NOT NULL DEFAULT 1,
+    version INTEGER NOT NULL DEFAULT 1,
+    revision INTEGER NOT NULL DEFAULT 1,
+    version_retention INTEGER NOT NULL DEFAULT 0,
+    folder_id INTEGER NOT NULL DEFAULT 0,
+    owner_id INTEGER NOT NULL DEFAULT 0,
+    prev_key VARCHAR(255),
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+    KEY active_files (filename, status),
+    KEY trash_files (status, updated_at),
+    KEY folder_files (owner_id, folder_id, status),
+    FULLTEXT KEY file_search (filename, description)
+);
+
+CREATE TABLE IF NOT EXISTS upload_sessions (
+    id VARCHAR(64) PRIMARY KEY,
+    filename VARCHAR(255) NOT NULL,
+    description TEXT,
+    size_in_bytes BIGINT NOT NULL,
+    upload_offset BIGINT NOT NULL DEFAULT 0,
+    s3_object_key VARCHAR(255) NOT NULL,
+    folder_id INTEGER NOT NULL DEFAULT 0,
+    status TINYINT(4) NOT NULL DEFAULT 0,
+    file_id INTEGER NOT NULL DEFAULT 0,
+    owner_id INTEGER NOT NULL DEFAULT 0,
+    expires_at TIMESTAMP NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+    KEY expired_uploads (expires_at)
+);
+
+CREATE TABLE IF NOT EXISTS upload_chunks (
+    session_id VARCHAR(64) NOT NULL,
+    chunk_offset BIGINT NOT NULL,
+    size_in_bytes BIGINT NOT NULL,
+    s3_object_key VARCHAR(255) NOT NULL,
+    PRIMARY KEY (session_id, chunk_offset),
+    FOREIGN KEY (session_id) REFERENCES upload_sessions (id) ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS file_versions (
+    id INTEGER PRIMARY KEY AUTO_INCREMENT,
+    file_id INTEGER NOT NULL,
+    version INTEGER NOT NULL,
+    filename VARCHAR(255) NOT NULL,
+    size_in_bytes BIGINT NOT NULL,
+    s3_object_key VARCHAR(255) NOT NULL,
+    description TEXT,
+    mime_type VARCHAR(255),
+    content_hash VARCHAR(64) NOT NULL DEFAULT '',
+    content_md5 VARCHAR(32) NOT NULL DEFAULT '',
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE KEY file_version (file_id, version),
+    KEY version_objects (s3_object_key)
+);
+
+CREATE TABLE IF NOT EXISTS folders (
+    id INTEGER PRIMARY KEY AUTO_INCREMENT,
+    name VARCHAR(255) NOT NULL,
+    parent_id INTEGER NOT NULL DEFAULT 0,
+    owner_id INTEGER NOT NULL DEFAULT 0,
+    status TINYINT(4) NOT NULL DEFAULT 1,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+    KEY folder_children (owner_id, parent_id, status)
+);
+
+CREATE TABLE IF NOT EXISTS users (
+    id INTEGER PRIMARY KEY AUTO_INCREMENT,
+    username VARCHAR(64) NOT NULL,
+    password_hash VARCHAR(255) NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+    UNIQUE KEY unique_username (username)
+);
+
+CREATE TABLE IF NOT EXISTS sessions (
+    token_hash VARCHAR(64) PRIMARY KEY,
+    user_id INTEGER NOT NULL,
+    expires_at TIMESTAMP NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE,
+    KEY expired_sessions (expires_at)
+);
+
+CREATE TABLE IF NOT EXISTS api_tokens (
+    id INTEGER PRIMARY KEY AUTO_INCREMENT,
+    user_id INTEGER NOT NULL,
+    name VARCHAR(255) NOT NULL,
+    token_hash VARCHAR(64) NOT NULL,
+    scopes VARCHAR(255) NOT NULL,
+    expires_at TIMESTAMP NULL,
+    last_used_at TIMESTAMP NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE KEY unique_token_hash (token_hash),
+    FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE,
+    KEY user_api_tokens (user_id)
+);
+
+CREATE TABLE IF NOT EXISTS share_links (
+    id INTEGER PRIMARY KEY AUTO_INCREMENT,
+    token VARCHAR(64) NOT NULL,
+    file_id INTEGER NOT NULL,
+    owner_id INTEGER NOT NULL,
+    password_hash VARCHAR(255) NOT NULL DEFAULT '',
+    expires_at TIMESTAMP NULL,
+    max_downloads INTEGER NOT NULL DEFAULT 0,
+    download_count INTEGER NOT NULL DEFAULT 0,
+    status TINYINT(4) NOT NULL DEFAULT 1,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+    UNIQUE KEY unique_share_token (token),
+    KEY file_share_links (file_id, status)
+);
+
+CREATE TABLE IF NOT EXISTS share_link_accesses (
+    id INTEGER PRIMARY KEY AUTO_INCREMENT,
+    link_id INTEGER NOT NULL,
+    ip_address VARCHAR(64) NOT NULL,
+    user_agent VARCHAR(255) NOT NULL DEFAULT '',
+    status_code INTEGER NOT NULL,
+    accessed_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (link_id) REFERENCES share_links (id) ON DELETE CASCADE,
+    KEY link_accesses (link_id)
+);
+
+CREATE TABLE IF NOT EXISTS user_groups (
+    id INTEGER PRIMARY KEY AUTO_INCREMENT,
+    name VARCHAR(64) NOT NULL,
+    owner_id INTEGER NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE KEY unique_group_name (name)
+);
+
+CREATE TABLE IF NOT EXISTS group_members (
+    group_id INTEGER NOT NULL,
+    user_id INTEGER NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (group_id, user_id),
+    FOREIGN KEY (group_id) REFERENCES user_groups (id) ON DELETE CASCADE,
+    FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE,
+    KEY user_memberships (user_id)
+);
+
+CREATE TABLE IF NOT EXISTS group_invitations (
+    group_id INTEGER NOT NULL,
+    user_id INTEGER NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (group_id, user_id),
+    FOREIGN KEY (group_id) REFERENCES user_groups (id) ON DELETE CASCADE,
+    FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE,
+    KEY user_invitations (user_id)
+);
+
+CREATE TABLE IF NOT EXISTS permissions (
+    id INTEGER PRIMARY KEY AUTO_INCREMENT,
+    resource_type VARCHAR(16) NOT NULL,
+    resource_id INTEGER NOT NULL,
+    grantee_type VARCHAR(16) NOT NULL,
+    grantee_id INTEGER NOT NULL,
+    role VARCHAR(16) NOT NULL,
+    granted_by INTEGER NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+    UNIQUE KEY unique_grant (resource_type, resource_id, grantee_type, grantee_id),
+    KEY grantee_permissions (grantee_type, grantee_id)
+);
+
+CREATE TABLE IF NOT EXISTS blobs (
+    content_hash VARCHAR(64) PRIMARY KEY,
+    s3_object_key VARCHAR(255) NOT NULL,
+    size_in_bytes BIGINT NOT NULL,
+    ref_count INTEGER NOT NULL DEFAULT 0,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS job_locks (
+    name VARCHAR(64) PRIMARY KEY,
+    holder VARCHAR(255) NOT NULL,
+    expires_at TIMESTAMP NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS file_contents (
+    file_id INTEGER PRIMARY KEY,
+    source_hash VARCHAR(64) NOT NULL,
+    content MEDIUMTEXT NOT NULL,
+    extracted_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    FULLTEXT KEY content_search (content)
+);
+
+CREATE TABLE IF NOT EXISTS tags (
+    id INTEGER PRIMARY KEY AUTO_INCREMENT,
+    owner_id INTEGER NOT NULL,
+    name VARCHAR(64) NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE KEY unique_tag (owner_id, name)
+);
+
+CREATE TABLE IF NOT EXISTS file_tags (
+    file_id INTEGER NOT NULL,
+    tag_id INTEGER NOT NULL,
+    PRIMARY KEY (file_id, tag_id),
+    KEY tag_files (tag_id)
+);
+
+CREATE TABLE IF NOT EXISTS file_properties (
+    file_id INTEGER NOT NULL,
+    name VARCHAR(64) NOT NULL,
+    value VARCHAR(255) NOT NULL,
+    PRIMARY KEY (file_id, name),
+    KEY property_files (name, value)
+);
+
+CREATE TABLE IF NOT EXISTS quotas (
+    subject_type VARCHAR(16) NOT NULL,
+    subject_id INTEGER NOT NULL,
+    max_bytes BIGINT NOT NULL DEFAULT 0,
+    max_files INTEGER NOT NULL DEFAULT 0,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+    PRIMARY KEY (subject_type, subject_id)
+);
+
+CREATE TABLE IF NOT EXISTS presigned_uploads (
+    s3_object_key VARCHAR(255) PRIMARY KEY,
+    owner_id INTEGER NOT NULL,
+    expires_at TIMESTAMP NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    KEY expired_presigned_uploads (expires_at)
+);
+
+CREATE TABLE IF NOT EXISTS schema_version (
+    version INTEGER NOT NULL
+);
@@ -0,0 +1,458 @@
+package utils
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/manishlpu/assignment/models"
+)
+
+// Behaviour expected from every metadata store, run against each of them so
+// that the stores stay interchangeable.
+var metadataStoreContract = []struct {
+	name string
+	test func(t *testing.T, store MetadataOps)
+}{
+	{"SaveAndGetRecord", testSaveAndGetRecord},
+	{"RecordNamesAreUnique", testRecordNamesAreUnique},
+	{"UpdateRecordAtRevision", testUpdateRecordAtRevision},
+	{"DeactivateRecord", testDeactivateRecord},
+	{"PendingRecords", testPendingRecords},
+	{"UploadSessionCompletesOnce", testUploadSessionCompletesOnce},
+	{"PresignedUploadCompletesOnce", testPresignedUploadCompletesOnce},
+	{"BlobsAreShared", testBlobsAreShared},
+	{"StaleContentKeepsNewerIndex", testStaleContentKeepsNewerIndex},
+	{"QuotaIsEnforced", testQuotaIsEnforced},
+	{"GroupQuotaNeedsAcceptedInvitation", testGroupQuotaNeedsAcceptedInvitation},
+	{"ObjectReferencesAreRechecked", testObjectReferencesAreRechecked},
+}
+
+func runMetadataStoreContract(t *testing.T, newStore func(t *testing.T) MetadataOps) {
+	for _, tc := range metadataStoreContract {
+		t.Run(tc.name, func(t *testing.T) {
+			tc.test(t, newStore(t))
+		})
+	}
+}
+
+func TestSQLiteMetadataStore(t *testing.T) {
+	runMetadataStoreContract(t, func(t *testing.T) MetadataOps {
+		store, err := NewSQLiteDBLayer(filepath.Join(t.TempDir(), "metadata.db"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { store.(*SQLiteDBLayer).db.Close() })
+		return store
+	})
+}
+
+// Runs against the database configured by the METADATA_* variables when
+// METADATA_TEST_MYSQL is set. Its tables are dropped and created again from
+// the schema before each test.
+func TestMySQLMetadataStore(t *testing.T) {
+	if os.Getenv("METADATA_TEST_MYSQL") == "" {
+		t.Skip("METADATA_TEST_MYSQL is not set")
+	}
+
+	runMetadataStoreContract(t, func(t *testing.T) MetadataOps {
+		store, err := NewPersistenceDBLayer()
+		if err != nil {
+			t.Fatal(err)
+		}
+		db := store.(*PersistenceDBLayer).db
+		t.Cleanup(func() { db.Close() })
+
+		dropMySQLTables(t, db)
+		if err := migrateMySQL(db); err != nil {
+			t.Fatal(err)
+		}
+		return store
+	})
+}
+
+func newTestRecord(ownerID int64, filename, contentHash string, size int64) models.Metadata {
+	return models.Metadata{
+		Filename:    filename,
+		SizeInBytes: size,
+		S3ObjectKey: "https://bucket.s3.amazonaws.com/" + filename + "_" + contentHash,
+		MimeType:    "text/plain",
+		ContentHash: contentHash,
+		OwnerID:     ownerID,
+		Status:      models.STATUS_ACTIVE,
+	}
+}
+
+func saveTestRecord(t *testing.T, store MetadataOps, record models.Metadata) int64 {
+	t.Helper()
+	id, err := store.SaveRecord(record)
+	if err != nil {
+		t.Fatalf("saving %s: %v", record.Filename, err)
+	}
+	return id
+}
+
+func getTestRecord(t *testing.T, store MetadataOps, ownerID, id int64) *models.Metadata {
+	t.Helper()
+	record, err := store.GetRecord(ownerID, id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return record
+}
+
+func testSaveAndGetRecord(t *testing.T, store MetadataOps) {
+	id := saveTestRecord(t, store, newTestRecord(1, "notes.txt", "h1", 10))
+
+	record := getTestRecord(t, store, 1, id)
+	if record == nil {
+		t.Fatal("saved record not found")
+	}
+	if record.Filename != "notes.txt" || record.SizeInBytes != 10 || record.Version != 1 || record.Revision != 1 {
+		t.Errorf("unexpected record: %+v", record)
+	}
+	if other := getTestRecord(t, store, 2, id); other != nil {
+		t.Errorf("record of owner 1 returned to owner 2")
+	}
+
+	versions, err := store.FetchVersions(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(versions) != 1 {
+		t.Errorf("expected 1 version, got %d", len(versions))
+	}
+}
+
+func testRecordNamesAreUnique(t *testing.T, store MetadataOps) {
+	saveTestRecord(t, store, newTestRecord(1, "notes.txt", "h1", 10))
+
+	if _, err := store.SaveRecord(newTestRecord(1, "notes.txt", "h2", 10)); !errors.Is(err, ErrNameConflict) {
+		t.Errorf("expected ErrNameConflict, got %v", err)
+	}
+	// Names are only unique among the files of an owner
+	saveTestRecord(t, store, newTestRecord(2, "notes.txt", "h2", 10))
+}
+
+func testUpdateRecordAtRevision(t *testing.T, store MetadataOps) {
+	id := saveTestRecord(t, store, newTestRecord(1, "notes.txt", "h1", 10))
+
+	update := newTestRecord(1, "notes.txt", "h2", 20)
+	update.Revision = 1
+	if err := store.UpdateRecord(1, id, update); err != nil {
+		t.Fatal(err)
+	}
+	record := getTestRecord(t, store, 1, id)
+	if record.Version != 2 || record.Revision != 2 || record.ContentHash != "h2" {
+		t.Errorf("unexpected record after update: %+v", record)
+	}
+
+	// The update is based on a revision which is no longer current
+	if err := store.UpdateRecord(1, id, update); !errors.Is(err, ErrPreconditionFailed) {
+		t.Errorf("expected ErrPreconditionFailed, got %v", err)
+	}
+	if err := store.UpdateRecord(1, id+1, update); !errors.Is(err, ErrFileNotFound) {
+		t.Errorf("expected ErrFileNotFound, got %v", err)
+	}
+}
+
+func testDeactivateRecord(t *testing.T, store MetadataOps) {
+	id := saveTestRecord(t, store, newTestRecord(1, "notes.txt", "h1", 10))
+
+	if err := store.DeactivateRecord(1, id, 2); !errors.Is(err, ErrPreconditionFailed) {
+		t.Errorf("expected ErrPreconditionFailed, got %v", err)
+	}
+	if err := store.DeactivateRecord(1, id, 1); err != nil {
+		t.Fatal(err)
+	}
+	if record := getTestRecord(t, store, 1, id); record != nil {
+		t.Errorf("deleted record still returned")
+	}
+	// Deleted files are not deleted again, whatever the revision
+	for _, revision := range []int64{0, 2} {
+		if err := store.DeactivateRecord(1, id, revision); !errors.Is(err, ErrFileNotFound) {
+			t.Errorf("expected ErrFileNotFound at revision %d, got %v", revision, err)
+		}
+	}
+
+	trashed, err := store.FetchTrashedRecords(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(trashed) != 1 || trashed[0].ID != id {
+		t.Errorf("expected the deleted record in the trash, got %+v", trashed)
+	}
+}
+
+func testPendingRecords(t *testing.T, store MetadataOps) {
+	pending := newTestRecord(1, "upload.txt", "", 0)
+	id, err := store.CreatePendingRecord(pending)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if record := getTestRecord(t, store, 1, id); record != nil {
+		t.Errorf("pending record returned before its commit")
+	}
+
+	content := newTestRecord(1, "upload.txt", "h1", 10)
+	content.ID = id
+	if _, err := store.CommitRecord(content); err != nil {
+		t.Fatal(err)
+	}
+	record := getTestRecord(t, store, 1, id)
+	if record == nil || record.ContentHash != "h1" || record.SizeInBytes != 10 {
+		t.Errorf("unexpected committed record: %+v", record)
+	}
+	if _, err := store.CommitRecord(content); !errors.Is(err, ErrUploadNotPending) {
+		t.Errorf("expected ErrUploadNotPending, got %v", err)
+	}
+
+	failed, err := store.CreatePendingRecord(newTestRecord(1, "failed.txt", "", 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := store.FailRecord(failed); err != nil {
+		t.Fatal(err)
+	}
+	records, err := store.FetchFailedRecords(time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 1 || records[0].ID != failed {
+		t.Errorf("expected the failed record, got %+v", records)
+	}
+}
+
+func testUploadSessionCompletesOnce(t *testing.T, store MetadataOps) {
+	session := models.UploadSession{ID: "s1", Filename: "big.bin", SizeInBytes: 10, S3ObjectKey: "big.bin_1", OwnerID: 1, ExpiresAt: time.Now().Add(time.Hour)}
+	if err := store.CreateUploadSession(session); err != nil {
+		t.Fatal(err)
+	}
+
+	id, err := store.CompleteUploadSession(session.ID, newTestRecord(1, "big.bin", "h1", 10))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// A concurrent finalize records no duplicate file
+	if _, err := store.CompleteUploadSession(session.ID, newTestRecord(1, "copy.bin", "h1", 10)); !errors.Is(err, ErrUploadSessionFinalized) {
+		t.Errorf("expected ErrUploadSessionFinalized, got %v", err)
+	}
+
+	records, err := store.FetchRecords(1, FileListOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 1 || records[0].ID != id {
+		t.Errorf("expected the file of the session only, got %+v", records)
+	}
+}
+
+func testPresignedUploadCompletesOnce(t *testing.T, store MetadataOps) {
+	expiresAt := time.Now().Add(time.Hour)
+	if err := store.ClaimPresignedUpload("photo.jpg_1", 1, expiresAt); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.ClaimPresignedUpload("photo.jpg_1", 1, expiresAt); !errors.Is(err, ErrUploadCompleted) {
+		t.Errorf("expected ErrUploadCompleted, got %v", err)
+	}
+
+	// A released upload can be completed again
+	if err := store.ReleasePresignedUpload("photo.jpg_1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.ClaimPresignedUpload("photo.jpg_1", 1, expiresAt); err != nil {
+		t.Fatal(err)
+	}
+	claimed, err := store.IsPresignedUploadClaimed("photo.jpg_1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !claimed {
+		t.Error("completed upload is not claimed")
+	}
+}
+
+func testBlobsAreShared(t *testing.T, store MetadataOps) {
+	first := saveTestRecord(t, store, newTestRecord(1, "a.txt", "h1", 10))
+	second := saveTestRecord(t, store, newTestRecord(2, "b.txt", "h1", 10))
+
+	// Files of the same content refer to the object of the first one
+	a, b := getTestRecord(t, store, 1, first), getTestRecord(t, store, 2, second)
+	if a.S3ObjectKey != b.S3ObjectKey {
+		t.Errorf("files of the same content refer to %s and %s", a.S3ObjectKey, b.S3ObjectKey)
+	}
+	blob, err := store.GetBlob("h1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if blob == nil || blob.RefCount != 2 || blob.S3ObjectKey != a.S3ObjectKey {
+		t.Errorf("unexpected blob: %+v", blob)
+	}
+
+	// The blob is released with the last file referring to it
+	for _, file := range []*models.Metadata{a, b} {
+		if err := store.DeactivateRecord(file.OwnerID, file.ID, 0); err != nil {
+			t.Fatal(err)
+		}
+		unreferenced, err := store.PurgeRecord(file.OwnerID, file.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if released := len(unreferenced) > 0; released != (file == b) {
+			t.Errorf("purge of %s released blobs %v", file.Filename, unreferenced)
+		}
+	}
+	claimed, err := store.ClaimBlob("h1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if claimed == nil {
+		t.Error("unreferenced blob not claimed")
+	}
+}
+
+func testStaleContentKeepsNewerIndex(t *testing.T, store MetadataOps) {
+	id := saveTestRecord(t, store, newTestRecord(1, "notes.txt", "h1", 10))
+	update := newTestRecord(1, "notes.txt", "h2", 10)
+	update.Revision = 1
+	if err := store.UpdateRecord(1, id, update); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.SaveRecordContent(id, "h2", "newer text"); err != nil {
+		t.Fatal(err)
+	}
+
+	// The indexing of the previous content completes late
+	if err := store.SaveRecordContent(id, "h1", "older text"); err != nil {
+		t.Fatal(err)
+	}
+	unindexed, err := store.FetchUnindexedRecords(0, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(unindexed) != 0 {
+		t.Errorf("the newer content lost its index: %+v", unindexed)
+	}
+}
+
+func testQuotaIsEnforced(t *testing.T, store MetadataOps) {
+	if err := store.SetQuota(models.Quota{SubjectType: models.QUOTA_USER, SubjectID: 1, MaxBytes: 25, MaxFiles: 2}); err != nil {
+		t.Fatal(err)
+	}
+	first := saveTestRecord(t, store, newTestRecord(1, "a.txt", "h1", 10))
+
+	if _, err := store.SaveRecord(newTestRecord(1, "b.txt", "h2", 20)); !errors.Is(err, ErrQuotaExceeded) {
+		t.Errorf("expected ErrQuotaExceeded on bytes, got %v", err)
+	}
+	saveTestRecord(t, store, newTestRecord(1, "b.txt", "h2", 10))
+	if _, err := store.SaveRecord(newTestRecord(1, "c.txt", "h3", 1)); !errors.Is(err, ErrQuotaExceeded) {
+		t.Errorf("expected ErrQuotaExceeded on files, got %v", err)
+	}
+
+	// New versions add to the storage used, previous ones being kept
+	update := newTestRecord(1, "a.txt", "h1", 10)
+	update.Revision = 1
+	if err := store.UpdateRecord(1, first, update); !errors.Is(err, ErrQuotaExceeded) {
+		t.Errorf("expected ErrQuotaExceeded on update, got %v", err)
+	}
+
+	usage, err := store.FetchUsage(models.QUOTA_USER, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if usage.Bytes != 20 || usage.Files != 2 {
+		t.Errorf("unexpected usage: %+v", usage)
+	}
+}
+
+func createTestUser(t *testing.T, store MetadataOps, username string) int64 {
+	t.Helper()
+	id, err := store.CreateUser(models.User{Username: username, PasswordHash: "hash"})
+	if err != nil {
+		t.Fatalf("creating %s: %v", username, err)
+	}
+	return id
+}
+
+// Owners of a group cannot subject other users to its quota until they
+// accept to join it.
+func testGroupQuotaNeedsAcceptedInvitation(t *testing.T, store MetadataOps) {
+	ownerID := createTestUser(t, store, "owner")
+	userID := createTestUser(t, store, "user")
+	groupID, err := store.CreateGroup(models.Group{Name: "team", OwnerID: ownerID})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := store.SetQuota(models.Quota{SubjectType: models.QUOTA_GROUP, SubjectID: groupID, MaxBytes: 5}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := store.InviteGroupMember(groupID, userID); err != nil {
+		t.Fatal(err)
+	}
+	if member, err := store.IsGroupMember(groupID, userID); err != nil || member {
+		t.Errorf("expected the invited user not to be a member, got %v, %v", member, err)
+	}
+	saveTestRecord(t, store, newTestRecord(userID, "a.txt", "h1", 10))
+
+	if err := store.AcceptGroupInvitation(groupID, userID); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.AcceptGroupInvitation(groupID, userID); !errors.Is(err, ErrInvitationNotFound) {
+		t.Errorf("expected ErrInvitationNotFound accepting twice, got %v", err)
+	}
+	if _, err := store.SaveRecord(newTestRecord(userID, "b.txt", "h2", 1)); !errors.Is(err, ErrQuotaExceeded) {
+		t.Errorf("expected ErrQuotaExceeded once a member, got %v", err)
+	}
+}
+
+// Objects are referenced by the same rows whether listed or checked one by
+// one, the chunks of finalized sessions being no longer referenced.
+func testObjectReferencesAreRechecked(t *testing.T, store MetadataOps) {
+	saveTestRecord(t, store, newTestRecord(1, "a.txt", "h1", 10))
+	expiresAt := time.Now().Add(time.Hour)
+	for _, id := range []string{"active", "finalized"} {
+		session := models.UploadSession{ID: id, Filename: id + ".bin", SizeInBytes: 10, S3ObjectKey: id + ".bin_1", OwnerID: 1, ExpiresAt: expiresAt}
+		if err := store.CreateUploadSession(session); err != nil {
+			t.Fatal(err)
+		}
+		chunk := models.UploadChunk{SessionID: id, SizeInBytes: 10, S3ObjectKey: "uploads/" + id + "/0"}
+		if err := store.AddUploadChunk(chunk, expiresAt); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := store.CompleteUploadSession("finalized", newTestRecord(1, "finalized.bin", "h2", 10)); err != nil {
+		t.Fatal(err)
+	}
+
+	references, err := store.FetchObjectReferences()
+	if err != nil {
+		t.Fatal(err)
+	}
+	tables := map[string]bool{}
+	for _, reference := range references {
+		tables[reference.Table] = true
+		referenced, err := store.IsObjectReferenced(reference.S3ObjectKey)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !referenced {
+			t.Errorf("object of %s %s is not referenced", reference.Table, reference.ID)
+		}
+	}
+	if len(tables) != 4 {
+		t.Errorf("expected references from every table, got %v", tables)
+	}
+
+	for _, key := range []string{"uploads/finalized/0", "unknown"} {
+		referenced, err := store.IsObjectReferenced(key, "https://bucket.s3.amazonaws.com/"+key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if referenced {
+			t.Errorf("object %s is referenced", key)
+		}
+	}
+}
@@ -0,0 +1,46 @@
+package utils
+
+import "database/sql"
+
+// Columns added to the tables since their creation, which the databases
+// created by earlier releases may lack. The definitions are valid in both the
+// SQLite and the MySQL dialects. Adding one takes a migration adding the
+// missing columns again.
+var addedColumns = []struct {
+	table, column, definition string
+}{
+	{"file_metadata", "content_hash", "VARCHAR(64) NOT NULL DEFAULT ''"},
+	{"file_metadata", "content_md5", "VARCHAR(32) NOT NULL DEFAULT ''"},
+	{"file_metadata", "version", "INTEGER NOT NULL DEFAULT 1"},
+	{"file_metadata", "revision", "INTEGER NOT NULL DEFAULT 1"},
+	{"file_metadata", "version_retention", "INTEGER NOT NULL DEFAULT 0"},
+	{"file_metadata", "folder_id", "INTEGER NOT NULL DEFAULT 0"},
+	{"file_metadata", "owner_id", "INTEGER NOT NULL DEFAULT 0"},
+	{"file_versions", "content_md5", "VARCHAR(32) NOT NULL DEFAULT ''"},
+	{"folders", "owner_id", "INTEGER NOT NULL DEFAULT 0"},
+	{"upload_sessions", "owner_id", "INTEGER NOT NULL DEFAULT 0"},
+	{"upload_sessions", "folder_id", "INTEGER NOT NULL DEFAULT 0"},
+}
+
+// Records the files stored before versions were kept as their first version,
+// on a blob of their own, so that their objects are counted in the usage and
+// removed once purged. Their content was never hashed, they are given a hash
+// derived from their id by the legacyHash expression of the dialect instead.
+func backfillVersions(tx *sql.Tx, legacyHash string) error {
+	statements := []string{
+		"UPDATE file_metadata SET content_hash = " + legacyHash + " WHERE content_hash = '' AND status IN (0, 1)" +
+			" AND NOT EXISTS (SELECT 1 FROM file_versions WHERE file_id = file_metadata.id)",
+		"INSERT INTO file_versions (file_id, version, filename, size_in_bytes, s3_object_key, description, mime_type, content_hash, content_md5, created_at)" +
+			" SELECT id, version, filename, size_in_bytes, s3_object_key, description, mime_type, content_hash, content_md5, updated_at FROM file_metadata" +
+			" WHERE content_hash = " + legacyHash + " AND NOT EXISTS (SELECT 1 FROM file_versions WHERE file_id = file_metadata.id)",
+		"INSERT INTO blobs (content_hash, s3_object_key, size_in_bytes, ref_count)" +
+			" SELECT content_hash, s3_object_key, size_in_bytes, 1 FROM file_metadata" +
+			" WHERE content_hash = " + legacyHash + " AND NOT EXISTS (SELECT 1 FROM blobs WHERE blobs.content_hash = file_metadata.content_hash)",
+	}
+	for _, statement := range statements {
+		if _, err := tx.Exec(statement); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,191 @@
+package utils
+
+import (
+	"context"
+	"database/sql"
+	_ "embed"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Schema of the MySQL database. Statements are idempotent so the schema is
+// applied on every start, once the databases created by earlier releases are
+// migrated. Columns and indexes added to an existing table come with a
+// migration in mysqlMigrations.
+//
+//go:embed metadata.sql
+var mysqlSchema string
+
+// Named lock held while migrating, servers starting together waiting for the
+// first one to be done.
+const (
+	mysqlSchemaLock        = "mini_dropbox_schema"
+	mysqlSchemaLockTimeout = 5 * time.Minute
+)
+
+// Indexes added to the tables since their creation, which the databases
+// created before the schema was versioned may lack.
+var mysqlAddedIndexes = []struct {
+	table, index, definition string
+}{
+	{"file_metadata", "folder_files", "KEY folder_files (owner_id, folder_id, status)"},
+	{"file_metadata", "file_search", "FULLTEXT KEY file_search (filename, description)"},
+}
+
+// Migrations of the schema, the version of a database being the number of
+// migrations applied to it, kept in the schema_version table. New databases
+// are created from mysqlSchema at the latest version. MySQL commits schema
+// changes implicitly, so migrations must be safe to run again when
+// interrupted.
+var mysqlMigrations = []func(ctx context.Context, conn *sql.Conn) error{
+	// 1: adds the columns and indexes missing from the databases created
+	// before the schema was versioned
+	func(ctx context.Context, conn *sql.Conn) error {
+		if err := addMySQLColumns(ctx, conn); err != nil {
+			return err
+		}
+		for _, added := range mysqlAddedIndexes {
+			var exists int
+			query := "SELECT COUNT(*) FROM information_schema.STATISTICS WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = ? AND INDEX_NAME = ?"
+			if err := conn.QueryRowContext(ctx, query, added.table, added.index).Scan(&exists); err != nil {
+				return err
+			}
+			if exists > 0 {
+				continue
+			}
+			if _, err := conn.ExecContext(ctx, "ALTER TABLE "+added.table+" ADD "+added.definition); err != nil {
+				return err
+			}
+		}
+		return nil
+	},
+	// 2: records the files stored before versions were kept as their first
+	// version, once the tables they go to are created
+	func(ctx context.Context, conn *sql.Conn) error {
+		if err := applyMySQLSchema(ctx, conn); err != nil {
+			return err
+		}
+		tx, err := conn.BeginTx(ctx, nil)
+		if err != nil {
+			return err
+		}
+		defer tx.Rollback()
+
+		if err := backfillVersions(tx, "CONCAT('legacy-', id)"); err != nil {
+			return err
+		}
+		return tx.Commit()
+	},
+	// 3: adds the folder resumable uploads are made to
+	addMySQLColumns,
+}
+
+// Adds the columns of addedColumns missing from the existing tables.
+func addMySQLColumns(ctx context.Context, conn *sql.Conn) error {
+	for _, added := range addedColumns {
+		var count, exists int
+		query := "SELECT COUNT(*), COALESCE(SUM(COLUMN_NAME = ?), 0) FROM information_schema.COLUMNS WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = ?"
+		if err := conn.QueryRowContext(ctx, query, added.column, added.table).Scan(&count, &exists); err != nil {
+			return err
+		}
+		// Tables missing altogether are created by the schema
+		if count == 0 || exists > 0 {
+			continue
+		}
+		if _, err := conn.ExecContext(ctx, "ALTER TABLE "+added.table+" ADD COLUMN "+added.column+" "+added.definition); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Applies the statements of the schema, which the driver only accepts one at
+// a time.
+func applyMySQLSchema(ctx context.Context, conn *sql.Conn) error {
+	for _, statement := range strings.Split(mysqlSchema, ";") {
+		if strings.TrimSpace(statement) == "" {
+			continue
+		}
+		if _, err := conn.ExecContext(ctx, statement); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func mysqlTableExists(ctx context.Context, conn *sql.Conn, table string) (bool, error) {
+	var count int
+	query := "SELECT COUNT(*) FROM information_schema.TABLES WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = ?"
+	if err := conn.QueryRowContext(ctx, query, table).Scan(&count); err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
+
+// Brings the schema of the database to the latest version, applying the
+// migrations it is missing before the schema.
+func migrateMySQL(db *sql.DB) error {
+	ctx := context.TODO()
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	var locked sql.NullInt64
+	if err := conn.QueryRowContext(ctx, "SELECT GET_LOCK(?, ?)", mysqlSchemaLock, int(mysqlSchemaLockTimeout.Seconds())).Scan(&locked); err != nil {
+		return err
+	}
+	if locked.Int64 != 1 {
+		return fmt.Errorf("could not lock the mysql schema")
+	}
+	defer conn.ExecContext(ctx, "SELECT RELEASE_LOCK(?)", mysqlSchemaLock)
+
+	// Databases created before the schema was versioned have no version
+	// table but already hold files
+	version := len(mysqlMigrations)
+	versioned, err := mysqlTableExists(ctx, conn, "schema_version")
+	if err != nil {
+		return err
+	}
+	if versioned {
+		if err := conn.QueryRowContext(ctx, "SELECT COALESCE(MAX(version), 0) FROM schema_version").Scan(&version); err != nil {
+			return err
+		}
+	} else {
+		existing, err := mysqlTableExists(ctx, conn, "file_metadata")
+		if err != nil {
+			return err
+		}
+		if existing {
+			version = 0
+		}
+	}
+	if version > len(mysqlMigrations) {
+		return fmt.Errorf("mysql schema version %d is newer than the supported version %d", version, len(mysqlMigrations))
+	}
+
+	for i := version; i < len(mysqlMigrations); i++ {
+		if err := mysqlMigrations[i](ctx, conn); err != nil {
+			return fmt.Errorf("mysql migration %d: %w", i+1, err)
+		}
+	}
+	if err := applyMySQLSchema(ctx, conn); err != nil {
+		return err
+	}
+
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec("DELETE FROM schema_version"); err != nil {
+		return err
+	}
+	if _, err := tx.Exec("INSERT INTO schema_version (version) VALUES (?)", len(mysqlMigrations)); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
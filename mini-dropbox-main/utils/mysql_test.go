@@ -0,0 +1,124 @@
+package utils
+
+import (
+	"context"
+	"database/sql"
+	"os"
+	"strings"
+	"testing"
+)
+
+// Drops every table of the test database.
+func dropMySQLTables(t *testing.T, db *sql.DB) {
+	t.Helper()
+	ctx := context.TODO()
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	rows, err := conn.QueryContext(ctx, "SELECT TABLE_NAME FROM information_schema.TABLES WHERE TABLE_SCHEMA = DATABASE()")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var tables []string
+	for rows.Next() {
+		var table string
+		if err := rows.Scan(&table); err != nil {
+			t.Fatal(err)
+		}
+		tables = append(tables, table)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := conn.ExecContext(ctx, "SET FOREIGN_KEY_CHECKS = 0"); err != nil {
+		t.Fatal(err)
+	}
+	defer conn.ExecContext(ctx, "SET FOREIGN_KEY_CHECKS = 1")
+	for _, table := range tables {
+		if _, err := conn.ExecContext(ctx, "DROP TABLE "+table); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// Databases created before the schema was versioned lack the tables, columns
+// and indexes added since, which are added on open.
+func TestMySQLMigratesUnversionedDatabase(t *testing.T) {
+	if os.Getenv("METADATA_TEST_MYSQL") == "" {
+		t.Skip("METADATA_TEST_MYSQL is not set")
+	}
+
+	store, err := NewPersistenceDBLayer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	db := store.(*PersistenceDBLayer).db
+	defer db.Close()
+
+	dropMySQLTables(t, db)
+	for _, statement := range []string{
+		`CREATE TABLE file_metadata (
+    id INTEGER PRIMARY KEY AUTO_INCREMENT,
+    filename VARCHAR(255) NOT NULL,
+    size_in_bytes BIGINT NOT NULL,
+    s3_object_key VARCHAR(255) NOT NULL,
+    description TEXT,
+    mime_type VARCHAR(255),
+    status TINYINT(4) NOT NULL DEFAULT 1,
+    prev_key VARCHAR(255),
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP
+)`,
+		"CREATE INDEX active_files on file_metadata (filename, status)",
+		"CREATE INDEX trash_files on file_metadata (status, updated_at)",
+		"INSERT INTO file_metadata (filename, size_in_bytes, s3_object_key, description, mime_type) VALUES ('old.txt', 3, 'old.txt_1', '', 'text/plain')",
+		"INSERT INTO file_metadata (filename, size_in_bytes, s3_object_key, description, mime_type, status) VALUES ('gone.txt', 5, 'gone.txt_1', '', 'text/plain', 0)",
+	} {
+		if _, err := db.Exec(statement); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := migrateMySQL(db); err != nil {
+		t.Fatal(err)
+	}
+
+	record := getTestRecord(t, store, 0, 1)
+	if record == nil || record.Filename != "old.txt" || record.Revision != 1 {
+		t.Errorf("unexpected migrated record: %+v", record)
+	}
+	saveTestRecord(t, store, newTestRecord(1, "new.txt", "h1", 10))
+	checkLegacyFilesMigrated(t, store)
+	if _, err := store.SearchRecords(1, []string{"new"}, 10); err != nil {
+		t.Errorf("searching the migrated database: %v", err)
+	}
+
+	var version int
+	if err := db.QueryRow("SELECT version FROM schema_version").Scan(&version); err != nil {
+		t.Fatal(err)
+	}
+	if version != len(mysqlMigrations) {
+		t.Errorf("expected version %d, got %d", len(mysqlMigrations), version)
+	}
+}
+
+// Terms the FULLTEXT indexes leave out are not required, files having them
+// never matching otherwise.
+func TestFullTextMatchQuery(t *testing.T) {
+	settings := fullTextSettings{minTokenSize: 3, stopwords: map[string]bool{"the": true}}
+
+	for terms, expected := range map[string]string{
+		"the go notes":  "+notes* ",
+		"annual report": "+annual* +report* ",
+		"to the":        "",
+	} {
+		if match := settings.matchQuery(strings.Fields(terms)); match != expected {
+			t.Errorf("%s: expected %q, got %q", terms, expected, match)
+		}
+	}
+}
@@ -0,0 +1,183 @@
+package utils
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/manishlpu/assignment/models"
+)
+
+var ErrUploadNotPending = errors.New("upload is no longer pending")
+
+// PendingRecordOps records uploaded files in two steps. The file is recorded
+// as pending before its content is stored, and only committed along with its
+// content, which makes it visible, once the blob is durable. Files whose upload failed or never
+// completed are left for the reconciliation to remove.
+type PendingRecordOps interface {
+	CreatePendingRecord(record models.Metadata) (int64, error)
+	CommitRecord(content models.Metadata) (*models.Metadata, error)
+	FailRecord(id int64) error
+	FetchFailedRecords(before time.Time) ([]models.Metadata, error)
+	PurgeFailedRecords(before time.Time) (int64, error)
+}
+
+// Records the file as pending. The folder and the name of the file are
+// checked upfront so that the upload fails before storing its blob, they are
+// checked again on commit.
+func (pdb *PersistenceDBLayer) CreatePendingRecord(record models.Metadata) (int64, error) {
+	pdb.Lock()
+	defer pdb.Unlock()
+
+	tx, err := pdb.db.Begin()
+	if err != nil {
+		return int64(-1), err
+	}
+	defer tx.Rollback()
+
+	if err := checkFolderExists(tx, record.OwnerID, record.FolderID); err != nil {
+		return int64(-1), err
+	}
+	if err := checkNameAvailable(tx, record.OwnerID, record.FolderID, record.Filename, 0, 0); err != nil {
+		return int64(-1), err
+	}
+
+	insertSQL := "INSERT INTO file_metadata (filename, size_in_bytes, s3_object_key, description, mime_type, content_hash, content_md5, status, version, folder_id, owner_id) VALUES (?, ?, ?, ?, ?, ?, ?, ?, 1, ?, ?)"
+	res, err := tx.Exec(insertSQL, record.Filename, record.SizeInBytes, record.S3ObjectKey, record.Description, record.MimeType,
+		record.ContentHash, record.ContentMD5, models.STATUS_PENDING, record.FolderID, record.OwnerID)
+	if err != nil {
+		return int64(-1), err
+	}
+
+	id, err := res.LastInsertId()
+	if err != nil {
+		return int64(-1), err
+	}
+	return id, tx.Commit()
+}
+
+// Makes the pending file of the given ID visible with the stored content,
+// whose size, object and digests are taken from the given record. The blob of
+// the content is referenced and the first version of the file recorded.
+// Returns the committed file.
+func (pdb *PersistenceDBLayer) CommitRecord(content models.Metadata) (*models.Metadata, error) {
+	pdb.Lock()
+	defer pdb.Unlock()
+
+	tx, err := pdb.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	query := "SELECT " + metadataColumns + " FROM file_metadata WHERE id = ? AND status = ?"
+	record, err := scanMetadata(tx.QueryRow(query, content.ID, models.STATUS_PENDING))
+	if err == sql.ErrNoRows {
+		return nil, ErrUploadNotPending
+	} else if err != nil {
+		return nil, err
+	}
+	id := record.ID
+	record.SizeInBytes, record.S3ObjectKey = content.SizeInBytes, content.S3ObjectKey
+	record.ContentHash, record.ContentMD5 = content.ContentHash, content.ContentMD5
+
+	// Folders and files may have been created or deleted during the upload
+	if err := checkFolderExists(tx, record.OwnerID, record.FolderID); err != nil {
+		return nil, err
+	}
+	if err := checkNameAvailable(tx, record.OwnerID, record.FolderID, record.Filename, 0, id); err != nil {
+		return nil, err
+	}
+	if err := checkQuota(tx, record.OwnerID, record.SizeInBytes, 1); err != nil {
+		return nil, err
+	}
+	if err := retainBlob(tx, record); err != nil {
+		return nil, err
+	}
+
+	updateSQL := "UPDATE file_metadata SET status = ?, size_in_bytes = ?, s3_object_key = ?, content_hash = ?, content_md5 = ?, revision = revision + 1, updated_at = CURRENT_TIMESTAMP" +
+		" WHERE id = ? AND status = ?"
+	res, err := tx.Exec(updateSQL, models.STATUS_ACTIVE, record.SizeInBytes, record.S3ObjectKey, record.ContentHash, record.ContentMD5,
+		id, models.STATUS_PENDING)
+	if err != nil {
+		return nil, err
+	}
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return nil, err
+	}
+	if affected == 0 {
+		return nil, ErrUploadNotPending
+	}
+
+	if err := insertVersion(tx, id, 1, *record); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	record.Status = models.STATUS_ACTIVE
+	record.Revision++
+	return record, nil
+}
+
+// Marks the pending file as failed.
+func (pdb *PersistenceDBLayer) FailRecord(id int64) error {
+	pdb.Lock()
+	defer pdb.Unlock()
+
+	updateSQL := "UPDATE file_metadata SET status = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ? AND status = ?"
+	res, err := pdb.db.Exec(updateSQL, models.STATUS_FAILED, id, models.STATUS_PENDING)
+	if err != nil {
+		return err
+	}
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return ErrUploadNotPending
+	}
+	return nil
+}
+
+// Returns the failed files, along with the files still pending since before
+// the given time whose upload was interrupted.
+func (pdb *PersistenceDBLayer) FetchFailedRecords(before time.Time) ([]models.Metadata, error) {
+	query := "SELECT " + metadataColumns + " FROM file_metadata WHERE status = ? OR (status = ? AND updated_at < ?) ORDER BY id"
+
+	rows, err := pdb.db.Query(query, models.STATUS_FAILED, models.STATUS_PENDING, before.UTC())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var records []models.Metadata
+	for rows.Next() {
+		record, err := scanMetadata(rows)
+		if err != nil {
+			return nil, err
+		}
+		records = append(records, *record)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return records, nil
+}
+
+// Deletes the files returned by FetchFailedRecords. Such files never
+// referenced their blob, which is left to the reconciliation of the objects.
+// Returns the number of files deleted.
+func (pdb *PersistenceDBLayer) PurgeFailedRecords(before time.Time) (int64, error) {
+	pdb.Lock()
+	defer pdb.Unlock()
+
+	res, err := pdb.db.Exec("DELETE FROM file_metadata WHERE status = ? OR (status = ? AND updated_at < ?)",
+		models.STATUS_FAILED, models.STATUS_PENDING, before.UTC())
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
@@ -0,0 +1,267 @@
+package utils
+
+import (
+	"database/sql"
+	"errors"
+	"sort"
+	"strings"
+
+	"github.com/manishlpu/assignment/models"
+)
+
+var ErrPermissionNotFound = errors.New("no permission exists with given id")
+
+type PermissionOps interface {
+	GetFileAccess(userID, fileID int64) (*models.Metadata, string, error)
+	GetFolderAccess(userID, folderID int64) (*models.Folder, string, error)
+	GrantPermission(permission models.Permission) (int64, error)
+	FetchPermissions(resourceType string, resourceID int64) ([]models.Permission, error)
+	RevokePermission(resourceType string, resourceID, id int64) error
+	FetchSharedWithUser(userID int64) (*models.SharedWithMe, error)
+}
+
+// Matches the permissions granted to a user, directly or through the groups
+// the user is a member of. Takes the user id twice.
+const granteeCondition = "((grantee_type = 'user' AND grantee_id = ?) OR " +
+	"(grantee_type = 'group' AND grantee_id IN (SELECT group_id FROM group_members WHERE user_id = ?)))"
+
+// Returns the folder and its ancestors, up to the root folder excluded.
+func fetchFolderAncestors(q queryer, folderID int64) ([]int64, error) {
+	var folderIDs []int64
+	for id := folderID; id != models.ROOT_FOLDER_ID; {
+		folderIDs = append(folderIDs, id)
+		if err := q.QueryRow("SELECT parent_id FROM folders WHERE id = ?", id).Scan(&id); err != nil {
+			return nil, err
+		}
+	}
+	return folderIDs, nil
+}
+
+// Returns the highest role granted to the user on a file or folder, or on any
+// of the given folders containing it. Empty when no role is granted.
+func fetchGrantedRole(q queryer, userID int64, resourceType string, resourceID int64, folderIDs []int64) (string, error) {
+	query := "SELECT role FROM permissions WHERE ((resource_type = ? AND resource_id = ?)"
+	args := []interface{}{resourceType, resourceID}
+	if len(folderIDs) > 0 {
+		query += " OR (resource_type = ? AND resource_id IN (?" + strings.Repeat(", ?", len(folderIDs)-1) + "))"
+		args = append(args, models.RESOURCE_FOLDER)
+		for _, id := range folderIDs {
+			args = append(args, id)
+		}
+	}
+	query += ") AND " + granteeCondition
+	args = append(args, userID, userID)
+
+	rows, err := q.Query(query, args...)
+	if err != nil {
+		return "", err
+	}
+	defer rows.Close()
+
+	var role string
+	for rows.Next() {
+		var granted string
+		if err := rows.Scan(&granted); err != nil {
+			return "", err
+		}
+		role = models.MaxRole(role, granted)
+	}
+	return role, rows.Err()
+}
+
+// Returns the active file along with the role of the user on it, owner for
+// the files of the user. The role is empty when the user has no access.
+func (pdb *PersistenceDBLayer) GetFileAccess(userID, fileID int64) (*models.Metadata, string, error) {
+	query := "SELECT " + metadataColumns + " FROM file_metadata WHERE id = ? AND status = 1"
+
+	record, err := scanMetadata(pdb.db.QueryRow(query, fileID))
+	if err == sql.ErrNoRows {
+		return nil, "", nil
+	} else if err != nil {
+		return nil, "", err
+	}
+	if record.OwnerID == userID {
+		return record, models.ROLE_OWNER, nil
+	}
+
+	folderIDs, err := fetchFolderAncestors(pdb.db, record.FolderID)
+	if err != nil {
+		return nil, "", err
+	}
+	role, err := fetchGrantedRole(pdb.db, userID, models.RESOURCE_FILE, fileID, folderIDs)
+	if err != nil {
+		return nil, "", err
+	}
+	return record, role, nil
+}
+
+// Returns the active folder along with the role of the user on it, owner for
+// the folders of the user. The role is empty when the user has no access.
+func (pdb *PersistenceDBLayer) GetFolderAccess(userID, folderID int64) (*models.Folder, string, error) {
+	query := "SELECT " + folderColumns + " FROM folders WHERE id = ? AND status = 1"
+
+	folder, err := scanFolder(pdb.db.QueryRow(query, folderID))
+	if err == sql.ErrNoRows {
+		return nil, "", nil
+	} else if err != nil {
+		return nil, "", err
+	}
+	if folder.OwnerID == userID {
+		return folder, models.ROLE_OWNER, nil
+	}
+
+	folderIDs, err := fetchFolderAncestors(pdb.db, folder.ParentID)
+	if err != nil {
+		return nil, "", err
+	}
+	role, err := fetchGrantedRole(pdb.db, userID, models.RESOURCE_FOLDER, folderID, folderIDs)
+	if err != nil {
+		return nil, "", err
+	}
+	return folder, role, nil
+}
+
+// Grants the role to the grantee, replacing the role it was granted before on
+// the same file or folder.
+func (pdb *PersistenceDBLayer) GrantPermission(permission models.Permission) (int64, error) {
+	pdb.Lock()
+	defer pdb.Unlock()
+
+	tx, err := pdb.db.Begin()
+	if err != nil {
+		return int64(-1), err
+	}
+	defer tx.Rollback()
+
+	var id int64
+	err = tx.QueryRow(
+		"SELECT id FROM permissions WHERE resource_type = ? AND resource_id = ? AND grantee_type = ? AND grantee_id = ?",
+		permission.ResourceType, permission.ResourceID, permission.GranteeType, permission.GranteeID,
+	).Scan(&id)
+	if err == nil {
+		updateSQL := "UPDATE permissions SET role = ?, granted_by = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ?"
+		if _, err := tx.Exec(updateSQL, permission.Role, permission.GrantedBy, id); err != nil {
+			return int64(-1), err
+		}
+		return id, tx.Commit()
+	} else if err != sql.ErrNoRows {
+		return int64(-1), err
+	}
+
+	insertSQL := "INSERT INTO permissions (resource_type, resource_id, grantee_type, grantee_id, role, granted_by) VALUES (?, ?, ?, ?, ?, ?)"
+	res, err := tx.Exec(insertSQL, permission.ResourceType, permission.ResourceID, permission.GranteeType,
+		permission.GranteeID, permission.Role, permission.GrantedBy)
+	if err != nil {
+		return int64(-1), err
+	}
+	if id, err = res.LastInsertId(); err != nil {
+		return int64(-1), err
+	}
+	return id, tx.Commit()
+}
+
+// Returns the permissions granted on the file or folder, along with the names
+// of their grantees.
+func (pdb *PersistenceDBLayer) FetchPermissions(resourceType string, resourceID int64) ([]models.Permission, error) {
+	query := "SELECT p.id, p.resource_type, p.resource_id, p.grantee_type, p.grantee_id, COALESCE(u.username, g.name, ''), " +
+		"p.role, p.granted_by, p.created_at, p.updated_at FROM permissions p " +
+		"LEFT JOIN users u ON p.grantee_type = 'user' AND u.id = p.grantee_id " +
+		"LEFT JOIN user_groups g ON p.grantee_type = 'group' AND g.id = p.grantee_id " +
+		"WHERE p.resource_type = ? AND p.resource_id = ? ORDER BY p.id"
+
+	rows, err := pdb.db.Query(query, resourceType, resourceID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	permissions := []models.Permission{}
+	for rows.Next() {
+		var p models.Permission
+		err := rows.Scan(&p.ID, &p.ResourceType, &p.ResourceID, &p.GranteeType, &p.GranteeID, &p.GranteeName,
+			&p.Role, &p.GrantedBy, &p.CreatedAt, &p.UpdatedAt)
+		if err != nil {
+			return nil, err
+		}
+		permissions = append(permissions, p)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return permissions, nil
+}
+
+func (pdb *PersistenceDBLayer) RevokePermission(resourceType string, resourceID, id int64) error {
+	query := "DELETE FROM permissions WHERE id = ? AND resource_type = ? AND resource_id = ?"
+
+	res, err := pdb.db.Exec(query, id, resourceType, resourceID)
+	if err != nil {
+		return err
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return ErrPermissionNotFound
+	}
+	return nil
+}
+
+// Returns the active files and folders of other users shared with the user.
+// The content of shared folders is not listed, it is reached through them.
+func (pdb *PersistenceDBLayer) FetchSharedWithUser(userID int64) (*models.SharedWithMe, error) {
+	rows, err := pdb.db.Query("SELECT resource_type, resource_id, role FROM permissions WHERE "+granteeCondition, userID, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	// A resource may be shared both with the user and a group
+	fileRoles := make(map[int64]string)
+	folderRoles := make(map[int64]string)
+	for rows.Next() {
+		var resourceType, role string
+		var resourceID int64
+		if err := rows.Scan(&resourceType, &resourceID, &role); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		if resourceType == models.RESOURCE_FILE {
+			fileRoles[resourceID] = models.MaxRole(fileRoles[resourceID], role)
+		} else {
+			folderRoles[resourceID] = models.MaxRole(folderRoles[resourceID], role)
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	shared := &models.SharedWithMe{
+		Files:   []models.SharedFile{},
+		Folders: []models.SharedFolder{},
+	}
+	for fileID, role := range fileRoles {
+		record, err := scanMetadata(pdb.db.QueryRow("SELECT "+metadataColumns+" FROM file_metadata WHERE id = ? AND owner_id <> ? AND status = 1", fileID, userID))
+		if err == sql.ErrNoRows {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		shared.Files = append(shared.Files, models.SharedFile{Metadata: *record, Role: role})
+	}
+	for folderID, role := range folderRoles {
+		folder, err := scanFolder(pdb.db.QueryRow("SELECT "+folderColumns+" FROM folders WHERE id = ? AND owner_id <> ? AND status = 1", folderID, userID))
+		if err == sql.ErrNoRows {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		shared.Folders = append(shared.Folders, models.SharedFolder{Folder: *folder, Role: role})
+	}
+
+	sort.Slice(shared.Files, func(i, j int) bool { return shared.Files[i].ID < shared.Files[j].ID })
+	sort.Slice(shared.Folders, func(i, j int) bool { return shared.Folders[i].ID < shared.Folders[j].ID })
+	return shared, nil
+}
@@ -0,0 +1,74 @@
+package utils
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// Returned by ClaimPresignedUpload when the upload was completed already.
+var ErrUploadCompleted = errors.New("upload is already completed")
+
+// PresignedUploadOps records the presigned uploads being completed or
+// completed, so that each is completed once and its object is no longer
+// written once completed. Uploads are forgotten once their token expired.
+type PresignedUploadOps interface {
+	ClaimPresignedUpload(s3ObjectKey string, ownerID int64, expiresAt time.Time) error
+	ReleasePresignedUpload(s3ObjectKey string) error
+	IsPresignedUploadClaimed(s3ObjectKey string) (bool, error)
+	DeleteExpiredPresignedUploads() error
+}
+
+// Claims the completion of the upload of the given object. Fails with
+// ErrUploadCompleted when the upload was claimed already.
+func (pdb *PersistenceDBLayer) ClaimPresignedUpload(s3ObjectKey string, ownerID int64, expiresAt time.Time) error {
+	pdb.Lock()
+	defer pdb.Unlock()
+
+	insertSQL := "INSERT INTO presigned_uploads (s3_object_key, owner_id, expires_at) VALUES (?, ?, ?)"
+	_, err := pdb.db.Exec(insertSQL, s3ObjectKey, ownerID, expiresAt.UTC())
+	if err == nil {
+		return nil
+	}
+
+	// Another completion inserted the upload meanwhile
+	claimed, claimErr := pdb.IsPresignedUploadClaimed(s3ObjectKey)
+	if claimErr != nil {
+		return claimErr
+	}
+	if claimed {
+		return ErrUploadCompleted
+	}
+	return err
+}
+
+// Gives back the claim of an upload which could not be completed, which can
+// then be completed again.
+func (pdb *PersistenceDBLayer) ReleasePresignedUpload(s3ObjectKey string) error {
+	pdb.Lock()
+	defer pdb.Unlock()
+
+	_, err := pdb.db.Exec("DELETE FROM presigned_uploads WHERE s3_object_key = ?", s3ObjectKey)
+	return err
+}
+
+// Checks if the upload of the given object is being completed or completed.
+func (pdb *PersistenceDBLayer) IsPresignedUploadClaimed(s3ObjectKey string) (bool, error) {
+	var claimed bool
+	err := pdb.db.QueryRow("SELECT 1 FROM presigned_uploads WHERE s3_object_key = ?", s3ObjectKey).Scan(&claimed)
+	if err == sql.ErrNoRows {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// Removes the uploads whose token expired, which can no longer be completed.
+func (pdb *PersistenceDBLayer) DeleteExpiredPresignedUploads() error {
+	pdb.Lock()
+	defer pdb.Unlock()
+
+	_, err := pdb.db.Exec("DELETE FROM presigned_uploads WHERE expires_at < ?", time.Now().UTC())
+	return err
+}
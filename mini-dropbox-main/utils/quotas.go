@@ -0,0 +1,195 @@
+package utils
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/manishlpu/assignment/models"
+)
+
+var ErrQuotaExceeded = errors.New("storage quota exceeded")
+
+type QuotaOps interface {
+	GetQuota(subjectType string, subjectID int64) (*models.Quota, error)
+	SetQuota(quota models.Quota) error
+	FetchUsageEntries(ownerID int64) ([]models.UsageEntry, error)
+	FetchUsage(subjectType string, subjectID int64) (*models.Usage, error)
+	CheckQuota(ownerID, bytes, files int64) error
+}
+
+// Returns the quota of users who were not given one, read from
+// DEFAULT_QUOTA_BYTES and DEFAULT_QUOTA_FILES. Unlimited by default.
+func getDefaultQuota(userID int64) models.Quota {
+	quota := models.Quota{SubjectType: models.QUOTA_USER, SubjectID: userID}
+	for _, limit := range []struct {
+		env   string
+		value *int64
+	}{
+		{"DEFAULT_QUOTA_BYTES", &quota.MaxBytes},
+		{"DEFAULT_QUOTA_FILES", &quota.MaxFiles},
+	} {
+		value, err := strconv.ParseInt(GetEnvValue(limit.env, "0"), 10, 64)
+		if err != nil || value < 0 {
+			WarnLog("invalid ", limit.env, ", the quota is unlimited")
+			continue
+		}
+		*limit.value = value
+	}
+	return quota
+}
+
+func getQuota(q queryer, subjectType string, subjectID int64) (*models.Quota, error) {
+	quota := models.Quota{SubjectType: subjectType, SubjectID: subjectID}
+	query := "SELECT max_bytes, max_files FROM quotas WHERE subject_type = ? AND subject_id = ?"
+	err := q.QueryRow(query, subjectType, subjectID).Scan(&quota.MaxBytes, &quota.MaxFiles)
+	if err == sql.ErrNoRows {
+		// Groups are unlimited unless given a quota
+		if subjectType == models.QUOTA_USER {
+			quota = getDefaultQuota(subjectID)
+		}
+		return &quota, nil
+	} else if err != nil {
+		return nil, err
+	}
+	return &quota, nil
+}
+
+// Returns the quota of the user or group, the default one when it was not
+// given any.
+func (pdb *PersistenceDBLayer) GetQuota(subjectType string, subjectID int64) (*models.Quota, error) {
+	return getQuota(pdb.db, subjectType, subjectID)
+}
+
+// Sets the quota of the user or group, replacing the previous one.
+func (pdb *PersistenceDBLayer) SetQuota(quota models.Quota) error {
+	pdb.Lock()
+	defer pdb.Unlock()
+
+	tx, err := pdb.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec("DELETE FROM quotas WHERE subject_type = ? AND subject_id = ?", quota.SubjectType, quota.SubjectID); err != nil {
+		return err
+	}
+	insertSQL := "INSERT INTO quotas (subject_type, subject_id, max_bytes, max_files) VALUES (?, ?, ?, ?)"
+	if _, err := tx.Exec(insertSQL, quota.SubjectType, quota.SubjectID, quota.MaxBytes, quota.MaxFiles); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// Returns the condition selecting the files accounted in the usage of the
+// user or group, along with its argument.
+func getUsageCondition(subjectType string, subjectID int64) (string, interface{}) {
+	if subjectType == models.QUOTA_GROUP {
+		return "f.owner_id IN (SELECT user_id FROM group_members WHERE group_id = ?)", subjectID
+	}
+	return "f.owner_id = ?", subjectID
+}
+
+func fetchUsage(q queryer, subjectType string, subjectID int64) (*models.Usage, error) {
+	condition, arg := getUsageCondition(subjectType, subjectID)
+
+	var usage models.Usage
+	query := "SELECT COALESCE(SUM(v.size_in_bytes), 0) FROM file_versions v JOIN file_metadata f ON f.id = v.file_id" +
+		" WHERE f.status IN (0, 1) AND " + condition
+	if err := q.QueryRow(query, arg).Scan(&usage.Bytes); err != nil {
+		return nil, err
+	}
+	query = "SELECT COUNT(*) FROM file_metadata f WHERE f.status IN (0, 1) AND " + condition
+	if err := q.QueryRow(query, arg).Scan(&usage.Files); err != nil {
+		return nil, err
+	}
+	return &usage, nil
+}
+
+// Returns the storage used by the user or group.
+func (pdb *PersistenceDBLayer) FetchUsage(subjectType string, subjectID int64) (*models.Usage, error) {
+	return fetchUsage(pdb.db, subjectType, subjectID)
+}
+
+// Returns the storage used by the owner, by mime type and state of the
+// versions.
+func (pdb *PersistenceDBLayer) FetchUsageEntries(ownerID int64) ([]models.UsageEntry, error) {
+	state := "CASE WHEN f.status = 0 THEN '" + models.USAGE_TRASH + "' WHEN v.version = f.version THEN '" + models.USAGE_CURRENT +
+		"' ELSE '" + models.USAGE_VERSION + "' END"
+	query := "SELECT COALESCE(v.mime_type, ''), " + state + ", SUM(CASE WHEN v.version = f.version THEN 1 ELSE 0 END), COUNT(*), COALESCE(SUM(v.size_in_bytes), 0)" +
+		" FROM file_versions v JOIN file_metadata f ON f.id = v.file_id WHERE f.owner_id = ? AND f.status IN (0, 1)" +
+		" GROUP BY COALESCE(v.mime_type, ''), " + state
+
+	rows, err := pdb.db.Query(query, ownerID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	entries := []models.UsageEntry{}
+	for rows.Next() {
+		var entry models.UsageEntry
+		if err := rows.Scan(&entry.MimeType, &entry.State, &entry.Files, &entry.Versions, &entry.Bytes); err != nil {
+			return nil, err
+		}
+		entries = append(entries, entry)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+// Checks that the owner may store the given number of bytes and files more,
+// under its own quota and the quotas of its groups.
+func (pdb *PersistenceDBLayer) CheckQuota(ownerID, bytes, files int64) error {
+	return checkQuota(pdb.db, ownerID, bytes, files)
+}
+
+func checkQuota(q queryer, ownerID, bytes, files int64) error {
+	quotas := []*models.Quota{}
+	quota, err := getQuota(q, models.QUOTA_USER, ownerID)
+	if err != nil {
+		return err
+	}
+	quotas = append(quotas, quota)
+
+	query := "SELECT subject_id, max_bytes, max_files FROM quotas WHERE subject_type = ?" +
+		" AND subject_id IN (SELECT group_id FROM group_members WHERE user_id = ?)"
+	rows, err := q.Query(query, models.QUOTA_GROUP, ownerID)
+	if err != nil {
+		return err
+	}
+	for rows.Next() {
+		quota := &models.Quota{SubjectType: models.QUOTA_GROUP}
+		if err := rows.Scan(&quota.SubjectID, &quota.MaxBytes, &quota.MaxFiles); err != nil {
+			rows.Close()
+			return err
+		}
+		quotas = append(quotas, quota)
+	}
+	err = rows.Err()
+	rows.Close()
+	if err != nil {
+		return err
+	}
+
+	for _, quota := range quotas {
+		if quota.MaxBytes == 0 && quota.MaxFiles == 0 {
+			continue
+		}
+		usage, err := fetchUsage(q, quota.SubjectType, quota.SubjectID)
+		if err != nil {
+			return err
+		}
+		if quota.MaxBytes > 0 && bytes > 0 && usage.Bytes+bytes > quota.MaxBytes {
+			return fmt.Errorf("%w: %d of the %d bytes of the %s are used", ErrQuotaExceeded, usage.Bytes, quota.MaxBytes, quota.SubjectType)
+		}
+		if quota.MaxFiles > 0 && files > 0 && usage.Files+files > quota.MaxFiles {
+			return fmt.Errorf("%w: %d of the %d files of the %s are stored", ErrQuotaExceeded, usage.Files, quota.MaxFiles, quota.SubjectType)
+		}
+	}
+	return nil
+}
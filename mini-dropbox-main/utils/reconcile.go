@@ -0,0 +1,89 @@
+package utils
+
+import (
+	"database/sql"
+	"strings"
+)
+
+type ReconcileOps interface {
+	FetchObjectReferences() ([]ObjectReference, error)
+	IsObjectReferenced(keys ...string) (bool, error)
+}
+
+// ObjectReference is a row of the metadata store pointing at an object of the
+// blob store, which must exist for the row to be usable.
+type ObjectReference struct {
+	Table       string `json:"table"`
+	ID          string `json:"id"`
+	S3ObjectKey string `json:"s3_object_key"`
+}
+
+// Rows pointing at an object: the files, including the deleted and pending
+// ones, their versions, the blobs and the chunks of the active upload
+// sessions. The object is in the s3_object_key column of the table.
+var objectReferenceSources = []struct {
+	table, id, from, where string
+}{
+	{"file_metadata", "id", "file_metadata", "status IN (0, 1, 2)"},
+	{"file_versions", "id", "file_versions", ""},
+	{"blobs", "content_hash", "blobs", ""},
+	{"upload_chunks", "upload_chunks.session_id", "upload_chunks JOIN upload_sessions ON upload_sessions.id = upload_chunks.session_id", "upload_sessions.status = 0"},
+}
+
+// Returns every row pointing at an object.
+func (pdb *PersistenceDBLayer) FetchObjectReferences() ([]ObjectReference, error) {
+	var references []ObjectReference
+	for _, source := range objectReferenceSources {
+		query := "SELECT " + source.id + ", " + source.table + ".s3_object_key FROM " + source.from
+		if source.where != "" {
+			query += " WHERE " + source.where
+		}
+		rows, err := pdb.db.Query(query)
+		if err != nil {
+			return nil, err
+		}
+		for rows.Next() {
+			reference := ObjectReference{Table: source.table}
+			if err := rows.Scan(&reference.ID, &reference.S3ObjectKey); err != nil {
+				rows.Close()
+				return nil, err
+			}
+			references = append(references, reference)
+		}
+		err = rows.Err()
+		rows.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+	return references, nil
+}
+
+// Reports whether any of the rows returned by FetchObjectReferences points at
+// the object, given as any of the keys or URIs it is referred to by.
+func (pdb *PersistenceDBLayer) IsObjectReferenced(keys ...string) (bool, error) {
+	if len(keys) == 0 {
+		return false, nil
+	}
+
+	args := make([]interface{}, len(keys))
+	for i, key := range keys {
+		args[i] = key
+	}
+	in := "(?" + strings.Repeat(", ?", len(keys)-1) + ")"
+	for _, source := range objectReferenceSources {
+		query := "SELECT 1 FROM " + source.from + " WHERE " + source.table + ".s3_object_key IN " + in
+		if source.where != "" {
+			query += " AND " + source.where
+		}
+
+		var referenced bool
+		err := pdb.db.QueryRow(query+" LIMIT 1", args...).Scan(&referenced)
+		if err == nil {
+			return true, nil
+		} else if err != sql.ErrNoRows {
+			return false, err
+		}
+	}
+	return false, nil
+}
@@ -0,0 +1,166 @@
+package utils
+
+import (
+	"database/sql"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/manishlpu/assignment/models"
+)
+
+type SearchOps interface {
+	SearchRecords(ownerID int64, terms []string, limit int) ([]SearchHit, error)
+}
+
+// SearchHit is a file matching a search, along with its relevance, higher
+// being more relevant, and the text extracted from its content.
+type SearchHit struct {
+	Record  models.Metadata
+	Score   float64
+	Content string
+}
+
+// Splits a search query into the lowercased words it is made of, dropping the
+// punctuation and the operators of the full-text engines.
+func SearchTerms(query string) []string {
+	return strings.FieldsFunc(strings.ToLower(query), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+// fullTextSettings lists the words the FULLTEXT indexes of MySQL leave out,
+// which no search term can match.
+type fullTextSettings struct {
+	minTokenSize int
+	stopwords    map[string]bool
+}
+
+// Reads the minimum size of the indexed words and the stopwords of InnoDB,
+// falling back to its defaults when they cannot be read.
+func loadFullTextSettings(db *sql.DB) (fullTextSettings, error) {
+	settings := fullTextSettings{minTokenSize: 3}
+
+	var minTokenSize int
+	var stopwordsEnabled bool
+	var stopwordTable sql.NullString
+	query := "SELECT @@innodb_ft_min_token_size, @@innodb_ft_enable_stopword, @@innodb_ft_server_stopword_table"
+	if err := db.QueryRow(query).Scan(&minTokenSize, &stopwordsEnabled, &stopwordTable); err != nil {
+		return settings, err
+	}
+	settings.minTokenSize = minTokenSize
+	if !stopwordsEnabled {
+		return settings, nil
+	}
+
+	// The stopword table of the server is given as database/table
+	query = "SELECT value FROM information_schema.INNODB_FT_DEFAULT_STOPWORD"
+	if stopwordTable.Valid && stopwordTable.String != "" {
+		query = "SELECT value FROM `" + strings.Join(strings.SplitN(stopwordTable.String, "/", 2), "`.`") + "`"
+	}
+	rows, err := db.Query(query)
+	if err != nil {
+		return settings, err
+	}
+	defer rows.Close()
+
+	stopwords := map[string]bool{}
+	for rows.Next() {
+		var stopword string
+		if err := rows.Scan(&stopword); err != nil {
+			return settings, err
+		}
+		stopwords[strings.ToLower(stopword)] = true
+	}
+	if err := rows.Err(); err != nil {
+		return settings, err
+	}
+	settings.stopwords = stopwords
+	return settings, nil
+}
+
+// Returns the boolean mode query requiring (+) every term as a prefix (*).
+// Terms shorter than the indexed words or being stopwords are left out, as
+// files having them would never match. Returns an empty query when no term
+// is left.
+func (s fullTextSettings) matchQuery(terms []string) string {
+	var b strings.Builder
+	for _, term := range terms {
+		if utf8.RuneCountInString(term) < s.minTokenSize || s.stopwords[term] {
+			continue
+		}
+		b.WriteString("+" + term + "* ")
+	}
+	return b.String()
+}
+
+// Returns the active files of the owner whose filename and description, or
+// content, have words starting with every term, most relevant first. Uses the
+// FULLTEXT indexes of file_metadata and file_contents, maintained by MySQL
+// along with the rows. Matches on the filename or description weigh more than
+// matches on the content. Terms the indexes leave out are ignored, the files
+// are only matched by substring when no other term is searched.
+func (pdb *PersistenceDBLayer) SearchRecords(ownerID int64, terms []string, limit int) ([]SearchHit, error) {
+	match := pdb.fullText.matchQuery(terms)
+	if match == "" {
+		return pdb.searchRecordsByText(ownerID, terms, limit)
+	}
+
+	query := "SELECT " + metadataColumns + "," +
+		" MATCH (filename, description) AGAINST (? IN BOOLEAN MODE) * 2 + COALESCE(MATCH (content) AGAINST (? IN BOOLEAN MODE), 0) AS score," +
+		" COALESCE(content, '') FROM file_metadata LEFT JOIN file_contents ON file_id = id" +
+		" WHERE owner_id = ? AND status = 1" +
+		" AND (MATCH (filename, description) AGAINST (? IN BOOLEAN MODE) OR MATCH (content) AGAINST (? IN BOOLEAN MODE))" +
+		" ORDER BY score DESC, id DESC LIMIT ?"
+	return pdb.fetchSearchHits(query, match, match, ownerID, match, match, limit)
+}
+
+// Returns the active files of the owner whose filename, description or
+// content contain every term, latest first and unranked. Scans the files of
+// the owner instead of using the FULLTEXT indexes.
+func (pdb *PersistenceDBLayer) searchRecordsByText(ownerID int64, terms []string, limit int) ([]SearchHit, error) {
+	query := "SELECT " + metadataColumns + ", 0, COALESCE(content, '') FROM file_metadata LEFT JOIN file_contents ON file_id = id" +
+		" WHERE owner_id = ? AND status = 1"
+	args := []interface{}{ownerID}
+	for _, term := range terms {
+		// Terms are made of letters and digits only, none being a wildcard
+		query += " AND CONCAT_WS(' ', filename, description, content) LIKE ?"
+		args = append(args, "%"+term+"%")
+	}
+	query += " ORDER BY id DESC LIMIT ?"
+	return pdb.fetchSearchHits(query, append(args, limit)...)
+}
+
+func (pdb *PersistenceDBLayer) fetchSearchHits(query string, args ...interface{}) ([]SearchHit, error) {
+	rows, err := pdb.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	hits := []SearchHit{}
+	for rows.Next() {
+		var hit SearchHit
+		record, err := scanMetadata(extendedRow{rows, []interface{}{&hit.Score, &hit.Content}})
+		if err != nil {
+			return nil, err
+		}
+		hit.Record = *record
+		hits = append(hits, hit)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return hits, nil
+}
+
+// extendedRow scans the values selected after the columns of file_metadata
+// into extra.
+type extendedRow struct {
+	row   interface{ Scan(...interface{}) error }
+	extra []interface{}
+}
+
+func (r extendedRow) Scan(dest ...interface{}) error {
+	return r.row.Scan(append(dest, r.extra...)...)
+}
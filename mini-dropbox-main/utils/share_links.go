@@ -0,0 +1,178 @@
+package utils
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/manishlpu/assignment/models"
+)
+
+var ErrShareLinkNotFound = errors.New("no share link exists with given id")
+
+type ShareLinkOps interface {
+	CreateShareLink(link models.ShareLink) (int64, error)
+	GetShareLink(token string) (*models.ShareLink, error)
+	FetchShareLinks(ownerID, fileID int64) ([]models.ShareLink, error)
+	RevokeShareLink(ownerID, fileID, id int64) error
+	ClaimShareLinkDownload(id int64) (bool, error)
+	ReleaseShareLinkDownload(id int64) error
+	RecordShareLinkAccess(access models.ShareLinkAccess) error
+	FetchShareLinkAccesses(ownerID, fileID, id int64) ([]models.ShareLinkAccess, error)
+}
+
+const shareLinkColumns = "id, token, file_id, owner_id, password_hash, expires_at, max_downloads, download_count, status, created_at, updated_at"
+
+func scanShareLink(row interface{ Scan(...interface{}) error }) (*models.ShareLink, error) {
+	var link models.ShareLink
+	var expiresAt sql.NullTime
+	err := row.Scan(
+		&link.ID, &link.Token, &link.FileID, &link.OwnerID, &link.PasswordHash, &expiresAt,
+		&link.MaxDownloads, &link.DownloadCount, &link.Status, &link.CreatedAt, &link.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	if expiresAt.Valid {
+		link.ExpiresAt = &expiresAt.Time
+	}
+	return &link, nil
+}
+
+func (pdb *PersistenceDBLayer) CreateShareLink(link models.ShareLink) (int64, error) {
+	query := "INSERT INTO share_links (token, file_id, owner_id, password_hash, expires_at, max_downloads, status) VALUES (?, ?, ?, ?, ?, ?, 1)"
+
+	var expiresAt interface{}
+	if link.ExpiresAt != nil {
+		expiresAt = link.ExpiresAt.UTC()
+	}
+
+	res, err := pdb.db.Exec(query, link.Token, link.FileID, link.OwnerID, link.PasswordHash, expiresAt, link.MaxDownloads)
+	if err != nil {
+		return int64(-1), err
+	}
+	return res.LastInsertId()
+}
+
+// Returns the link with the token, whether it is still usable or not.
+func (pdb *PersistenceDBLayer) GetShareLink(token string) (*models.ShareLink, error) {
+	query := "SELECT " + shareLinkColumns + " FROM share_links WHERE token = ?"
+
+	link, err := scanShareLink(pdb.db.QueryRow(query, token))
+	if err == sql.ErrNoRows {
+		// No link found with the given token, not an error.
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	return link, nil
+}
+
+// Returns the active links of the file.
+func (pdb *PersistenceDBLayer) FetchShareLinks(ownerID, fileID int64) ([]models.ShareLink, error) {
+	query := "SELECT " + shareLinkColumns + " FROM share_links WHERE owner_id = ? AND file_id = ? AND status = 1 ORDER BY id"
+
+	rows, err := pdb.db.Query(query, ownerID, fileID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	links := []models.ShareLink{}
+	for rows.Next() {
+		link, err := scanShareLink(rows)
+		if err != nil {
+			return nil, err
+		}
+		links = append(links, *link)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return links, nil
+}
+
+// Revokes the link, its accesses are kept.
+func (pdb *PersistenceDBLayer) RevokeShareLink(ownerID, fileID, id int64) error {
+	query := "UPDATE share_links SET status = 0, updated_at = CURRENT_TIMESTAMP WHERE id = ? AND owner_id = ? AND file_id = ? AND status = 1"
+
+	res, err := pdb.db.Exec(query, id, ownerID, fileID)
+	if err != nil {
+		return err
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return ErrShareLinkNotFound
+	}
+	return nil
+}
+
+// Counts a download of the link, unless it is no longer usable. The count is
+// checked and incremented at once, so concurrent downloads never exceed the
+// maximum.
+func (pdb *PersistenceDBLayer) ClaimShareLinkDownload(id int64) (bool, error) {
+	query := "UPDATE share_links SET download_count = download_count + 1, updated_at = CURRENT_TIMESTAMP " +
+		"WHERE id = ? AND status = 1 AND (expires_at IS NULL OR expires_at > ?) AND (max_downloads = 0 OR download_count < max_downloads)"
+
+	res, err := pdb.db.Exec(query, id, time.Now().UTC())
+	if err != nil {
+		return false, err
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return affected > 0, nil
+}
+
+// Gives back a download counted by ClaimShareLinkDownload, when the file
+// could not be served.
+func (pdb *PersistenceDBLayer) ReleaseShareLinkDownload(id int64) error {
+	query := "UPDATE share_links SET download_count = download_count - 1, updated_at = CURRENT_TIMESTAMP WHERE id = ? AND download_count > 0"
+
+	_, err := pdb.db.Exec(query, id)
+	return err
+}
+
+func (pdb *PersistenceDBLayer) RecordShareLinkAccess(access models.ShareLinkAccess) error {
+	query := "INSERT INTO share_link_accesses (link_id, ip_address, user_agent, status_code) VALUES (?, ?, ?, ?)"
+
+	_, err := pdb.db.Exec(query, access.LinkID, access.IPAddress, access.UserAgent, access.StatusCode)
+	return err
+}
+
+// Returns the accesses of a link of the file, latest first.
+func (pdb *PersistenceDBLayer) FetchShareLinkAccesses(ownerID, fileID, id int64) ([]models.ShareLinkAccess, error) {
+	var exists bool
+	err := pdb.db.QueryRow("SELECT 1 FROM share_links WHERE id = ? AND owner_id = ? AND file_id = ?", id, ownerID, fileID).Scan(&exists)
+	if err == sql.ErrNoRows {
+		return nil, ErrShareLinkNotFound
+	} else if err != nil {
+		return nil, err
+	}
+
+	query := "SELECT id, link_id, ip_address, user_agent, status_code, accessed_at FROM share_link_accesses WHERE link_id = ? ORDER BY id DESC"
+	rows, err := pdb.db.Query(query, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	accesses := []models.ShareLinkAccess{}
+	for rows.Next() {
+		var access models.ShareLinkAccess
+		if err := rows.Scan(&access.ID, &access.LinkID, &access.IPAddress, &access.UserAgent, &access.StatusCode, &access.AccessedAt); err != nil {
+			return nil, err
+		}
+		accesses = append(accesses, access)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return accesses, nil
+}
@@ -0,0 +1,79 @@
+package utils
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strings"
+	"sync"
+)
+
+var (
+	ErrInvalidToken = errors.New("invalid token")
+
+	signingKey     []byte
+	signingKeyOnce sync.Once
+)
+
+// Returns the key used to sign tokens, read from PRESIGN_SECRET. Without it a
+// random key is generated, and tokens stop being valid on restart.
+func getSigningKey() []byte {
+	signingKeyOnce.Do(func() {
+		secret := GetEnvValue("PRESIGN_SECRET", "")
+		if !IsEmptyString(secret) {
+			signingKey = []byte(secret)
+			return
+		}
+
+		WarnLog("PRESIGN_SECRET is not set, using a random signing key")
+		signingKey = make([]byte, 32)
+		if _, err := rand.Read(signingKey); err != nil {
+			panic(err)
+		}
+	})
+	return signingKey
+}
+
+// SignToken returns a URL safe token carrying the JSON encoding of the claims
+// along with its HMAC-SHA256 signature.
+func SignToken(claims interface{}) (string, error) {
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+
+	encoded := base64.RawURLEncoding.EncodeToString(payload)
+	return encoded + "." + base64.RawURLEncoding.EncodeToString(sign(encoded)), nil
+}
+
+// VerifyToken checks the signature of a token issued by SignToken and decodes
+// its claims.
+func VerifyToken(token string, claims interface{}) error {
+	encoded, signature, ok := strings.Cut(token, ".")
+	if !ok {
+		return ErrInvalidToken
+	}
+
+	mac, err := base64.RawURLEncoding.DecodeString(signature)
+	if err != nil || !hmac.Equal(mac, sign(encoded)) {
+		return ErrInvalidToken
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return ErrInvalidToken
+	}
+	if err := json.Unmarshal(payload, claims); err != nil {
+		return ErrInvalidToken
+	}
+	return nil
+}
+
+func sign(data string) []byte {
+	mac := hmac.New(sha256.New, getSigningKey())
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
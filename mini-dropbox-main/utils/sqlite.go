@@ -0,0 +1,447 @@
+package utils
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	_ "modernc.org/sqlite"
+)
+
+// Schema of the embedded database, equivalent to metadata.sql. Statements are
+// idempotent so the schema is applied on every start, once the databases
+// created by earlier releases are migrated. Columns added to an existing table
+// come with a migration in sqliteMigrations and mysqlMigrations.
+const sqliteSchema = `
+CREATE TABLE IF NOT EXISTS file_metadata (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    filename VARCHAR(255) NOT NULL,
+    size_in_bytes BIGINT NOT NULL,
+    s3_object_key VARCHAR(255) NOT NULL,
+    description TEXT,
+    mime_type VARCHAR(255),
+    content_hash VARCHAR(64) NOT NULL DEFAULT '',
+    content_md5 VARCHAR(32) NOT NULL DEFAULT '',
+    status TINYINT NOT NULL DEFAULT 1,
+    version INTEGER NOT NULL DEFAULT 1,
+    revision INTEGER NOT NULL DEFAULT 1,
+    version_retention INTEGER NOT NULL DEFAULT 0,
+    folder_id INTEGER NOT NULL DEFAULT 0,
+    owner_id INTEGER NOT NULL DEFAULT 0,
+    prev_key VARCHAR(255),
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS active_files ON file_metadata (filename, status);
+CREATE INDEX IF NOT EXISTS trash_files ON file_metadata (status, updated_at);
+CREATE INDEX IF NOT EXISTS folder_files ON file_metadata (owner_id, folder_id, status);
+
+CREATE TABLE IF NOT EXISTS folders (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    name VARCHAR(255) NOT NULL,
+    parent_id INTEGER NOT NULL DEFAULT 0,
+    owner_id INTEGER NOT NULL DEFAULT 0,
+    status TINYINT NOT NULL DEFAULT 1,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS folder_children ON folders (owner_id, parent_id, status);
+
+CREATE TABLE IF NOT EXISTS file_versions (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    file_id INTEGER NOT NULL,
+    version INTEGER NOT NULL,
+    filename VARCHAR(255) NOT NULL,
+    size_in_bytes BIGINT NOT NULL,
+    s3_object_key VARCHAR(255) NOT NULL,
+    description TEXT,
+    mime_type VARCHAR(255),
+    content_hash VARCHAR(64) NOT NULL DEFAULT '',
+    content_md5 VARCHAR(32) NOT NULL DEFAULT '',
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (file_id, version)
+);
+
+CREATE INDEX IF NOT EXISTS version_objects ON file_versions (s3_object_key);
+
+CREATE TABLE IF NOT EXISTS upload_sessions (
+    id VARCHAR(64) PRIMARY KEY,
+    filename VARCHAR(255) NOT NULL,
+    description TEXT,
+    size_in_bytes BIGINT NOT NULL,
+    upload_offset BIGINT NOT NULL DEFAULT 0,
+    s3_object_key VARCHAR(255) NOT NULL,
+    folder_id INTEGER NOT NULL DEFAULT 0,
+    status TINYINT NOT NULL DEFAULT 0,
+    file_id INTEGER NOT NULL DEFAULT 0,
+    owner_id INTEGER NOT NULL DEFAULT 0,
+    expires_at TIMESTAMP NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS expired_uploads ON upload_sessions (expires_at);
+
+CREATE TABLE IF NOT EXISTS upload_chunks (
+    session_id VARCHAR(64) NOT NULL,
+    chunk_offset BIGINT NOT NULL,
+    size_in_bytes BIGINT NOT NULL,
+    s3_object_key VARCHAR(255) NOT NULL,
+    PRIMARY KEY (session_id, chunk_offset),
+    FOREIGN KEY (session_id) REFERENCES upload_sessions (id) ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS users (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    username VARCHAR(64) NOT NULL UNIQUE,
+    password_hash VARCHAR(255) NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS sessions (
+    token_hash VARCHAR(64) PRIMARY KEY,
+    user_id INTEGER NOT NULL,
+    expires_at TIMESTAMP NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS expired_sessions ON sessions (expires_at);
+
+CREATE TABLE IF NOT EXISTS api_tokens (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    user_id INTEGER NOT NULL,
+    name VARCHAR(255) NOT NULL,
+    token_hash VARCHAR(64) NOT NULL UNIQUE,
+    scopes VARCHAR(255) NOT NULL,
+    expires_at TIMESTAMP NULL,
+    last_used_at TIMESTAMP NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS user_api_tokens ON api_tokens (user_id);
+
+CREATE TABLE IF NOT EXISTS share_links (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    token VARCHAR(64) NOT NULL UNIQUE,
+    file_id INTEGER NOT NULL,
+    owner_id INTEGER NOT NULL,
+    password_hash VARCHAR(255) NOT NULL DEFAULT '',
+    expires_at TIMESTAMP NULL,
+    max_downloads INTEGER NOT NULL DEFAULT 0,
+    download_count INTEGER NOT NULL DEFAULT 0,
+    status TINYINT NOT NULL DEFAULT 1,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS file_share_links ON share_links (file_id, status);
+
+CREATE TABLE IF NOT EXISTS share_link_accesses (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    link_id INTEGER NOT NULL,
+    ip_address VARCHAR(64) NOT NULL,
+    user_agent VARCHAR(255) NOT NULL DEFAULT '',
+    status_code INTEGER NOT NULL,
+    accessed_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (link_id) REFERENCES share_links (id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS link_accesses ON share_link_accesses (link_id);
+
+CREATE TABLE IF NOT EXISTS user_groups (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    name VARCHAR(64) NOT NULL UNIQUE,
+    owner_id INTEGER NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS group_members (
+    group_id INTEGER NOT NULL,
+    user_id INTEGER NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (group_id, user_id),
+    FOREIGN KEY (group_id) REFERENCES user_groups (id) ON DELETE CASCADE,
+    FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS user_memberships ON group_members (user_id);
+
+CREATE TABLE IF NOT EXISTS group_invitations (
+    group_id INTEGER NOT NULL,
+    user_id INTEGER NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (group_id, user_id),
+    FOREIGN KEY (group_id) REFERENCES user_groups (id) ON DELETE CASCADE,
+    FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS user_invitations ON group_invitations (user_id);
+
+CREATE TABLE IF NOT EXISTS permissions (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    resource_type VARCHAR(16) NOT NULL,
+    resource_id INTEGER NOT NULL,
+    grantee_type VARCHAR(16) NOT NULL,
+    grantee_id INTEGER NOT NULL,
+    role VARCHAR(16) NOT NULL,
+    granted_by INTEGER NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (resource_type, resource_id, grantee_type, grantee_id)
+);
+
+CREATE INDEX IF NOT EXISTS grantee_permissions ON permissions (grantee_type, grantee_id);
+
+CREATE TABLE IF NOT EXISTS blobs (
+    content_hash VARCHAR(64) PRIMARY KEY,
+    s3_object_key VARCHAR(255) NOT NULL,
+    size_in_bytes BIGINT NOT NULL,
+    ref_count INTEGER NOT NULL DEFAULT 0,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS job_locks (
+    name VARCHAR(64) PRIMARY KEY,
+    holder VARCHAR(255) NOT NULL,
+    expires_at TIMESTAMP NOT NULL
+);
+
+CREATE VIRTUAL TABLE IF NOT EXISTS file_search USING fts5 (
+    filename, description, content = 'file_metadata', content_rowid = 'id'
+);
+
+CREATE TRIGGER IF NOT EXISTS file_search_insert AFTER INSERT ON file_metadata BEGIN
+    INSERT INTO file_search (rowid, filename, description) VALUES (new.id, new.filename, new.description);
+END;
+
+CREATE TRIGGER IF NOT EXISTS file_search_delete AFTER DELETE ON file_metadata BEGIN
+    INSERT INTO file_search (file_search, rowid, filename, description) VALUES ('delete', old.id, old.filename, old.description);
+END;
+
+CREATE TRIGGER IF NOT EXISTS file_search_update AFTER UPDATE OF filename, description ON file_metadata BEGIN
+    INSERT INTO file_search (file_search, rowid, filename, description) VALUES ('delete', old.id, old.filename, old.description);
+    INSERT INTO file_search (rowid, filename, description) VALUES (new.id, new.filename, new.description);
+END;
+
+CREATE TABLE IF NOT EXISTS file_contents (
+    file_id INTEGER PRIMARY KEY,
+    source_hash VARCHAR(64) NOT NULL,
+    content TEXT NOT NULL,
+    extracted_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE VIRTUAL TABLE IF NOT EXISTS file_content_search USING fts5 (
+    content, content = 'file_contents', content_rowid = 'file_id'
+);
+
+CREATE TRIGGER IF NOT EXISTS file_content_search_insert AFTER INSERT ON file_contents BEGIN
+    INSERT INTO file_content_search (rowid, content) VALUES (new.file_id, new.content);
+END;
+
+CREATE TRIGGER IF NOT EXISTS file_content_search_delete AFTER DELETE ON file_contents BEGIN
+    INSERT INTO file_content_search (file_content_search, rowid, content) VALUES ('delete', old.file_id, old.content);
+END;
+
+CREATE TABLE IF NOT EXISTS tags (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    owner_id INTEGER NOT NULL,
+    name VARCHAR(64) NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (owner_id, name)
+);
+
+CREATE TABLE IF NOT EXISTS file_tags (
+    file_id INTEGER NOT NULL,
+    tag_id INTEGER NOT NULL,
+    PRIMARY KEY (file_id, tag_id)
+);
+
+CREATE INDEX IF NOT EXISTS tag_files ON file_tags (tag_id);
+
+CREATE TABLE IF NOT EXISTS file_properties (
+    file_id INTEGER NOT NULL,
+    name VARCHAR(64) NOT NULL,
+    value VARCHAR(255) NOT NULL,
+    PRIMARY KEY (file_id, name)
+);
+
+CREATE INDEX IF NOT EXISTS property_files ON file_properties (name, value);
+
+CREATE TABLE IF NOT EXISTS quotas (
+    subject_type VARCHAR(16) NOT NULL,
+    subject_id INTEGER NOT NULL,
+    max_bytes BIGINT NOT NULL DEFAULT 0,
+    max_files INTEGER NOT NULL DEFAULT 0,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (subject_type, subject_id)
+);
+
+CREATE TABLE IF NOT EXISTS presigned_uploads (
+    s3_object_key VARCHAR(255) PRIMARY KEY,
+    owner_id INTEGER NOT NULL,
+    expires_at TIMESTAMP NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS expired_presigned_uploads ON presigned_uploads (expires_at);
+`
+
+// Migrations of the schema, the version of a database being the number of
+// migrations applied to it, kept in its user_version. New databases are
+// created from sqliteSchema at the latest version.
+var sqliteMigrations = []func(tx *sql.Tx) error{
+	// 1: adds the columns missing from the databases created before the
+	// schema was versioned
+	addSQLiteColumns,
+	// 2: records the files stored before versions were kept as their first
+	// version, once the tables they go to are created
+	func(tx *sql.Tx) error {
+		if _, err := tx.Exec(sqliteSchema); err != nil {
+			return err
+		}
+		return backfillVersions(tx, "'legacy-' || id")
+	},
+	// 3: adds the folder resumable uploads are made to
+	addSQLiteColumns,
+}
+
+// Adds the columns of addedColumns missing from the existing tables.
+func addSQLiteColumns(tx *sql.Tx) error {
+	for _, added := range addedColumns {
+		var count, exists int
+		query := "SELECT COUNT(*), COALESCE(SUM(name = ?), 0) FROM pragma_table_info(?)"
+		if err := tx.QueryRow(query, added.column, added.table).Scan(&count, &exists); err != nil {
+			return err
+		}
+		// Tables missing altogether are created by the schema
+		if count == 0 || exists > 0 {
+			continue
+		}
+		if _, err := tx.Exec("ALTER TABLE " + added.table + " ADD COLUMN " + added.column + " " + added.definition); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Brings the schema of the database to the latest version, applying the
+// migrations it is missing before the schema.
+func migrateSQLite(db *sql.DB) error {
+	var version, tables int
+	if err := db.QueryRow("PRAGMA user_version").Scan(&version); err != nil {
+		return err
+	}
+	if err := db.QueryRow("SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = 'file_metadata'").Scan(&tables); err != nil {
+		return err
+	}
+	if tables == 0 {
+		version = len(sqliteMigrations)
+	}
+	if version > len(sqliteMigrations) {
+		return fmt.Errorf("sqlite schema version %d is newer than the supported version %d", version, len(sqliteMigrations))
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for i := version; i < len(sqliteMigrations); i++ {
+		if err := sqliteMigrations[i](tx); err != nil {
+			return fmt.Errorf("sqlite migration %d: %w", i+1, err)
+		}
+	}
+	if _, err := tx.Exec(sqliteSchema); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(fmt.Sprintf("PRAGMA user_version = %d", len(sqliteMigrations))); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// SQLiteDBLayer is the MetadataOps implementation backed by an embedded
+// SQLite file, meant for single node deployments and tests. The queries of
+// PersistenceDBLayer are portable, only the dialect specific ones are
+// overridden here.
+type SQLiteDBLayer struct {
+	*PersistenceDBLayer
+}
+
+func NewSQLiteDBLayer(path string) (MetadataOps, error) {
+	if dir := filepath.Dir(path); dir != "" {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			ErrorLog("could not create sqlite directory: ", err)
+			return nil, err
+		}
+	}
+
+	// Wait on locked database instead of failing, and take the write lock at
+	// the start of transactions to avoid upgrade deadlocks.
+	dsn := "file:" + path + "?_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)&_pragma=foreign_keys(1)&_time_format=sqlite&_txlock=immediate"
+
+	db, err := sql.Open("sqlite", dsn)
+	if err != nil {
+		ErrorLog("could not open sqlite database: ", err)
+		return nil, err
+	}
+
+	var indexed int
+	if err := db.QueryRow("SELECT COUNT(*) FROM sqlite_master WHERE name = 'file_search'").Scan(&indexed); err != nil {
+		ErrorLog("could not inspect sqlite schema: ", err)
+		db.Close()
+		return nil, err
+	}
+
+	if err := migrateSQLite(db); err != nil {
+		ErrorLog("could not apply sqlite schema: ", err)
+		db.Close()
+		return nil, err
+	}
+
+	// The search index only follows the changes made once it exists, files
+	// recorded before are indexed when it is created
+	if indexed == 0 {
+		if _, err := db.Exec("INSERT INTO file_search (file_search) VALUES ('rebuild')"); err != nil {
+			ErrorLog("could not build the search index: ", err)
+			db.Close()
+			return nil, err
+		}
+	}
+
+	return &SQLiteDBLayer{
+		&PersistenceDBLayer{
+			db: db,
+		},
+	}, nil
+}
+
+// Searches the FTS5 indexes of file_metadata and file_contents, kept up to
+// date by triggers. Terms are matched as prefixes, filenames weighing more
+// than descriptions and descriptions more than contents in the BM25 ranking.
+func (sdb *SQLiteDBLayer) SearchRecords(ownerID int64, terms []string, limit int) ([]SearchHit, error) {
+	var b []string
+	for _, term := range terms {
+		b = append(b, `"`+term+`"*`)
+	}
+	match := strings.Join(b, " ")
+
+	query := "SELECT " + metadataColumns + ", score, COALESCE(content, '') FROM file_metadata" +
+		" JOIN (SELECT search_id, SUM(score) AS score FROM (" +
+		"SELECT rowid AS search_id, -bm25(file_search, 10.0, 2.0) AS score FROM file_search WHERE file_search MATCH ?" +
+		" UNION ALL SELECT rowid, -bm25(file_content_search) FROM file_content_search WHERE file_content_search MATCH ?" +
+		") GROUP BY search_id) ON id = search_id" +
+		" LEFT JOIN file_contents ON file_id = id" +
+		" WHERE owner_id = ? AND status = 1 ORDER BY score DESC, id DESC LIMIT ?"
+	return sdb.fetchSearchHits(query, match, match, ownerID, limit)
+}
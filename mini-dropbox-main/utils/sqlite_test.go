@@ -0,0 +1,129 @@
+package utils
+
+import (
+	"database/sql"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/manishlpu/assignment/models"
+)
+
+// Databases created before the schema was versioned lack the columns added
+// since, which are added on open.
+func TestSQLiteMigratesUnversionedDatabase(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "metadata.db")
+
+	db, err := sql.Open("sqlite", "file:"+path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = db.Exec(`CREATE TABLE file_metadata (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    filename VARCHAR(255) NOT NULL,
+    size_in_bytes BIGINT NOT NULL,
+    s3_object_key VARCHAR(255) NOT NULL,
+    description TEXT,
+    mime_type VARCHAR(255),
+    status TINYINT NOT NULL DEFAULT 1,
+    prev_key VARCHAR(255),
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+INSERT INTO file_metadata (filename, size_in_bytes, s3_object_key, description, mime_type) VALUES ('old.txt', 3, 'old.txt_1', '', 'text/plain');
+INSERT INTO file_metadata (filename, size_in_bytes, s3_object_key, description, mime_type, status) VALUES ('gone.txt', 5, 'gone.txt_1', '', 'text/plain', 0);`)
+	db.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	store, err := NewSQLiteDBLayer(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.(*SQLiteDBLayer).db.Close()
+
+	record := getTestRecord(t, store, 0, 1)
+	if record == nil || record.Filename != "old.txt" || record.Revision != 1 {
+		t.Errorf("unexpected migrated record: %+v", record)
+	}
+	saveTestRecord(t, store, newTestRecord(1, "new.txt", "h1", 10))
+	checkLegacyFilesMigrated(t, store)
+
+	var version int
+	if err := store.(*SQLiteDBLayer).db.QueryRow("PRAGMA user_version").Scan(&version); err != nil {
+		t.Fatal(err)
+	}
+	if version != len(sqliteMigrations) {
+		t.Errorf("expected version %d, got %d", len(sqliteMigrations), version)
+	}
+}
+
+// Databases of a previous version get the columns added since.
+func TestSQLiteMigratesUploadSessionFolders(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "metadata.db")
+	store, err := NewSQLiteDBLayer(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	db := store.(*SQLiteDBLayer).db
+	if _, err := db.Exec("ALTER TABLE upload_sessions DROP COLUMN folder_id; PRAGMA user_version = 2"); err != nil {
+		t.Fatal(err)
+	}
+	db.Close()
+
+	store, err = NewSQLiteDBLayer(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.(*SQLiteDBLayer).db.Close()
+
+	session := models.UploadSession{ID: "upload", Filename: "big.bin", SizeInBytes: 10, S3ObjectKey: "big.bin_1", FolderID: 4, OwnerID: 1, ExpiresAt: time.Now()}
+	if err := store.CreateUploadSession(session); err != nil {
+		t.Fatal(err)
+	}
+	created, err := store.GetUploadSession(1, "upload")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if created == nil || created.FolderID != 4 {
+		t.Errorf("unexpected upload session: %+v", created)
+	}
+}
+
+// Files stored before versions were kept get a first version on a blob of
+// their own, counted in the usage and whose object is released once the file
+// is purged.
+func checkLegacyFilesMigrated(t *testing.T, store MetadataOps) {
+	t.Helper()
+	versions, err := store.FetchVersions(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(versions) != 1 || versions[0].ContentHash != "legacy-1" || versions[0].S3ObjectKey != "old.txt_1" {
+		t.Errorf("unexpected versions of the migrated file: %+v", versions)
+	}
+
+	usage, err := store.FetchUsage(models.QUOTA_USER, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if usage.Bytes != 8 || usage.Files != 2 {
+		t.Errorf("expected the migrated files to use 8 bytes in 2 files, got %+v", usage)
+	}
+
+	unreferenced, err := store.PurgeRecord(0, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(unreferenced) != 1 || unreferenced[0] != "legacy-2" {
+		t.Fatalf("expected the blob of the purged file to be released, got %v", unreferenced)
+	}
+	blob, err := store.ClaimBlob(unreferenced[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if blob == nil || blob.S3ObjectKey != "gone.txt_1" {
+		t.Errorf("unexpected blob of the purged file: %+v", blob)
+	}
+}
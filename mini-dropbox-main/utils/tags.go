@@ -0,0 +1,216 @@
+package utils
+
+import (
+	"database/sql"
+	"errors"
+	"strings"
+
+	"github.com/manishlpu/assignment/models"
+)
+
+var ErrFileNotFound = errors.New("no file exists with given id")
+
+type TagOps interface {
+	SetRecordTags(ownerID, fileID, revision int64, tags []string) error
+	SetRecordProperties(ownerID, fileID, revision int64, properties map[string]string) error
+	LoadRecordLabels(records []models.Metadata) error
+	FetchTags(ownerID int64) ([]models.Tag, error)
+}
+
+// Replaces the tags of the active file of the owner, tags being created on
+// their first use and removed once no file carries them. Fails with
+// ErrPreconditionFailed when the file is no longer at the revision.
+func (pdb *PersistenceDBLayer) SetRecordTags(ownerID, fileID, revision int64, tags []string) error {
+	pdb.Lock()
+	defer pdb.Unlock()
+
+	tx, err := pdb.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := setRecordTags(tx, ownerID, fileID, tags); err != nil {
+		return err
+	}
+	if err := touchRecord(tx, fileID, revision); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func setRecordTags(tx *sql.Tx, ownerID, fileID int64, tags []string) error {
+	if err := checkRecordExists(tx, ownerID, fileID); err != nil {
+		return err
+	}
+
+	if _, err := tx.Exec("DELETE FROM file_tags WHERE file_id = ?", fileID); err != nil {
+		return err
+	}
+	for _, name := range tags {
+		var tagID int64
+		err := tx.QueryRow("SELECT id FROM tags WHERE owner_id = ? AND name = ?", ownerID, name).Scan(&tagID)
+		if err == sql.ErrNoRows {
+			res, err := tx.Exec("INSERT INTO tags (owner_id, name) VALUES (?, ?)", ownerID, name)
+			if err != nil {
+				return err
+			}
+			if tagID, err = res.LastInsertId(); err != nil {
+				return err
+			}
+		} else if err != nil {
+			return err
+		}
+
+		if _, err := tx.Exec("INSERT INTO file_tags (file_id, tag_id) VALUES (?, ?)", fileID, tagID); err != nil {
+			return err
+		}
+	}
+
+	_, err := tx.Exec("DELETE FROM tags WHERE owner_id = ? AND id NOT IN (SELECT tag_id FROM file_tags)", ownerID)
+	return err
+}
+
+// Replaces the properties of the active file of the owner, failing with
+// ErrPreconditionFailed when it is no longer at the revision.
+func (pdb *PersistenceDBLayer) SetRecordProperties(ownerID, fileID, revision int64, properties map[string]string) error {
+	pdb.Lock()
+	defer pdb.Unlock()
+
+	tx, err := pdb.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := setRecordProperties(tx, ownerID, fileID, properties); err != nil {
+		return err
+	}
+	if err := touchRecord(tx, fileID, revision); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func setRecordProperties(tx *sql.Tx, ownerID, fileID int64, properties map[string]string) error {
+	if err := checkRecordExists(tx, ownerID, fileID); err != nil {
+		return err
+	}
+
+	if _, err := tx.Exec("DELETE FROM file_properties WHERE file_id = ?", fileID); err != nil {
+		return err
+	}
+	for name, value := range properties {
+		if _, err := tx.Exec("INSERT INTO file_properties (file_id, name, value) VALUES (?, ?, ?)", fileID, name, value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Fails with ErrFileNotFound unless the owner has the active file.
+func checkRecordExists(q queryer, ownerID, fileID int64) error {
+	var id int64
+	err := q.QueryRow("SELECT id FROM file_metadata WHERE id = ? AND owner_id = ? AND status = 1", fileID, ownerID).Scan(&id)
+	if err == sql.ErrNoRows {
+		return ErrFileNotFound
+	}
+	return err
+}
+
+// Moves the file from the revision to the next, its labels being part of it.
+// Fails with ErrPreconditionFailed when the file was changed meanwhile.
+func touchRecord(tx *sql.Tx, fileID, revision int64) error {
+	query := "UPDATE file_metadata SET revision = revision + 1, updated_at = CURRENT_TIMESTAMP WHERE id = ? AND status = 1 AND revision = ?"
+	res, err := tx.Exec(query, fileID, revision)
+	if err != nil {
+		return err
+	}
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return ErrPreconditionFailed
+	}
+	return nil
+}
+
+// Fills the tags and properties of the records.
+func (pdb *PersistenceDBLayer) LoadRecordLabels(records []models.Metadata) error {
+	if len(records) == 0 {
+		return nil
+	}
+
+	index := make(map[int64]*models.Metadata, len(records))
+	args := make([]interface{}, 0, len(records))
+	for i := range records {
+		index[records[i].ID] = &records[i]
+		args = append(args, records[i].ID)
+	}
+	in := "(?" + strings.Repeat(", ?", len(args)-1) + ")"
+
+	rows, err := pdb.db.Query("SELECT file_id, name FROM file_tags JOIN tags ON tags.id = tag_id WHERE file_id IN "+in+" ORDER BY name", args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var fileID int64
+		var name string
+		if err := rows.Scan(&fileID, &name); err != nil {
+			return err
+		}
+		index[fileID].Tags = append(index[fileID].Tags, name)
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	rows, err = pdb.db.Query("SELECT file_id, name, value FROM file_properties WHERE file_id IN "+in, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var fileID int64
+		var name, value string
+		if err := rows.Scan(&fileID, &name, &value); err != nil {
+			return err
+		}
+		record := index[fileID]
+		if record.Properties == nil {
+			record.Properties = map[string]string{}
+		}
+		record.Properties[name] = value
+	}
+	return rows.Err()
+}
+
+// Returns the tags of the owner, by name, along with the number of active
+// files carrying them.
+func (pdb *PersistenceDBLayer) FetchTags(ownerID int64) ([]models.Tag, error) {
+	query := "SELECT tags.id, tags.name, COUNT(file_metadata.id) FROM tags" +
+		" JOIN file_tags ON file_tags.tag_id = tags.id" +
+		" LEFT JOIN file_metadata ON file_metadata.id = file_tags.file_id AND file_metadata.status = 1" +
+		" WHERE tags.owner_id = ? GROUP BY tags.id, tags.name ORDER BY tags.name"
+
+	rows, err := pdb.db.Query(query, ownerID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tags := []models.Tag{}
+	for rows.Next() {
+		var tag models.Tag
+		if err := rows.Scan(&tag.ID, &tag.Name, &tag.UsageCount); err != nil {
+			return nil, err
+		}
+		tags = append(tags, tag)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return tags, nil
+}
@@ -0,0 +1,168 @@
+package utils
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/manishlpu/assignment/models"
+)
+
+var ErrTrashedFileNotFound = errors.New("no deleted file exists with given id")
+
+type TrashOps interface {
+	FetchTrashedRecords(ownerID int64) ([]models.Metadata, error)
+	RestoreRecord(ownerID, id int64) (*models.Metadata, error)
+	PurgeRecord(ownerID, id int64) ([]string, error)
+	PurgeInactiveRecord(id int64, before time.Time) ([]string, error)
+}
+
+// Returns the deleted files of the owner, latest deleted first.
+func (pdb *PersistenceDBLayer) FetchTrashedRecords(ownerID int64) ([]models.Metadata, error) {
+	query := "SELECT " + metadataColumns + " FROM file_metadata WHERE owner_id = ? AND status = 0 ORDER BY updated_at DESC, id DESC"
+
+	rows, err := pdb.db.Query(query, ownerID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	files := []models.Metadata{}
+	for rows.Next() {
+		file, err := scanMetadata(rows)
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, *file)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return files, nil
+}
+
+// Fetches a deleted file of the owner within the transaction.
+func getTrashedRecord(tx *sql.Tx, ownerID, id int64) (*models.Metadata, error) {
+	query := "SELECT " + metadataColumns + " FROM file_metadata WHERE id = ? AND owner_id = ? AND status = 0"
+
+	record, err := scanMetadata(tx.QueryRow(query, id, ownerID))
+	if err == sql.ErrNoRows {
+		return nil, ErrTrashedFileNotFound
+	}
+	return record, err
+}
+
+// Restores a deleted file into its folder, or into the root folder when its
+// folder has been deleted as well. Returns the restored file.
+func (pdb *PersistenceDBLayer) RestoreRecord(ownerID, id int64) (*models.Metadata, error) {
+	pdb.Lock()
+	defer pdb.Unlock()
+
+	tx, err := pdb.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	record, err := getTrashedRecord(tx, ownerID, id)
+	if err != nil {
+		return nil, err
+	}
+
+	err = checkFolderExists(tx, ownerID, record.FolderID)
+	if errors.Is(err, ErrFolderNotFound) {
+		record.FolderID = models.ROOT_FOLDER_ID
+	} else if err != nil {
+		return nil, err
+	}
+	if err := checkNameAvailable(tx, ownerID, record.FolderID, record.Filename, 0, id); err != nil {
+		return nil, err
+	}
+
+	updateSQL := "UPDATE file_metadata SET status = 1, folder_id = ?, revision = revision + 1, updated_at = CURRENT_TIMESTAMP WHERE id = ? AND owner_id = ? AND status = 0"
+	if _, err := tx.Exec(updateSQL, record.FolderID, id, ownerID); err != nil {
+		return nil, err
+	}
+	record.Status = models.STATUS_ACTIVE
+	record.Revision++
+
+	return record, tx.Commit()
+}
+
+// Permanently deletes a deleted file of the owner along with its versions,
+// share links and permissions. Returns the content hashes of the blobs no
+// longer referenced by any version, whose objects can be removed from the
+// blob store once claimed.
+func (pdb *PersistenceDBLayer) PurgeRecord(ownerID, id int64) ([]string, error) {
+	pdb.Lock()
+	defer pdb.Unlock()
+
+	tx, err := pdb.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	if _, err := getTrashedRecord(tx, ownerID, id); err != nil {
+		return nil, err
+	}
+
+	unreferenced, err := purgeRecord(tx, id)
+	if err != nil {
+		return nil, err
+	}
+	return unreferenced, tx.Commit()
+}
+
+// Permanently deletes a file deleted before the given time, as PurgeRecord
+// does. Fails with ErrTrashedFileNotFound when the file was restored or
+// purged meanwhile.
+func (pdb *PersistenceDBLayer) PurgeInactiveRecord(id int64, before time.Time) ([]string, error) {
+	pdb.Lock()
+	defer pdb.Unlock()
+
+	tx, err := pdb.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var ownerID int64
+	err = tx.QueryRow("SELECT owner_id FROM file_metadata WHERE id = ? AND status = 0 AND updated_at < ?", id, before.UTC()).Scan(&ownerID)
+	if err == sql.ErrNoRows {
+		return nil, ErrTrashedFileNotFound
+	} else if err != nil {
+		return nil, err
+	}
+
+	unreferenced, err := purgeRecord(tx, id)
+	if err != nil {
+		return nil, err
+	}
+	return unreferenced, tx.Commit()
+}
+
+// Deletes the file along with everything referring to it within the
+// transaction.
+func purgeRecord(tx *sql.Tx, id int64) ([]string, error) {
+	unreferenced, err := pruneVersions(tx, id, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	statements := []string{
+		"DELETE FROM share_link_accesses WHERE link_id IN (SELECT id FROM share_links WHERE file_id = ?)",
+		"DELETE FROM share_links WHERE file_id = ?",
+		"DELETE FROM permissions WHERE resource_type = '" + models.RESOURCE_FILE + "' AND resource_id = ?",
+		"DELETE FROM file_contents WHERE file_id = ?",
+		"DELETE FROM file_tags WHERE file_id = ?",
+		"DELETE FROM file_properties WHERE file_id = ?",
+		"DELETE FROM file_metadata WHERE id = ?",
+	}
+	for _, statement := range statements {
+		if _, err := tx.Exec(statement, id); err != nil {
+			return nil, err
+		}
+	}
+	return unreferenced, nil
+}
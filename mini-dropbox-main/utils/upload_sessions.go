@@ -0,0 +1,197 @@
+package utils
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/manishlpu/assignment/models"
+)
+
+// Returned by AddUploadChunk when the chunk does not start at the current
+// offset of the session, e.g. on concurrent uploads of the same session.
+var ErrOffsetMismatch = errors.New("offset does not match the upload session")
+
+// Returned by CompleteUploadSession when the session was finalized or aborted
+// meanwhile.
+var ErrUploadSessionFinalized = errors.New("upload session is already finalized")
+
+type UploadSessionOps interface {
+	CreateUploadSession(session models.UploadSession) error
+	GetUploadSession(ownerID int64, id string) (*models.UploadSession, error)
+	AddUploadChunk(chunk models.UploadChunk, expiresAt time.Time) error
+	FetchUploadChunks(id string) ([]models.UploadChunk, error)
+	CompleteUploadSession(id string, record models.Metadata) (int64, error)
+	DeleteUploadSession(id string) error
+	FetchExpiredUploadSessions() ([]models.UploadSession, error)
+}
+
+const uploadSessionColumns = "id, filename, description, size_in_bytes, upload_offset, s3_object_key, folder_id, status, file_id, owner_id, expires_at, created_at, updated_at"
+
+func scanUploadSession(row interface{ Scan(...interface{}) error }) (*models.UploadSession, error) {
+	var session models.UploadSession
+	err := row.Scan(
+		&session.ID, &session.Filename, &session.Description, &session.SizeInBytes, &session.Offset,
+		&session.S3ObjectKey, &session.FolderID, &session.Status, &session.FileID, &session.OwnerID, &session.ExpiresAt, &session.CreatedAt, &session.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &session, nil
+}
+
+func (pdb *PersistenceDBLayer) CreateUploadSession(session models.UploadSession) error {
+	query := "INSERT INTO upload_sessions (id, filename, description, size_in_bytes, s3_object_key, folder_id, status, owner_id, expires_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)"
+
+	_, err := pdb.db.Exec(query, session.ID, session.Filename, session.Description, session.SizeInBytes,
+		session.S3ObjectKey, session.FolderID, models.UPLOAD_SESSION_ACTIVE, session.OwnerID, session.ExpiresAt.UTC())
+	return err
+}
+
+func (pdb *PersistenceDBLayer) GetUploadSession(ownerID int64, id string) (*models.UploadSession, error) {
+	query := "SELECT " + uploadSessionColumns + " FROM upload_sessions WHERE id = ? AND owner_id = ?"
+
+	session, err := scanUploadSession(pdb.db.QueryRow(query, id, ownerID))
+	if err == sql.ErrNoRows {
+		// No session found with the given identifier, not an error.
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	return session, nil
+}
+
+// Records a received chunk and moves the offset of the session past it. The
+// offset is compared and swapped, so only one of concurrent chunks wins.
+func (pdb *PersistenceDBLayer) AddUploadChunk(chunk models.UploadChunk, expiresAt time.Time) error {
+	tx, err := pdb.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	updateSQL := "UPDATE upload_sessions SET upload_offset = ?, expires_at = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ? AND upload_offset = ? AND status = ?"
+	res, err := tx.Exec(updateSQL, chunk.Offset+chunk.SizeInBytes, expiresAt.UTC(), chunk.SessionID, chunk.Offset, models.UPLOAD_SESSION_ACTIVE)
+	if err != nil {
+		return err
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return ErrOffsetMismatch
+	}
+
+	insertSQL := "INSERT INTO upload_chunks (session_id, chunk_offset, size_in_bytes, s3_object_key) VALUES (?, ?, ?, ?)"
+	if _, err := tx.Exec(insertSQL, chunk.SessionID, chunk.Offset, chunk.SizeInBytes, chunk.S3ObjectKey); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// Returns the chunks of the session, ordered by offset.
+func (pdb *PersistenceDBLayer) FetchUploadChunks(id string) ([]models.UploadChunk, error) {
+	query := "SELECT session_id, chunk_offset, size_in_bytes, s3_object_key FROM upload_chunks WHERE session_id = ? ORDER BY chunk_offset"
+
+	rows, err := pdb.db.Query(query, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var chunks []models.UploadChunk
+	for rows.Next() {
+		var chunk models.UploadChunk
+		if err := rows.Scan(&chunk.SessionID, &chunk.Offset, &chunk.SizeInBytes, &chunk.S3ObjectKey); err != nil {
+			return nil, err
+		}
+		chunks = append(chunks, chunk)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return chunks, nil
+}
+
+// Records the file of the session and marks the session completed with it in
+// a single transaction, so that only one of concurrent finalizes records the
+// file. Its chunks are no longer needed. Returns the ID of the file.
+func (pdb *PersistenceDBLayer) CompleteUploadSession(id string, record models.Metadata) (int64, error) {
+	pdb.Lock()
+	defer pdb.Unlock()
+
+	tx, err := pdb.db.Begin()
+	if err != nil {
+		return int64(-1), err
+	}
+	defer tx.Rollback()
+
+	fileID, err := saveRecord(tx, record)
+	if err != nil {
+		return int64(-1), err
+	}
+
+	updateSQL := "UPDATE upload_sessions SET status = ?, file_id = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ? AND status = ?"
+	res, err := tx.Exec(updateSQL, models.UPLOAD_SESSION_COMPLETED, fileID, id, models.UPLOAD_SESSION_ACTIVE)
+	if err != nil {
+		return int64(-1), err
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return int64(-1), err
+	}
+	if affected == 0 {
+		return int64(-1), ErrUploadSessionFinalized
+	}
+
+	if _, err := tx.Exec("DELETE FROM upload_chunks WHERE session_id = ?", id); err != nil {
+		return int64(-1), err
+	}
+
+	return fileID, tx.Commit()
+}
+
+func (pdb *PersistenceDBLayer) DeleteUploadSession(id string) error {
+	tx, err := pdb.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec("DELETE FROM upload_chunks WHERE session_id = ?", id); err != nil {
+		return err
+	}
+	if _, err := tx.Exec("DELETE FROM upload_sessions WHERE id = ?", id); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// Returns the sessions which expired, either abandoned or completed ones.
+func (pdb *PersistenceDBLayer) FetchExpiredUploadSessions() ([]models.UploadSession, error) {
+	query := "SELECT " + uploadSessionColumns + " FROM upload_sessions WHERE expires_at < ?"
+
+	rows, err := pdb.db.Query(query, time.Now().UTC())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var sessions []models.UploadSession
+	for rows.Next() {
+		session, err := scanUploadSession(rows)
+		if err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, *session)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return sessions, nil
+}
@@ -0,0 +1,97 @@
+package utils
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/manishlpu/assignment/models"
+)
+
+var ErrUsernameTaken = errors.New("username is already taken")
+
+type UserOps interface {
+	CreateUser(user models.User) (int64, error)
+	GetUserByUsername(username string) (*models.User, error)
+	CreateSession(tokenHash string, userID int64, expiresAt time.Time) error
+	GetSessionUser(tokenHash string) (*models.User, error)
+	DeleteSession(tokenHash string) error
+	DeleteExpiredSessions() error
+}
+
+const userColumns = "id, username, password_hash, created_at, updated_at"
+
+func scanUser(row interface{ Scan(...interface{}) error }) (*models.User, error) {
+	var user models.User
+	err := row.Scan(&user.ID, &user.Username, &user.PasswordHash, &user.CreatedAt, &user.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+func (pdb *PersistenceDBLayer) CreateUser(user models.User) (int64, error) {
+	pdb.Lock()
+	defer pdb.Unlock()
+
+	var taken bool
+	err := pdb.db.QueryRow("SELECT 1 FROM users WHERE username = ?", user.Username).Scan(&taken)
+	if err == nil {
+		return int64(-1), ErrUsernameTaken
+	} else if err != sql.ErrNoRows {
+		return int64(-1), err
+	}
+
+	res, err := pdb.db.Exec("INSERT INTO users (username, password_hash) VALUES (?, ?)", user.Username, user.PasswordHash)
+	if err != nil {
+		return int64(-1), err
+	}
+	return res.LastInsertId()
+}
+
+func (pdb *PersistenceDBLayer) GetUserByUsername(username string) (*models.User, error) {
+	query := "SELECT " + userColumns + " FROM users WHERE username = ?"
+
+	user, err := scanUser(pdb.db.QueryRow(query, username))
+	if err == sql.ErrNoRows {
+		// No user found with the given username, not an error.
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+// Sessions are looked up by the hash of their token, so that a leak of the
+// database does not leak usable tokens.
+func (pdb *PersistenceDBLayer) CreateSession(tokenHash string, userID int64, expiresAt time.Time) error {
+	query := "INSERT INTO sessions (token_hash, user_id, expires_at) VALUES (?, ?, ?)"
+
+	_, err := pdb.db.Exec(query, tokenHash, userID, expiresAt.UTC())
+	return err
+}
+
+// Returns the user of the session, nil when the session does not exist or
+// has expired.
+func (pdb *PersistenceDBLayer) GetSessionUser(tokenHash string) (*models.User, error) {
+	query := "SELECT u.id, u.username, u.password_hash, u.created_at, u.updated_at FROM sessions s " +
+		"JOIN users u ON u.id = s.user_id WHERE s.token_hash = ? AND s.expires_at > ?"
+
+	user, err := scanUser(pdb.db.QueryRow(query, tokenHash, time.Now().UTC()))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+func (pdb *PersistenceDBLayer) DeleteSession(tokenHash string) error {
+	_, err := pdb.db.Exec("DELETE FROM sessions WHERE token_hash = ?", tokenHash)
+	return err
+}
+
+func (pdb *PersistenceDBLayer) DeleteExpiredSessions() error {
+	_, err := pdb.db.Exec("DELETE FROM sessions WHERE expires_at < ?", time.Now().UTC())
+	return err
+}
@@ -0,0 +1,162 @@
+package utils
+
+import (
+	"database/sql"
+
+	"github.com/manishlpu/assignment/models"
+)
+
+type VersionOps interface {
+	FetchVersions(fileID int64) ([]models.FileVersion, error)
+	GetVersion(fileID, version int64) (*models.FileVersion, error)
+	SetVersionRetention(fileID, revision int64, retention int) error
+	PruneVersions(fileID int64, keep int) ([]string, error)
+}
+
+const fileVersionColumns = "id, file_id, version, filename, size_in_bytes, s3_object_key, description, mime_type, content_hash, content_md5, created_at"
+
+func scanFileVersion(row interface{ Scan(...interface{}) error }) (*models.FileVersion, error) {
+	var version models.FileVersion
+	err := row.Scan(
+		&version.ID, &version.FileID, &version.Version, &version.Filename, &version.SizeInBytes,
+		&version.S3ObjectKey, &version.Description, &version.MimeType, &version.ContentHash, &version.ContentMD5, &version.CreatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &version, nil
+}
+
+// Records the content of the record as the given version of the file.
+func insertVersion(tx *sql.Tx, fileID, version int64, record models.Metadata) error {
+	insertSQL := "INSERT INTO file_versions (file_id, version, filename, size_in_bytes, s3_object_key, description, mime_type, content_hash, content_md5) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)"
+
+	_, err := tx.Exec(insertSQL, fileID, version, record.Filename, record.SizeInBytes, record.S3ObjectKey,
+		record.Description, record.MimeType, record.ContentHash, record.ContentMD5)
+	return err
+}
+
+// Returns the versions of the file, latest first.
+func (pdb *PersistenceDBLayer) FetchVersions(fileID int64) ([]models.FileVersion, error) {
+	query := "SELECT " + fileVersionColumns + " FROM file_versions WHERE file_id = ? ORDER BY version DESC"
+
+	rows, err := pdb.db.Query(query, fileID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var versions []models.FileVersion
+	for rows.Next() {
+		version, err := scanFileVersion(rows)
+		if err != nil {
+			return nil, err
+		}
+		versions = append(versions, *version)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return versions, nil
+}
+
+func (pdb *PersistenceDBLayer) GetVersion(fileID, version int64) (*models.FileVersion, error) {
+	query := "SELECT " + fileVersionColumns + " FROM file_versions WHERE file_id = ? AND version = ?"
+
+	fileVersion, err := scanFileVersion(pdb.db.QueryRow(query, fileID, version))
+	if err == sql.ErrNoRows {
+		// No such version of the file, not an error.
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	return fileVersion, nil
+}
+
+// Sets the number of versions kept for the file, 0 restores the default.
+// Fails with ErrPreconditionFailed when the file is no longer at the
+// revision.
+func (pdb *PersistenceDBLayer) SetVersionRetention(fileID, revision int64, retention int) error {
+	query := "UPDATE file_metadata SET version_retention = ?, revision = revision + 1, updated_at = CURRENT_TIMESTAMP" +
+		" WHERE id = ? AND status = 1 AND revision = ?"
+
+	res, err := pdb.db.Exec(query, retention, fileID, revision)
+	if err != nil {
+		return err
+	}
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return ErrPreconditionFailed
+	}
+	return nil
+}
+
+// Deletes all but the latest keep versions of the file. Returns the content
+// hashes of the blobs no longer referenced by any version, whose objects can
+// be removed from the blob store once claimed.
+func (pdb *PersistenceDBLayer) PruneVersions(fileID int64, keep int) ([]string, error) {
+	pdb.Lock()
+	defer pdb.Unlock()
+
+	tx, err := pdb.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	unreferenced, err := pruneVersions(tx, fileID, keep)
+	if err != nil {
+		return nil, err
+	}
+	return unreferenced, tx.Commit()
+}
+
+// Deletes all but the latest keep versions of the file within the
+// transaction, releasing their blobs.
+func pruneVersions(tx *sql.Tx, fileID int64, keep int) ([]string, error) {
+	rows, err := tx.Query("SELECT id, content_hash FROM file_versions WHERE file_id = ? ORDER BY version DESC", fileID)
+	if err != nil {
+		return nil, err
+	}
+
+	var pruneIDs []int64
+	var pruneHashes []string
+	for kept := 0; rows.Next(); kept++ {
+		var id int64
+		var contentHash string
+		if err := rows.Scan(&id, &contentHash); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		if kept >= keep {
+			pruneIDs = append(pruneIDs, id)
+			pruneHashes = append(pruneHashes, contentHash)
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for _, id := range pruneIDs {
+		if _, err := tx.Exec("DELETE FROM file_versions WHERE id = ?", id); err != nil {
+			return nil, err
+		}
+	}
+
+	// Versions of the same content, of any file, share the same blob
+	var unreferenced []string
+	for _, contentHash := range pruneHashes {
+		released, err := releaseBlob(tx, contentHash)
+		if err != nil {
+			return nil, err
+		}
+		if released {
+			unreferenced = append(unreferenced, contentHash)
+		}
+	}
+	return unreferenced, nil
+}